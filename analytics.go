@@ -0,0 +1,348 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// analyticsRetention is how long we keep lookup counts for.
+const analyticsRetention = 13 * 7 * 24 * time.Hour
+
+// analyticsSaveInterval is how often counts are saved, at most; counting
+// every lookup doesn't need the whole file rewritten each time.
+const analyticsSaveInterval = time.Minute
+
+// analyticsTopCount is how many symbols /ticker -top and the weekly report
+// list.
+const analyticsTopCount = 10
+
+// AnalyticsBucket counts the lookups made in one workspace in one hour, by
+// symbol, user and channel. Only symbols and IDs are kept, never what
+// anyone typed.
+type AnalyticsBucket struct {
+	TeamID   string
+	Hour     time.Time
+	Symbols  map[string]int
+	Users    map[string]int
+	Channels map[string]int
+}
+
+// AnalyticsStore is a persistent, concurrency-safe record of how many
+// lookups have been made, and when each workspace was last sent its weekly
+// report.
+type AnalyticsStore struct {
+	sync.Mutex
+	path    string
+	buckets map[string]*AnalyticsBucket
+	reports map[string]time.Time
+	dirty   bool // counted since we last saved
+}
+
+// analyticsFile is how an AnalyticsStore is saved.
+type analyticsFile struct {
+	Buckets map[string]*AnalyticsBucket
+	Reports map[string]time.Time
+}
+
+// NewAnalyticsStore creates an empty store backed by the file at path. If
+// path is empty, counts are only kept in memory.
+func NewAnalyticsStore(path string) *AnalyticsStore {
+	return &AnalyticsStore{
+		path:    path,
+		buckets: map[string]*AnalyticsBucket{},
+		reports: map[string]time.Time{},
+	}
+}
+
+// Load replaces the contents of the store with what is saved on disk.
+func (s *AnalyticsStore) Load() error {
+	data := analyticsFile{
+		Buckets: map[string]*AnalyticsBucket{},
+		Reports: map[string]time.Time{},
+	}
+	if err := loadJSONFile(s.path, &data); err != nil {
+		return err
+	}
+	s.Lock()
+	s.buckets = data.Buckets
+	s.reports = data.Reports
+	s.Unlock()
+	return nil
+}
+
+// save writes the store to disk. The caller must hold the lock.
+func (s *AnalyticsStore) save() error {
+	if err := saveJSONFile(s.path, analyticsFile{s.buckets, s.reports}); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Save writes the store to disk, if anything has been counted since it was
+// last saved.
+func (s *AnalyticsStore) Save() error {
+	s.Lock()
+	defer s.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// SaveEvery (as a goroutine) saves the store periodically, so that no more
+// than an interval's counts are lost if we stop without saving.
+func (s *AnalyticsStore) SaveEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.Save(); err != nil {
+			log.Printf("Error saving analytics: %s", err)
+		}
+	}
+}
+
+// AnalyticsEnabled reports whether we count lookups made in a workspace;
+// workspaces can opt out with Config.AnalyticsOptOut.
+func AnalyticsEnabled(teamID string) bool {
+	for _, team := range Config().AnalyticsOptOut {
+		if team == teamID {
+			return false
+		}
+	}
+	return true
+}
+
+// Record counts a lookup of a symbol, unless the workspace has opted out.
+// The count is saved along with the others by Save.
+func (s *AnalyticsStore) Record(teamID, channelID, userID, symbol string, at time.Time) {
+	if !AnalyticsEnabled(teamID) {
+		return
+	}
+	hour := at.UTC().Truncate(time.Hour)
+	key := teamID + "@" + hour.Format(time.RFC3339)
+	s.Lock()
+	defer s.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &AnalyticsBucket{
+			TeamID:   teamID,
+			Hour:     hour,
+			Symbols:  map[string]int{},
+			Users:    map[string]int{},
+			Channels: map[string]int{},
+		}
+		s.buckets[key] = b
+		// A new hour is a good time to forget the oldest.
+		for k, old := range s.buckets {
+			if at.Sub(old.Hour) > analyticsRetention {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	b.Symbols[symbol]++
+	b.Users[userID]++
+	b.Channels[channelID]++
+	s.dirty = true
+}
+
+// Forget removes everything counted for a workspace.
+func (s *AnalyticsStore) Forget(teamID string) error {
+	s.Lock()
+	defer s.Unlock()
+	for k, b := range s.buckets {
+		if b.TeamID == teamID {
+			delete(s.buckets, k)
+		}
+	}
+	delete(s.reports, teamID)
+	return s.save()
+}
+
+// ForgetOptedOut removes everything counted for the workspaces that have
+// opted out, in case they did so after we'd started counting.
+func (s *AnalyticsStore) ForgetOptedOut() error {
+	for _, team := range Config().AnalyticsOptOut {
+		if err := s.Forget(team); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count is how many lookups something had.
+type Count struct {
+	Name  string
+	Count int
+}
+
+// AnalyticsSummary is the lookups made in a workspace over a period.
+type AnalyticsSummary struct {
+	Lookups  int
+	Symbols  []Count // most looked up first
+	Users    int
+	Channels []Count // busiest first
+	Hours    [24]int // by hour of the day, UTC
+}
+
+// topCounts orders counts, biggest (then alphabetically first) first.
+func topCounts(counts map[string]int) []Count {
+	var top []Count
+	for name, n := range counts {
+		top = append(top, Count{name, n})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top
+}
+
+// Summary adds up the lookups made in a workspace between two times (end
+// exclusive), to the hour.
+func (s *AnalyticsStore) Summary(teamID string, start, end time.Time) AnalyticsSummary {
+	symbols := map[string]int{}
+	users := map[string]int{}
+	channels := map[string]int{}
+	var summary AnalyticsSummary
+	s.Lock()
+	for _, b := range s.buckets {
+		if b.TeamID != teamID || b.Hour.Before(start.Truncate(time.Hour)) || !b.Hour.Before(end) {
+			continue
+		}
+		for symbol, n := range b.Symbols {
+			symbols[symbol] += n
+			summary.Lookups += n
+			summary.Hours[b.Hour.Hour()] += n
+		}
+		for user, n := range b.Users {
+			users[user] += n
+		}
+		for channel, n := range b.Channels {
+			channels[channel] += n
+		}
+	}
+	s.Unlock()
+	summary.Symbols = topCounts(symbols)
+	summary.Users = len(users)
+	summary.Channels = topCounts(channels)
+	return summary
+}
+
+// formatTopSymbols lists the most looked-up symbols, one per line.
+func formatTopSymbols(summary AnalyticsSummary, l *Locale) string {
+	var text bytes.Buffer
+	for i, c := range summary.Symbols {
+		if i == analyticsTopCount {
+			break
+		}
+		fmt.Fprintf(&text, "%d. *%s* %s\n", i+1, c.Name, l.Tf("(%d lookups)", c.Count))
+	}
+	return strings.TrimSpace(text.String())
+}
+
+// TopSymbolsPayload answers /ticker -top with the symbols looked up most in
+// a workspace over the past week.
+func TopSymbolsPayload(teamID string, l *Locale, now time.Time) map[string]interface{} {
+	if !AnalyticsEnabled(teamID) {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.T("This workspace has opted out of lookup statistics"),
+		}
+	}
+	summary := Analytics.Summary(teamID, now.Add(-7*24*time.Hour), now)
+	if summary.Lookups == 0 {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.T("Nobody has looked anything up this week"),
+		}
+	}
+	return map[string]interface{}{
+		"text": l.T("*Most looked-up symbols this week:*") + "\n" + formatTopSymbols(summary, l),
+	}
+}
+
+// WeeklyReportText describes a week of lookups, or returns "" if there
+// weren't any.
+func WeeklyReportText(summary AnalyticsSummary, l *Locale) string {
+	if summary.Lookups == 0 {
+		return ""
+	}
+	busiest := 0
+	for hour, n := range summary.Hours {
+		if n > summary.Hours[busiest] {
+			busiest = hour
+		}
+	}
+	var text bytes.Buffer
+	fmt.Fprintln(&text, l.Tf("*Last week on slacker:* %d lookups by %d people in %d channels",
+		summary.Lookups, summary.Users, len(summary.Channels)))
+	fmt.Fprintln(&text, formatTopSymbols(summary, l))
+	fmt.Fprintf(&text, "%s\n", l.Tf("Busiest channel: <#%s>. Busiest hour: %02d:00 UTC.",
+		summary.Channels[0].Name, busiest))
+	return strings.TrimSpace(text.String())
+}
+
+// weeklyReportDue is when this week's report is due: Monday at 09:00 UTC.
+func weeklyReportDue(now time.Time) time.Time {
+	now = now.UTC()
+	daysSinceMonday := (int(now.Weekday()) + 6) % 7
+	monday := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, 9, 0, 0, 0, time.UTC)
+	if now.Before(monday) {
+		monday = monday.AddDate(0, 0, -7)
+	}
+	return monday
+}
+
+// SendWeeklyReports posts last week's report to each workspace with an
+// AnalyticsReports channel that hasn't had it yet.
+func SendWeeklyReports(ctx context.Context, now time.Time) {
+	due := weeklyReportDue(now)
+	for teamID, channel := range Config().AnalyticsReports {
+		Analytics.Lock()
+		sent := Analytics.reports[teamID]
+		Analytics.Unlock()
+		if !sent.Before(due) || !AnalyticsEnabled(teamID) {
+			continue
+		}
+		inst, ok := Installations.Get(teamID)
+		if !ok {
+			log.Printf("Not sending weekly report: slacker isn't installed in %s", teamID)
+			continue
+		}
+		text := WeeklyReportText(Analytics.Summary(teamID, due.Add(-7*24*time.Hour), due),
+			LocaleFor(teamID, ""))
+		if text != "" {
+			if _, err := SlackFromContext(ctx).PostMessage(inst.BotToken, map[string]interface{}{
+				"channel": channel,
+				"text":    text,
+			}); err != nil {
+				log.Printf("Error sending weekly report to %s: %s", teamID, err)
+				continue
+			}
+		}
+		Analytics.Lock()
+		Analytics.reports[teamID] = due
+		if err := Analytics.save(); err != nil {
+			log.Printf("Error saving analytics: %s", err)
+		}
+		Analytics.Unlock()
+	}
+}
+
+// WeeklyReporter (as a goroutine) sends weekly reports as they fall due.
+func WeeklyReporter() {
+	for now := range time.Tick(10 * time.Minute) {
+		SendWeeklyReports(context.Background(), now)
+	}
+}
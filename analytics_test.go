@@ -0,0 +1,193 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyticsStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "analytics.json")
+	SetConfig(Configuration{AnalyticsOptOut: []string{"T2"}})
+	store := NewAnalyticsStore(path)
+
+	now := time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC)
+	store.Record("T1", "C1", "U1", "AAPL", now.Add(-200*24*time.Hour))
+	store.Record("T1", "C1", "U1", "AAPL", now.Add(-2*time.Hour))
+	store.Record("T1", "C1", "U2", "MSFT", now.Add(-2*time.Hour))
+	store.Record("T1", "C2", "U2", "AAPL", now)
+	store.Record("T1", "C1", "U1", "TSLA", now.Add(-8*24*time.Hour))
+	store.Record("T2", "C9", "U9", "AAPL", now)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected lookups to be saved periodically, not as they're counted")
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal("Save failed:", err)
+	}
+
+	reloaded := NewAnalyticsStore(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal("Load failed:", err)
+	}
+	summary := reloaded.Summary("T1", now.Add(-7*24*time.Hour), now.Add(time.Hour))
+	if summary.Lookups != 3 || summary.Users != 2 ||
+		fmt.Sprint(summary.Symbols) != "[{AAPL 2} {MSFT 1}]" ||
+		fmt.Sprint(summary.Channels) != "[{C1 2} {C2 1}]" ||
+		summary.Hours[12] != 2 || summary.Hours[14] != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if all := reloaded.Summary("T1", time.Time{}, now.Add(time.Hour)); all.Lookups != 4 {
+		t.Errorf("expected the 200-day-old lookup to have expired, got %d lookups", all.Lookups)
+	}
+	if opted := reloaded.Summary("T2", time.Time{}, now.Add(time.Hour)); opted.Lookups != 0 {
+		t.Errorf("expected nothing counted for T2, got %+v", opted)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	if strings.Contains(string(data), "T2") {
+		t.Error("expected nothing stored for the opted-out workspace")
+	}
+	changeTestConfig(func(c *Configuration) { c.AnalyticsOptOut = []string{"T1"} })
+	if err := reloaded.ForgetOptedOut(); err != nil {
+		t.Fatal("ForgetOptedOut failed:", err)
+	}
+	if s := reloaded.Summary("T1", time.Time{}, now.Add(time.Hour)); s.Lookups != 0 {
+		t.Errorf("expected T1 to be forgotten, got %+v", s)
+	}
+}
+
+func TestTopSymbols(t *testing.T) {
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	Analytics = NewAnalyticsStore("")
+	defer func() { Analytics = NewAnalyticsStore("") }()
+	call := func(team string) map[string]interface{} {
+		form := url.Values{"text": {"-top"}, "team_id": {team}, "user_id": {"U1"}}
+		req := httptest.NewRequest("POST", "/ticker", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := CommandHandler(TickerCommand)(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("handler failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return payload
+	}
+
+	if p := call("T1"); p["text"] != "Nobody has looked anything up this week" || p["response_type"] != "ephemeral" {
+		t.Errorf("unexpected answer %v", p)
+	}
+	for i, symbol := range []string{"AAPL", "MSFT", "AAPL"} {
+		Analytics.Record("T1", "C1", fmt.Sprintf("U%d", i), symbol, time.Now())
+	}
+	p := call("T1")
+	if p["text"] != "*Most looked-up symbols this week:*\n1. *AAPL* (2 lookups)\n2. *MSFT* (1 lookups)" ||
+		p["response_type"] != "in_channel" {
+		t.Errorf("unexpected answer %v", p)
+	}
+
+	changeTestConfig(func(c *Configuration) { c.AnalyticsOptOut = []string{"T1"} })
+	if p := call("T1"); p["text"] != "This workspace has opted out of lookup statistics" {
+		t.Errorf("unexpected opted-out answer %v", p)
+	}
+}
+
+func TestOnlyFoundSymbolsCounted(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/search") {
+			fmt.Fprint(w, `{"quotes":[]}`)
+		} else if r.URL.Query().Get("symbols") == "AAPL" {
+			fmt.Fprint(w, `{"quoteResponse":{"result":[{"symbol":"AAPL","currency":"USD","regularMarketPrice":150}]}}`)
+		} else {
+			fmt.Fprint(w, `{"quoteResponse":{"result":[]}}`)
+		}
+	}))
+	defer ts.Close()
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	Analytics = NewAnalyticsStore("")
+	defer func() { Analytics = NewAnalyticsStore("") }()
+
+	for _, symbol := range []string{"AAPL", "TYPO"} {
+		form := url.Values{"text": {symbol}, "team_id": {"T1"}, "user_id": {"U1"}, "channel_id": {"C1"}}
+		req := httptest.NewRequest("POST", "/ticker", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := WithYahoo(NewContext(req.Context(), req), NewYahoo(ts.URL))
+		if err := CommandHandler(TickerCommand)(httptest.NewRecorder(), req.WithContext(ctx)); err != nil {
+			t.Fatal("handler failed:", err)
+		}
+	}
+	summary := Analytics.Summary("T1", time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if fmt.Sprint(summary.Symbols) != "[{AAPL 1}]" {
+		t.Errorf("expected only AAPL to be counted, got %v", summary.Symbols)
+	}
+	if recent := Prefs.Get("T1", "U1").Recent; fmt.Sprint(recent) != "[AAPL]" {
+		t.Errorf("expected only AAPL in recent lookups, got %v", recent)
+	}
+}
+
+func TestWeeklyReports(t *testing.T) {
+	for now, due := range map[string]string{
+		"2026-10-19T09:00:00Z": "2026-10-19T09:00:00Z", // a Monday
+		"2026-10-19T08:59:00Z": "2026-10-12T09:00:00Z",
+		"2026-10-25T23:00:00Z": "2026-10-19T09:00:00Z", // a Sunday
+	} {
+		n, _ := time.Parse(time.RFC3339, now)
+		if got := weeklyReportDue(n).Format(time.RFC3339); got != due {
+			t.Errorf("%s: expected %s, got %s", now, due, got)
+		}
+	}
+
+	var posted []string
+	ss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message struct {
+			Channel string `json:"channel"`
+			Text    string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&message)
+		posted = append(posted, message.Channel+" "+message.Text)
+		fmt.Fprint(w, `{"ok":true,"ts":"1.2"}`)
+	}))
+	defer ss.Close()
+	SetConfig(Configuration{AnalyticsReports: map[string]string{"T1": "CREPORTS", "T3": "C3"}})
+	Prefs = NewPrefsStore("")
+	Installations = NewInstallationStore("")
+	Installations.Save(Installation{TeamID: "T1", BotToken: "xoxb-1"})
+	Analytics = NewAnalyticsStore("")
+	defer func() { Analytics = NewAnalyticsStore("") }()
+
+	monday := time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)
+	Analytics.Record("T1", "C1", "U1", "AAPL", monday.Add(-3*24*time.Hour+5*time.Hour))
+	Analytics.Record("T1", "C1", "U2", "AAPL", monday.Add(-3*24*time.Hour+5*time.Hour))
+	Analytics.Record("T1", "C2", "U1", "MSFT", monday.Add(-4*24*time.Hour))
+	Analytics.Record("T1", "C2", "U1", "TSLA", monday) // this week's, not last week's
+
+	ctx := WithSlack(context.Background(), NewSlack(ss.URL))
+	SendWeeklyReports(ctx, monday)
+	SendWeeklyReports(ctx, monday.Add(time.Hour))
+	want := "CREPORTS *Last week on slacker:* 3 lookups by 2 people in 2 channels\n" +
+		"1. *AAPL* (2 lookups)\n2. *MSFT* (1 lookups)\n" +
+		"Busiest channel: <#C1>. Busiest hour: 14:00 UTC."
+	if len(posted) != 1 || posted[0] != want {
+		t.Errorf("expected one report %q, got %q", want, posted)
+	}
+}
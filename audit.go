@@ -0,0 +1,354 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logic/slacker/slash"
+)
+
+// defaultAuditRetention is how many days of audit log we keep, unless
+// configured otherwise.
+const defaultAuditRetention = 90
+
+// auditDateFormat names each day's audit log file.
+const auditDateFormat = "2006-01-02"
+
+// AuditEntry is the record of one dispatched slash command.
+type AuditEntry struct {
+	Time        time.Time
+	RequestID   uint64
+	TeamID      string
+	TeamDomain  string `json:",omitempty"`
+	ChannelID   string
+	ChannelName string `json:",omitempty"`
+	UserID      string
+	UserName    string `json:",omitempty"`
+	Command     string
+	Text        string
+	// Outcome is "ok", "error" (the command failed, and was told so),
+	// "denied" (they weren't allowed to run it), "disabled" (an admin has
+	// turned it off) or "deferred" (the answer was still being worked on
+	// when we acknowledged the command).
+	Outcome   string
+	LatencyMS int64
+}
+
+// AuditLog is an append-only record of every slash command we dispatch,
+// kept as one file of JSON lines per day (UTC) in a directory. Files older
+// than the retention period are removed as new days begin.
+type AuditLog struct {
+	sync.Mutex
+	dir       string
+	retention int // days, or zero to follow the configuration
+	day       string
+}
+
+// NewAuditLog creates an audit log kept in dir, for retention days, or (if
+// retention is zero) for as many as the configuration says at the time. If
+// dir is empty, entries only go to the log.
+func NewAuditLog(dir string, retention int) *AuditLog {
+	return &AuditLog{dir: dir, retention: retention}
+}
+
+// Retention is how many days of audit log are kept.
+func (a *AuditLog) Retention() int {
+	if a.retention > 0 {
+		return a.retention
+	}
+	if days := Config().AuditRetentionDays; days > 0 {
+		return days
+	}
+	return defaultAuditRetention
+}
+
+func (a *AuditLog) file(day string) string {
+	return filepath.Join(a.dir, "audit-"+day+".log")
+}
+
+// Record appends an entry to the log, starting a new file (and removing
+// expired ones) if it's the first entry of the day.
+func (a *AuditLog) Record(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if a.dir == "" {
+		log.Printf("Audit: %s", line)
+		return nil
+	}
+	a.Lock()
+	defer a.Unlock()
+	day := entry.Time.UTC().Format(auditDateFormat)
+	if day != a.day {
+		if err := os.MkdirAll(a.dir, 0700); err != nil {
+			return err
+		}
+		if err := a.prune(entry.Time); err != nil {
+			log.Printf("Error pruning audit log: %s", err)
+		}
+		a.day = day
+	}
+	f, err := os.OpenFile(a.file(day), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the files of days that have passed out of the retention
+// period. The caller must hold the lock.
+func (a *AuditLog) prune(now time.Time) error {
+	oldest := now.UTC().AddDate(0, 0, -a.Retention()).Format(auditDateFormat)
+	for _, day := range a.days() {
+		if day < oldest {
+			if err := os.Remove(a.file(day)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// days lists the days we have audit log files for, oldest first.
+func (a *AuditLog) days() []string {
+	files, _ := ioutil.ReadDir(a.dir)
+	var days []string
+	for _, f := range files {
+		name := f.Name()
+		if strings.HasPrefix(name, "audit-") && strings.HasSuffix(name, ".log") {
+			days = append(days, strings.TrimSuffix(strings.TrimPrefix(name, "audit-"), ".log"))
+		}
+	}
+	sort.Strings(days)
+	return days
+}
+
+// AuditQuery selects audit log entries. Empty fields match everything.
+type AuditQuery struct {
+	UserID string
+	// Symbol matches commands that mention it, by name or alias.
+	Symbol string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// defaultAuditLimit is how many entries a query returns, unless it asks for
+// more or fewer.
+const defaultAuditLimit = 50
+
+// Matches reports whether an entry is one the query is looking for.
+func (q AuditQuery) Matches(entry AuditEntry) bool {
+	if q.UserID != "" && !strings.EqualFold(q.UserID, entry.UserID) {
+		return false
+	}
+	if !q.Since.IsZero() && entry.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !entry.Time.Before(q.Until) {
+		return false
+	}
+	if q.Symbol != "" {
+		symbol := ResolveSymbol(q.Symbol)
+		args, _ := slash.Tokenize(entry.Text)
+		for _, arg := range args {
+			if strings.EqualFold(ResolveSymbol(arg), symbol) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query returns the most recent entries that match q, newest first.
+func (a *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
+	if q.Limit <= 0 {
+		q.Limit = defaultAuditLimit
+	}
+	if a.dir == "" {
+		return nil, nil
+	}
+	a.Lock()
+	days := a.days()
+	a.Unlock()
+
+	var found []AuditEntry
+	for i := len(days) - 1; i >= 0 && len(found) < q.Limit; i-- {
+		// Skip whole days outside the range asked for.
+		if !q.Since.IsZero() && days[i] < q.Since.UTC().Format(auditDateFormat) {
+			break
+		}
+		if !q.Until.IsZero() && days[i] > q.Until.UTC().Format(auditDateFormat) {
+			continue
+		}
+		entries, err := a.readDay(days[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := len(entries) - 1; j >= 0 && len(found) < q.Limit; j-- {
+			if q.Matches(entries[j]) {
+				found = append(found, entries[j])
+			}
+		}
+	}
+	return found, nil
+}
+
+func (a *AuditLog) readDay(day string) ([]AuditEntry, error) {
+	f, err := os.Open(a.file(day))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn line from a crash shouldn't hide the rest.
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// auditOutcomeKey is where the outcome of a command is noted, for the audit
+// log, as it's dispatched.
+const auditOutcomeKey uint64 = 2
+
+type auditOutcome struct {
+	sync.Mutex
+	outcome string
+	// entry is the command being dispatched, so a deferred answer can be
+	// audited again once it's delivered.
+	entry AuditEntry
+}
+
+// withAuditOutcome attaches somewhere to note a command's outcome to a
+// context.
+func withAuditOutcome(ctx context.Context, entry AuditEntry) (context.Context, *auditOutcome) {
+	o := &auditOutcome{outcome: "ok", entry: entry}
+	return context.WithValue(ctx, auditOutcomeKey, o), o
+}
+
+// AuditDelivery records how a deferred answer turned out once it has been
+// delivered (or failed to be), along with how long it took since the
+// command was dispatched. The command was audited as "deferred" when it
+// was acknowledged.
+func AuditDelivery(ctx context.Context, outcome string) {
+	o, ok := ctx.Value(auditOutcomeKey).(*auditOutcome)
+	if !ok {
+		return
+	}
+	entry := o.entry
+	entry.Time = time.Now().UTC()
+	entry.Outcome = outcome
+	entry.LatencyMS = int64(entry.Time.Sub(o.entry.Time) / time.Millisecond)
+	if err := Audit.Record(entry); err != nil {
+		log.Printf("[%d] Error writing audit log: %s", RequestID(ctx), err)
+	}
+}
+
+// NoteOutcome records how a command turned out, if it's being audited.
+func NoteOutcome(ctx context.Context, outcome string) {
+	if o, ok := ctx.Value(auditOutcomeKey).(*auditOutcome); ok {
+		o.Lock()
+		o.outcome = outcome
+		o.Unlock()
+	}
+}
+
+func (o *auditOutcome) String() string {
+	o.Lock()
+	defer o.Unlock()
+	return o.outcome
+}
+
+// auditTimeError is the message for times ParseAuditTime can't make sense of.
+const auditTimeError = "'%s' is not a date (YYYY-MM-DD), time (RFC 3339) or duration (like 24h)"
+
+// ParseAuditTime understands the times an audit query can be given: an RFC
+// 3339 timestamp, a date (midnight UTC), or a duration ago, like "24h".
+func ParseAuditTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(auditDateFormat, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf(auditTimeError, s)
+}
+
+// AuditHandler answers queries of the audit log over HTTP, as JSON, for
+// requests bearing Config.AuditToken. It takes the parameters user, symbol,
+// since, until and limit.
+func AuditHandler(w http.ResponseWriter, req *http.Request) error {
+	if Config().AuditToken == "" {
+		return StatusError{http.StatusNotFound, errors.New("Audit queries are not enabled")}
+	}
+	auth := []byte(req.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(auth, []byte("Bearer "+Config().AuditToken)) != 1 {
+		return StatusError{http.StatusUnauthorized, errors.New("Audit token is missing or invalid")}
+	}
+	q := AuditQuery{
+		UserID: req.FormValue("user"),
+		Symbol: req.FormValue("symbol"),
+	}
+	now := time.Now()
+	var err error
+	if s := req.FormValue("since"); s != "" {
+		if q.Since, err = ParseAuditTime(s, now); err != nil {
+			return StatusError{http.StatusBadRequest, err}
+		}
+	}
+	if s := req.FormValue("until"); s != "" {
+		if q.Until, err = ParseAuditTime(s, now); err != nil {
+			return StatusError{http.StatusBadRequest, err}
+		}
+	}
+	if s := req.FormValue("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil || q.Limit <= 0 {
+			return StatusError{http.StatusBadRequest, errors.New("limit must be a positive number")}
+		}
+	}
+	entries, err := Audit.Query(q)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []AuditEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,172 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SetConfig(Configuration{})
+	audit := NewAuditLog(dir, 0)
+	if days := audit.Retention(); days != defaultAuditRetention {
+		t.Errorf("expected %d days by default, got %d", defaultAuditRetention, days)
+	}
+
+	// A reload that shortens the retention applies from the next day.
+	day := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	old := filepath.Join(dir, "audit-2026-09-01.log")
+	ioutil.WriteFile(old, []byte("{}\n"), 0600)
+	audit.Record(AuditEntry{Time: day, Command: "/ticker", Outcome: "ok"})
+	if _, err := os.Stat(old); err != nil {
+		t.Error("expected the audit log to be kept for 90 days")
+	}
+	changeTestConfig(func(c *Configuration) { c.AuditRetentionDays = 30 })
+	audit.Record(AuditEntry{Time: day.Add(24 * time.Hour), Command: "/ticker", Outcome: "ok"})
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the reloaded retention to remove the old audit log")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SetConfig(Configuration{})
+	audit := NewAuditLog(dir, 7)
+
+	// A file from long ago should be pruned on the first entry.
+	expired := filepath.Join(dir, "audit-2000-01-01.log")
+	ioutil.WriteFile(expired, []byte("{}\n"), 0600)
+
+	day := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	for _, e := range []AuditEntry{
+		{Time: day, UserID: "U1", Command: "/ticker", Text: "AAPL", Outcome: "ok"},
+		{Time: day.Add(time.Hour), UserID: "U2", Command: "/ticker", Text: "-period 5d spx", Outcome: "ok"},
+		{Time: day.Add(24 * time.Hour), UserID: "U1", Command: "/fx", Text: "100 USD EUR", Outcome: "error"},
+		{Time: day.Add(25 * time.Hour), UserID: "U1", Command: "/ticker", Text: "aapl", Outcome: "deferred"},
+	} {
+		if err := audit.Record(e); err != nil {
+			t.Fatal("Record failed:", err)
+		}
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Error("expected the expired audit log to be removed")
+	}
+
+	tests := []struct {
+		query    AuditQuery
+		outcomes []string
+	}{
+		{AuditQuery{}, []string{"deferred", "error", "ok", "ok"}},
+		{AuditQuery{Limit: 2}, []string{"deferred", "error"}},
+		{AuditQuery{UserID: "U1"}, []string{"deferred", "error", "ok"}},
+		{AuditQuery{Symbol: "AAPL"}, []string{"deferred", "ok"}},
+		{AuditQuery{Symbol: "^GSPC"}, []string{"ok"}},
+		{AuditQuery{Since: day.Add(24 * time.Hour)}, []string{"deferred", "error"}},
+		{AuditQuery{Until: day.Add(24 * time.Hour)}, []string{"ok", "ok"}},
+	}
+	for i, test := range tests {
+		entries, err := audit.Query(test.query)
+		if err != nil {
+			t.Fatal("Query failed:", err)
+		}
+		var outcomes []string
+		for _, e := range entries {
+			outcomes = append(outcomes, e.Outcome)
+		}
+		if strings.Join(outcomes, ",") != strings.Join(test.outcomes, ",") {
+			t.Errorf("%d. expected %v, got %v", i, test.outcomes, outcomes)
+		}
+	}
+}
+
+func TestParseAuditTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	for s, want := range map[string]time.Time{
+		"2026-10-01":           time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		"2026-10-01T08:00:00Z": time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+		"24h":                  now.Add(-24 * time.Hour),
+	} {
+		if got, err := ParseAuditTime(s, now); err != nil || !got.Equal(want) {
+			t.Errorf("%s: expected %s, got %s (%v)", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "yesterday", "-24h"} {
+		if _, err := ParseAuditTime(s, now); err == nil {
+			t.Errorf("expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestAuditDispatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SetConfig(Configuration{AuditToken: "t0ken"})
+	Audit = NewAuditLog(dir, 0)
+	defer func() { Audit = NewAuditLog("", 0) }()
+	SetCommands(SlashCommands{
+		"/ok": func(w http.ResponseWriter, req *http.Request) error { return nil },
+		"/fail": func(w http.ResponseWriter, req *http.Request) error {
+			return Respond(w, req, "ephemeral", func() (map[string]interface{}, error) {
+				return nil, errors.New("boom")
+			})
+		},
+	})
+	for _, command := range []string{"/ok", "/fail"} {
+		form := url.Values{"command": {command}, "text": {"AAPL"}, "user_id": {"U1"}, "channel_id": {"C1"}}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err := SlackDispatcher(httptest.NewRecorder(), req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("SlackDispatcher failed:", err)
+		}
+	}
+
+	query := func(token, params string) (*httptest.ResponseRecorder, []AuditEntry) {
+		req := httptest.NewRequest("GET", "/audit?"+params, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		ErrorHandler(AuditHandler).ServeHTTP(w, req.WithContext(NewContext(req.Context(), req)))
+		var entries []AuditEntry
+		json.Unmarshal(w.Body.Bytes(), &entries)
+		return w, entries
+	}
+	if w, _ := query("", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized query to be refused, got %d", w.Code)
+	}
+	if w, _ := query("t0ken", "since=whenever"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a bad time to be refused, got %d", w.Code)
+	}
+	_, entries := query("t0ken", "user=U1&symbol=aapl&since=1h")
+	if len(entries) != 2 || entries[0].Command != "/fail" || entries[0].Outcome != "error" ||
+		entries[1].Outcome != "ok" || entries[1].ChannelID != "C1" {
+		t.Errorf("unexpected audit entries %+v", entries)
+	}
+	if _, entries := query("t0ken", "user=U2"); len(entries) != 0 {
+		t.Errorf("expected no entries for U2, got %+v", entries)
+	}
+}
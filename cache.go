@@ -0,0 +1,78 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache is a concurrency-safe in-memory map whose entries expire a fixed
+// time after they were stored.
+type Cache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]cacheEntry
+	hits    uint64
+	misses  uint64
+}
+
+// NewCache creates an empty cache whose entries live for ttl.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Get returns the value stored under key, if it hasn't expired yet.
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		if ok {
+			delete(c.entries, key)
+		}
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	return entry.value, true
+}
+
+// Set stores a value under key, replacing anything already there.
+func (c *Cache) Set(key string, value interface{}) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = cacheEntry{value, time.Now().Add(c.ttl)}
+}
+
+// SetFor stores a value under key for ttl, rather than the cache's usual
+// lifetime.
+func (c *Cache) SetFor(key string, value interface{}, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+	c.entries[key] = cacheEntry{value, time.Now().Add(ttl)}
+}
+
+// CacheStats are the counters a Cache keeps about itself.
+type CacheStats struct {
+	Entries int
+	Hits    uint64
+	Misses  uint64
+}
+
+// Stats returns the current size and hit rate of the cache.
+func (c *Cache) Stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+	return CacheStats{len(c.entries), c.hits, c.misses}
+}
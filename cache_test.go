@@ -0,0 +1,33 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache(time.Hour)
+	if _, ok := c.Get("a"); ok {
+		t.Error("found a value in an empty cache")
+	}
+	c.Set("a", 1)
+	if v, ok := c.Get("a"); !ok || v.(int) != 1 {
+		t.Errorf("expected 1, got %v", v)
+	}
+	if stats := c.Stats(); stats != (CacheStats{1, 1, 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	c = NewCache(-time.Second)
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Error("found an expired value")
+	}
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Errorf("expired value still cached: %+v", stats)
+	}
+}
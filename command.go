@@ -0,0 +1,54 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/logic/slacker/slash"
+)
+
+// CommandHandler adapts a command into a handler for SlackDispatcher,
+// answering via Respond. Problems with the command line are explained
+// privately to whoever typed it, as is the answer if they ask for it with
+// -private.
+func CommandHandler(c *slash.Command) ErrorHandler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return Respond(w, req, c.Response, func() (map[string]interface{}, error) {
+			l := LocaleFor(req.FormValue("team_id"), req.FormValue("user_id"))
+			args, err := slash.Tokenize(req.FormValue("text"))
+			if err != nil {
+				err = c.UsageError(c.Name, l.T(err.Error()), l)
+			}
+			var inv *slash.Invocation
+			if err == nil {
+				inv, err = c.Parse(args, l)
+			}
+			if err != nil {
+				return map[string]interface{}{
+					"response_type": "ephemeral",
+					"text":          err.Error(),
+				}, nil
+			}
+			inv.Request = req
+			payload, err := inv.Command.Run(inv)
+			if payload != nil && inv.Bool("private") {
+				payload["response_type"] = visibilityEphemeral
+			} else if _, ok := payload["response_type"]; payload != nil && !ok && inv.Command.Response != "" {
+				payload["response_type"] = inv.Command.Response
+			}
+			return payload, err
+		})
+	}
+}
+
+// localeOf is the locale an invocation is answered in, with everything we
+// know how to format in it.
+func localeOf(inv *slash.Invocation) *Locale {
+	if l, ok := inv.Locale.(*Locale); ok {
+		return l
+	}
+	return English
+}
@@ -0,0 +1,62 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/logic/slacker/slash"
+)
+
+func testCommand() *slash.Command {
+	run := func(inv *slash.Invocation) (map[string]interface{}, error) {
+		return map[string]interface{}{"text": inv.Path + " " + strings.Join(inv.Args, ",")}, nil
+	}
+	return &slash.Command{
+		Name:     "/test",
+		Help:     "Test things.",
+		Response: "in_channel",
+		Subcommands: []*slash.Command{
+			{
+				Name: "alert",
+				Subcommands: []*slash.Command{
+					{Name: "add", Args: "symbol price", Response: "ephemeral", Run: run},
+				},
+			},
+			{Name: "list", Help: "List things.", Run: run},
+		},
+	}
+}
+
+func TestCommandHandler(t *testing.T) {
+	c := testCommand()
+	call := func(text string) map[string]interface{} {
+		form := url.Values{"text": {text}}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := CommandHandler(c)(w, req); err != nil {
+			t.Fatal("Handler failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return payload
+	}
+
+	if p := call("list  a 'b c'"); p["response_type"] != "in_channel" || p["text"] != "/test list a,b c" {
+		t.Errorf("unexpected response %v", p)
+	}
+	if p := call("alert add X 1"); p["response_type"] != "ephemeral" {
+		t.Errorf("expected an ephemeral response, got %v", p)
+	}
+	if p := call(`list "oops`); p["response_type"] != "ephemeral" ||
+		!strings.Contains(p["text"].(string), "unterminated quote") {
+		t.Errorf("expected a private error, got %v", p)
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"regexp"
 	"strings"
+	"text/template"
 	"time"
 )
 
@@ -27,22 +30,103 @@ func (t *Tokens) Set(v string) error {
 	return nil
 }
 
-// Configuration represents the fields of a TOML configuration file.
+// Configuration represents the fields of a TOML configuration file. Fields
+// tagged `config:"show"` are shown by /slacker config; the rest are redacted.
 type Configuration struct {
-	File              string
-	Tokens            Tokens
-	ListenAddress     string
-	AsyncResponse     bool
-	HTTPClientTimeout time.Duration
+	File               string `config:"show"`
+	Tokens             Tokens
+	ListenAddress      string         `config:"show"`
+	AsyncResponse      bool           `config:"show"`
+	HTTPClientTimeout  time.Duration  `config:"show"`
+	HTTPTimeouts       map[string]int `config:"show"`
+	HTTPProxy          string
+	CABundle           string `config:"show"`
+	DataDir            string `config:"show"`
+	SigningSecret      string
+	ClientID           string `config:"show"`
+	ClientSecret       string
+	OAuthRedirectURL   string            `config:"show"`
+	OAuthScopes        string            `config:"show"`
+	CryptoCurrency     string            `config:"show"`
+	Aliases            map[string]string `config:"show"`
+	PaperStartingCash  float64           `config:"show"`
+	PaperRejectDelayed bool              `config:"show"`
+	UnfurlPatterns     map[string]string `config:"show"`
+	Visibility         VisibilityConfig  `config:"show"`
+	DisabledCommands   []string          `config:"show"`
+	CommandAliases     map[string]string `config:"show"`
+	CommandSettings    map[string]toml.Primitive
+	Webhooks           map[string]WebhookConfig     `config:"show"`
+	Templates          map[string]string            `config:"show"`
+	WorkspaceTemplates map[string]map[string]string `config:"show"`
+	Locale             string                       `config:"show"`
+	WorkspaceLocales   map[string]string            `config:"show"`
+	Admins             []string                     `config:"show"`
+	AuditRetentionDays int                          `config:"show"`
+	AuditToken         string
+	AnalyticsOptOut    []string          `config:"show"`
+	AnalyticsReports   map[string]string `config:"show"`
+
+	meta            toml.MetaData
+	unfurlPatterns  map[string]*regexp.Regexp
+	tickerTemplates map[string]*template.Template
+	transport       http.RoundTripper
+}
+
+// DecodeCommandSettings decodes a command's section of the configuration
+// file, if it has one, into v.
+func (c *Configuration) DecodeCommandSettings(name string, v interface{}) error {
+	settings, ok := c.CommandSettings[name]
+	if !ok {
+		return nil
+	}
+	if err := c.meta.PrimitiveDecode(settings, v); err != nil {
+		return fmt.Errorf("Settings for /%s: %s", name, err)
+	}
+	return nil
 }
 
 // LoadConfig sets our configuration defaults, and loads a configuration from
 // the TOML-formatted configuration file over the defaults.
 func LoadConfig(config *Configuration, configStream io.Reader) error {
-	_, err := toml.DecodeReader(configStream, &config)
+	meta, err := toml.DecodeReader(configStream, &config)
+	config.meta = meta
 
 	// Normalize timeout to seconds, because toml lacks duration support
 	config.HTTPClientTimeout = config.HTTPClientTimeout * time.Second
+	// Aliases are matched case-insensitively
+	aliases := map[string]string{}
+	for name, symbol := range config.Aliases {
+		aliases[strings.ToLower(name)] = symbol
+	}
+	config.Aliases = aliases
+	// Unfurl patterns are checked now, rather than on the first link
+	if err == nil {
+		config.unfurlPatterns, err = CompileUnfurlPatterns(config.UnfurlPatterns)
+	}
+	if err == nil {
+		err = config.Visibility.Validate()
+	}
+	if err == nil {
+		err = CompileTemplates(config)
+	}
+	if err == nil {
+		err = ValidateLocales(config)
+	}
+	if err == nil {
+		err = ValidateHTTPTimeouts(config)
+	}
+	if err == nil {
+		config.transport, err = NewTransport(config.HTTPProxy, config.CABundle)
+	}
+	if err == nil && config.AuditRetentionDays < 0 {
+		err = fmt.Errorf("AuditRetentionDays must be zero (for %d) or more", defaultAuditRetention)
+	}
+	for name, hook := range config.Webhooks {
+		if err == nil {
+			err = hook.Validate(name)
+		}
+	}
 	log.Println("Configuration loaded:")
 	if len(config.Tokens) > 0 {
 		log.Printf("  Tokens: [<hidden>%s]\n",
@@ -57,6 +141,62 @@ func LoadConfig(config *Configuration, configStream io.Reader) error {
 		log.Println("  Sending responses immediately")
 	}
 	log.Printf("  HTTP connections time out in %v\n", config.HTTPClientTimeout)
+	for destination, seconds := range config.HTTPTimeouts {
+		log.Printf("  HTTP connections to %s time out in %ds\n", destination, seconds)
+	}
+	if config.HTTPProxy != "" {
+		log.Printf("  Making HTTP requests through %s\n", redactedProxy(config.HTTPProxy))
+	}
+	if config.CABundle != "" {
+		log.Printf("  Trusting the certificates in %s\n", config.CABundle)
+	}
+	if config.DataDir != "" {
+		log.Printf("  Keeping state in %s\n", config.DataDir)
+	} else {
+		log.Println("  No data directory (state is not persisted)")
+	}
+	if config.SigningSecret != "" {
+		log.Println("  Verifying request signatures")
+	} else {
+		log.Println("  No signing secret (not accepting events or interactions)")
+	}
+	if len(config.Aliases) > 0 {
+		log.Printf("  %d symbol aliases defined\n", len(config.Aliases))
+	}
+	if len(config.UnfurlPatterns) > 0 {
+		log.Printf("  %d unfurl patterns defined\n", len(config.UnfurlPatterns))
+	}
+	if config.Locale != "" {
+		log.Printf("  Answering in %s by default\n", config.Locale)
+	}
+	if len(config.Webhooks) > 0 {
+		log.Printf("  %d webhook commands defined\n", len(config.Webhooks))
+	}
+	if len(config.DisabledCommands) > 0 {
+		log.Printf("  Disabled commands: %s\n", strings.Join(config.DisabledCommands, ", "))
+	}
+	if len(config.Visibility.PublicChannels) > 0 {
+		log.Printf("  Only answering publicly in %d channels\n",
+			len(config.Visibility.PublicChannels))
+	}
+	if config.ClientID != "" && config.ClientSecret != "" {
+		log.Printf("  OAuth installation enabled (scopes: %s)\n",
+			config.OAuthScopes)
+	}
+	if len(config.Admins) > 0 && len(config.Tokens) == 0 && config.SigningSecret == "" {
+		log.Printf("  %d admins (ignored without Tokens or a SigningSecret)\n", len(config.Admins))
+	} else if len(config.Admins) > 0 {
+		log.Printf("  %d admins\n", len(config.Admins))
+	}
+	if config.AuditToken != "" {
+		log.Println("  Audit log queries enabled")
+	}
+	if len(config.AnalyticsOptOut) > 0 {
+		log.Printf("  Not counting lookups in %d workspaces\n", len(config.AnalyticsOptOut))
+	}
+	if len(config.AnalyticsReports) > 0 {
+		log.Printf("  Sending weekly reports to %d workspaces\n", len(config.AnalyticsReports))
+	}
 
 	return err
 }
@@ -10,6 +10,23 @@ import (
 	"time"
 )
 
+// loadTestConfig publishes the configuration in text, failing the test if
+// it doesn't load.
+func loadTestConfig(t *testing.T, text string) {
+	var c Configuration
+	if err := LoadConfig(&c, strings.NewReader(text)); err != nil {
+		t.Fatal("Error parsing TOML configuration:", err)
+	}
+	SetConfig(c)
+}
+
+// changeTestConfig publishes a changed copy of the configuration.
+func changeTestConfig(change func(c *Configuration)) {
+	c := *Config()
+	change(&c)
+	SetConfig(c)
+}
+
 func TestTokens(t *testing.T) {
 	var tk Tokens
 	if tk.String() != "[]" {
@@ -55,3 +72,13 @@ func TestConfigHTTPClientTimeout(t *testing.T) {
 		t.Errorf("Timeout incorrectly converted: 10 -> %d", c.HTTPClientTimeout)
 	}
 }
+
+func TestConfigAliases(t *testing.T) {
+	var c Configuration
+	if err := LoadConfig(&c, strings.NewReader("[Aliases]\nSPX = \"^GSPC\"\n")); err != nil {
+		t.Error("Error parsing TOML configuration:", err)
+	}
+	if c.Aliases["spx"] != "^GSPC" {
+		t.Errorf("Alias not normalized: %v", c.Aliases)
+	}
+}
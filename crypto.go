@@ -0,0 +1,80 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/logic/slacker/slash"
+)
+
+// CryptoCommand is the "/crypto" Slack slash command. It shares everything
+// but its flags with /ticker.
+var CryptoCommand = &slash.Command{
+	Name:     "/crypto",
+	Args:     "coin",
+	Help:     "Look up a cryptocurrency.",
+	Response: "in_channel",
+	Flags: []slash.Flag{
+		{Name: "in", Default: "", Usage: "`currency` to quote the coin in [ISO 4217 code]"},
+		{Name: "period", Default: "1d", Usage: "chart `period` [xd|xY]"},
+		{Name: "interval", Default: 60, Usage: "chart interval in `seconds`"},
+	},
+	Run: tickerRunner(cryptoOpts),
+}
+
+func init() {
+	slash.RegisterCommand(CryptoCommand)
+}
+
+// ParseCryptoCommand takes the /crypto command line and parses it into
+// TickerOpts, returning an error if anything goes wrong. Bare coin names
+// like "btc" are quoted in the configured default currency.
+func ParseCryptoCommand(cmd string) (TickerOpts, error) {
+	args, err := slash.Tokenize(cmd)
+	if err != nil {
+		return TickerOpts{}, CryptoCommand.UsageError(CryptoCommand.Name, err.Error(), English)
+	}
+	inv, err := CryptoCommand.Parse(args, English)
+	if err != nil {
+		return TickerOpts{}, err
+	}
+	return cryptoOpts(inv)
+}
+
+func cryptoOpts(inv *slash.Invocation) (TickerOpts, error) {
+	opts := TickerOpts{
+		Period:   inv.String("period"),
+		Interval: inv.Int("interval"),
+	}
+	if len(inv.Args) != 1 {
+		if len(inv.Args) == 0 {
+			return opts, inv.Errorf("no coin specified")
+		}
+		return opts, inv.Errorf("only one coin at a time")
+	}
+
+	in := strings.ToUpper(inv.String("in"))
+	if in == "" {
+		in = strings.ToUpper(Config().CryptoCurrency)
+	}
+	if in == "" {
+		in = "USD"
+	}
+	if !currencyCodeRegexp.MatchString(in) {
+		return opts, inv.Errorf("currencies are three-letter codes, like USD or EUR")
+	}
+
+	opts.Symbol = strings.ToUpper(inv.Args[0])
+	if !strings.Contains(opts.Symbol, "-") {
+		opts.Symbol = opts.Symbol + "-" + in
+	}
+	if SymbolQuoteType(opts.Symbol) != "CRYPTOCURRENCY" {
+		return opts, errors.New(inv.Locale.Tf("*Error:* %s",
+			inv.Locale.T("Invalid coin (like BTC, ETH or BTC-EUR)")))
+	}
+	return opts, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCryptoCommand(t *testing.T) {
+	SetConfig(Configuration{CryptoCurrency: "USD"})
+	tests := []struct {
+		input  string
+		valid  bool
+		symbol string
+	}{
+		{"", false, ""},
+		{"btc", true, "BTC-USD"},
+		{"-in eur eth", true, "ETH-EUR"},
+		{"btc-gbp", true, "BTC-GBP"},
+		{"-in euros btc", false, ""},
+		{"btc eth", false, ""},
+		{"b$c", false, ""},
+	}
+	for i, test := range tests {
+		opts, err := ParseCryptoCommand(test.input)
+		if test.valid && err != nil {
+			t.Errorf("%d. expected input to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected input to be invalid", i)
+		} else if test.valid && opts.Symbol != test.symbol {
+			t.Errorf("%d. expected %s, got %s", i, test.symbol, opts.Symbol)
+		}
+	}
+}
+
+func TestQuoteFieldsCrypto(t *testing.T) {
+	quote := APIResult{
+		QuoteType:           "CRYPTOCURRENCY",
+		Currency:            "USD",
+		FromCurrency:        "BTC",
+		RegularMarketChange: -120.5,
+		Volume24Hr:          38419382272,
+		CirculatingSupply:   18569618,
+	}
+	fields := QuoteFields(quote, English)
+	expected := []string{"-$120.50", "$38.4B", "18.6M BTC"}
+	if len(fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %d", len(expected), len(fields))
+	}
+	for i, value := range expected {
+		if fields[i]["value"] != value {
+			t.Errorf("%d. expected %s, got %s", i, value, fields[i]["value"])
+		}
+	}
+	if fields := QuoteFields(APIResult{QuoteType: "EQUITY"}, English); len(fields) != 0 {
+		t.Errorf("expected no crypto fields for equities, got %v", fields)
+	}
+}
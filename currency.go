@@ -0,0 +1,131 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// currencySymbols are the ISO 4217 codes we know a prefix symbol for. Any
+// other currency is rendered with its code after the amount.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"INR": "₹",
+	"KRW": "₩",
+	"AUD": "A$",
+	"CAD": "CA$",
+	"HKD": "HK$",
+	"NZD": "NZ$",
+	"SGD": "S$",
+	"BRL": "R$",
+	"ILS": "₪",
+	"RUB": "₽",
+	"TRY": "₺",
+	"BTC": "₿",
+}
+
+// currencyDecimals overrides the usual two decimal places for currencies
+// without minor units.
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// minorCurrencies are the sub-unit codes some exchanges quote in (the London
+// Stock Exchange quotes in pence, for example), and the currency and divisor
+// they normalize to.
+var minorCurrencies = map[string]struct {
+	Code    string
+	Divisor float64
+}{
+	"GBp": {"GBP", 100},
+	"GBX": {"GBP", 100},
+	"ZAc": {"ZAR", 100},
+	"ILA": {"ILS", 100},
+}
+
+// NormalizeCurrency converts an amount quoted in a minor currency unit into
+// its major unit, returning the amount and the ISO 4217 code it is now in.
+func NormalizeCurrency(amount float64, code string) (float64, string) {
+	if minor, ok := minorCurrencies[code]; ok {
+		return amount / minor.Divisor, minor.Code
+	}
+	return amount, strings.ToUpper(code)
+}
+
+// FormatMoney renders an amount with the appropriate currency symbol. An
+// empty currency code is assumed to be US dollars, which is what Yahoo
+// Finance quotes most things in.
+func FormatMoney(amount float64, code string) string {
+	return English.Money(amount, code)
+}
+
+// HumanizeNumber abbreviates a large number to a few significant digits
+// with a magnitude suffix, like 1.6B or 739M.
+func HumanizeNumber(v float64) string {
+	return English.Humanize(v)
+}
+
+// FXSymbol returns the Yahoo Finance symbol for a currency pair.
+func FXSymbol(from, to string) string {
+	return fmt.Sprintf("%s%s=X", from, to)
+}
+
+// GetFXRate looks up how many units of one currency a single unit of another
+// is worth.
+func (y *Yahoo) GetFXRate(from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	quotes, err := y.GetTickers([]string{FXSymbol(from, to)})
+	if err != nil {
+		return 0, err
+	}
+	if len(quotes) == 0 || quotes[0].RegularMarketPrice == 0 {
+		return 0, fmt.Errorf("No exchange rate available for %s to %s",
+			from, to)
+	}
+	return quotes[0].RegularMarketPrice, nil
+}
+
+// GetFXRates is GetFXRate for several currencies at once, looked up in a
+// single batched quote lookup. The rates are keyed by the currency they
+// convert from.
+func (y *Yahoo) GetFXRates(from []string, to string) (map[string]float64, error) {
+	rates := map[string]float64{to: 1}
+	var symbols []string
+	for _, currency := range from {
+		if _, ok := rates[currency]; !ok {
+			rates[currency] = 0
+			symbols = append(symbols, FXSymbol(currency, to))
+		}
+	}
+	if len(symbols) == 0 {
+		return rates, nil
+	}
+	quotes, err := y.GetTickers(symbols)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range quotes {
+		for currency := range rates {
+			if q.Symbol == FXSymbol(currency, to) {
+				rates[currency] = q.RegularMarketPrice
+			}
+		}
+	}
+	for currency, rate := range rates {
+		if rate == 0 {
+			return nil, fmt.Errorf("No exchange rate available for %s to %s",
+				currency, to)
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFormatMoney(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		currency string
+		output   string
+	}{
+		{12.5, "", "$12.50"},
+		{12.5, "USD", "$12.50"},
+		{-3.255, "EUR", "-€3.25"},
+		{2450, "GBp", "£24.50"},
+		{2450, "JPY", "¥2450"},
+		{99.9, "CHF", "99.90 CHF"},
+	}
+	for i, test := range tests {
+		if out := FormatMoney(test.amount, test.currency); out != test.output {
+			t.Errorf("%d. expected %s, got %s", i, test.output, out)
+		}
+	}
+}
+
+func TestGetFXRate(t *testing.T) {
+	fxHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("symbols") != "USDEUR=X" {
+			fmt.Fprint(w, "{\"quoteResponse\":{\"result\":[]}}")
+			return
+		}
+		fmt.Fprint(w, "{\"quoteResponse\":{\"result\":[{\"symbol\":\"USDEUR=X\",\"regularMarketPrice\":0.5}]}}")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(fxHandler))
+	defer ts.Close()
+	yahoo := NewYahoo(ts.URL)
+
+	if rate, err := yahoo.GetFXRate("USD", "USD"); err != nil || rate != 1 {
+		t.Errorf("expected identity rate, got %f (%v)", rate, err)
+	}
+	if rate, err := yahoo.GetFXRate("USD", "EUR"); err != nil || rate != 0.5 {
+		t.Errorf("expected 0.5, got %f (%v)", rate, err)
+	}
+	if _, err := yahoo.GetFXRate("USD", "XXX"); err == nil {
+		t.Error("GetFXRate didn't catch unknown currency pair")
+	}
+}
+
+func TestGetFXRates(t *testing.T) {
+	var requests []string
+	fxHandler := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.FormValue("symbols"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"quoteResponse":{"result":[{"symbol":"EURUSD=X","regularMarketPrice":2},{"symbol":"GBPUSD=X","regularMarketPrice":3}]}}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(fxHandler))
+	defer ts.Close()
+	yahoo := NewYahoo(ts.URL)
+
+	rates, err := yahoo.GetFXRates([]string{"EUR", "USD", "GBP", "EUR"}, "USD")
+	if err != nil || rates["EUR"] != 2 || rates["GBP"] != 3 || rates["USD"] != 1 {
+		t.Errorf("unexpected rates %v (%v)", rates, err)
+	}
+	if len(requests) != 1 || requests[0] != "EURUSD=X,GBPUSD=X" {
+		t.Errorf("expected one lookup of both pairs, got %q", requests)
+	}
+	if _, err := yahoo.GetFXRates([]string{"XXX"}, "USD"); err == nil {
+		t.Error("GetFXRates didn't catch unknown currency pair")
+	}
+	requests = nil
+	if _, err := yahoo.GetFXRates([]string{"USD"}, "USD"); err != nil || len(requests) != 0 {
+		t.Errorf("expected no lookup for the identity rate, got %q (%v)", requests, err)
+	}
+}
+
+func TestHumanizeNumber(t *testing.T) {
+	tests := []struct {
+		value  float64
+		output string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1500, "1.5K"},
+		{739644032, "740M"},
+		{1647187251, "1.6B"},
+		{-2.5e12, "-2.5T"},
+	}
+	for i, test := range tests {
+		if out := HumanizeNumber(test.value); out != test.output {
+			t.Errorf("%d. expected %s, got %s", i, test.output, out)
+		}
+	}
+}
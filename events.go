@@ -0,0 +1,134 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// EventEnvelope is the outer wrapper of an Events API callback.
+type EventEnvelope struct {
+	Token     string          `json:"token"`
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge,omitempty"`
+	TeamID    string          `json:"team_id"`
+	APIAppID  string          `json:"api_app_id"`
+	EventID   string          `json:"event_id"`
+	EventTime int64           `json:"event_time"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// EventHandler processes a single Events API event. The raw event is left
+// in the envelope for the handler to decode into whatever it needs.
+type EventHandler func(ctx context.Context, env EventEnvelope) error
+
+// EventHandlers are the Events API event types that we recognize, and their
+// handlers.
+var EventHandlers = map[string]EventHandler{
+	"app_home_opened": AppHomeOpened,
+	"app_uninstalled": AppUninstalled,
+	"link_shared":     LinkShared,
+	"tokens_revoked":  TokensRevoked,
+}
+
+// EventDispatcher validates Events API callbacks, answers URL verification
+// challenges, and routes events to an appropriate handler.
+func EventDispatcher(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return StatusError{http.StatusBadRequest,
+			errors.New("Only POST is supported")}
+	}
+	if err := VerifySlackSignature(req); err != nil {
+		return StatusError{http.StatusUnauthorized, err}
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return StatusError{http.StatusBadRequest, err}
+	}
+	var env EventEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return StatusError{http.StatusBadRequest,
+			fmt.Errorf("Could not decode event: %s", err)}
+	}
+
+	switch env.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, env.Challenge)
+		return nil
+	case "event_callback":
+		break
+	default:
+		return StatusError{http.StatusBadRequest,
+			fmt.Errorf("Event envelope type '%s' is invalid", env.Type)}
+	}
+
+	var event struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(env.Event, &event); err != nil {
+		return StatusError{http.StatusBadRequest,
+			fmt.Errorf("Could not decode event: %s", err)}
+	}
+	rid := RequestID(req.Context())
+	handler, ok := EventHandlers[event.Type]
+	if !ok {
+		log.Printf("[%d] Ignoring %s event from %s", rid, event.Type,
+			env.TeamID)
+		return nil
+	}
+	log.Printf("[%d] %s event from %s", rid, event.Type, env.TeamID)
+
+	// Slack wants an answer within three seconds, and will retry if it
+	// doesn't get one, so acknowledge now and do the work afterwards.
+	ctx := context.WithValue(context.Background(), requestIDKey, rid)
+	ctx = WithYahoo(ctx, YahooFromContext(req.Context()))
+	if inst, ok := Installations.Get(env.TeamID); ok {
+		ctx = WithInstallation(ctx, inst)
+	}
+	go func() {
+		if err := handler(ctx, env); err != nil {
+			log.Printf("[%d] %s event failed: %s", rid, event.Type, err)
+		}
+	}()
+	return nil
+}
+
+// AppUninstalled forgets a workspace once the app has been removed from it.
+func AppUninstalled(ctx context.Context, env EventEnvelope) error {
+	if err := Installations.Delete(env.TeamID); err != nil {
+		return err
+	}
+	log.Printf("[%d] Uninstalled from %s", RequestID(ctx), env.TeamID)
+	return nil
+}
+
+// TokensRevoked forgets a workspace if its bot token has been revoked.
+func TokensRevoked(ctx context.Context, env EventEnvelope) error {
+	var event struct {
+		Tokens struct {
+			Bot []string `json:"bot"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(env.Event, &event); err != nil {
+		return err
+	}
+	inst, ok := Installations.Get(env.TeamID)
+	if !ok {
+		return nil
+	}
+	for _, id := range event.Tokens.Bot {
+		if id == inst.BotUserID {
+			return AppUninstalled(ctx, env)
+		}
+	}
+	return nil
+}
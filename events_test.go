@@ -0,0 +1,86 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEventDispatcherChallenge(t *testing.T) {
+	SetConfig(Configuration{})
+	body := `{"type":"url_verification","challenge":"abc123"}`
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	if err := EventDispatcher(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+		t.Fatal("EventDispatcher failed:", err)
+	}
+	if w.Body.String() != "abc123" {
+		t.Errorf("expected challenge abc123, got `%s`", w.Body.String())
+	}
+}
+
+func TestEventDispatcherInvalid(t *testing.T) {
+	SetConfig(Configuration{})
+	for _, body := range []string{"", "{", `{"type":"bogus"}`} {
+		req := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		if err := EventDispatcher(w, req.WithContext(NewContext(req.Context(), req))); err == nil {
+			t.Errorf("EventDispatcher accepted `%s`", body)
+		}
+	}
+}
+
+func TestAppUninstalled(t *testing.T) {
+	Installations = NewInstallationStore("")
+	Installations.Save(Installation{TeamID: "T1", BotUserID: "B1"})
+	Installations.Save(Installation{TeamID: "T2", BotUserID: "B2"})
+	ctx := context.WithValue(context.Background(), requestIDKey, uint64(0))
+
+	if err := AppUninstalled(ctx, EventEnvelope{TeamID: "T1"}); err != nil {
+		t.Error("AppUninstalled failed:", err)
+	}
+	if _, ok := Installations.Get("T1"); ok {
+		t.Error("T1 still installed")
+	}
+
+	env := EventEnvelope{TeamID: "T2",
+		Event: json.RawMessage(`{"type":"tokens_revoked","tokens":{"bot":["B9"]}}`)}
+	if err := TokensRevoked(ctx, env); err != nil {
+		t.Error("TokensRevoked failed:", err)
+	}
+	if _, ok := Installations.Get("T2"); !ok {
+		t.Error("T2 uninstalled for somebody else's token")
+	}
+	env.Event = json.RawMessage(`{"type":"tokens_revoked","tokens":{"bot":["B2"]}}`)
+	if err := TokensRevoked(ctx, env); err != nil {
+		t.Error("TokensRevoked failed:", err)
+	}
+	if _, ok := Installations.Get("T2"); ok {
+		t.Error("T2 still installed after its token was revoked")
+	}
+}
+
+func TestSignedOnly(t *testing.T) {
+	handler := SignedOnly(EventDispatcher)
+	body := `{"type":"url_verification","challenge":"abc123"}`
+	req := httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	SetConfig(Configuration{})
+	err := handler(httptest.NewRecorder(), req.WithContext(NewContext(req.Context(), req)))
+	if se, ok := err.(StatusError); !ok || se.Status() != http.StatusNotFound {
+		t.Errorf("expected events to be refused without a signing secret, got %v", err)
+	}
+
+	SetConfig(Configuration{SigningSecret: "shh"})
+	req = httptest.NewRequest("POST", "/events", strings.NewReader(body))
+	err = handler(httptest.NewRecorder(), req.WithContext(NewContext(req.Context(), req)))
+	if se, ok := err.(StatusError); !ok || se.Status() != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned event to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// FundamentalsAttachment renders the valuation, earnings and trading data
+// for a quote as a Slack attachment, for /ticker -detail.
+func FundamentalsAttachment(quote APIResult, l *Locale, now time.Time) map[string]interface{} {
+	fields := FundamentalFields(quote, l, now)
+	if len(fields) == 0 {
+		return map[string]interface{}{
+			"fallback":  l.T("No fundamentals available"),
+			"text":      l.T("_No fundamentals available for this symbol._"),
+			"mrkdwn_in": []string{"text"},
+		}
+	}
+	var fallback string
+	for _, f := range fields {
+		fallback += fmt.Sprintf("%s: %s; ", f["title"], f["value"])
+	}
+	return map[string]interface{}{
+		"fallback": fallback,
+		"title":    l.T("Fundamentals"),
+		"fields":   fields,
+	}
+}
+
+// FundamentalFields returns attachment fields for every fundamental we have
+// a value for; most are missing for anything that isn't a stock. Anything
+// the quote itself already shows (see QuoteFields) is left out.
+func FundamentalFields(quote APIResult, l *Locale, now time.Time) []map[string]interface{} {
+	shown := map[interface{}]bool{}
+	for _, f := range QuoteFields(quote, l) {
+		shown[f["title"]] = true
+	}
+	var fields []map[string]interface{}
+	field := func(title, value string) {
+		title = l.T(title)
+		if shown[title] {
+			return
+		}
+		fields = append(fields, map[string]interface{}{
+			"title": title,
+			"value": value,
+			"short": true,
+		})
+	}
+	money := func(v float64) string {
+		return l.Money(v, quote.Currency)
+	}
+
+	if quote.MarketCap != 0 {
+		field("Market Cap", l.HumanizeMoney(float64(quote.MarketCap), quote.Currency))
+	}
+	if quote.SharesOutstanding != 0 {
+		field("Shares Outstanding", l.Humanize(float64(quote.SharesOutstanding)))
+	}
+	if quote.TrailingPE != 0 {
+		field("P/E (TTM)", l.Number(quote.TrailingPE, 2))
+	}
+	if quote.ForwardPE != 0 {
+		field("Forward P/E", l.Number(quote.ForwardPE, 2))
+	}
+	if quote.EpsTrailingTwelveMonths != 0 {
+		field("EPS (TTM)", money(quote.EpsTrailingTwelveMonths))
+	}
+	if quote.EpsForward != 0 {
+		field("Forward EPS", money(quote.EpsForward))
+	}
+	if quote.PriceToBook != 0 {
+		field("Price/Book", l.Number(quote.PriceToBook, 2))
+	}
+	if earnings := EarningsDate(quote, l, now); earnings != "" {
+		field("Earnings", earnings)
+	}
+	if quote.FiftyTwoWeekLow != 0 || quote.FiftyTwoWeekHigh != 0 {
+		field("52-Week Range", l.Tf("%s - %s (%s from high)",
+			money(quote.FiftyTwoWeekLow), money(quote.FiftyTwoWeekHigh),
+			l.SignedPercent(quote.FiftyTwoWeekHighChangePercent*100)))
+	}
+	if quote.RegularMarketDayLow != 0 || quote.RegularMarketDayHigh != 0 {
+		field("Day Range", fmt.Sprintf("%s - %s",
+			money(quote.RegularMarketDayLow), money(quote.RegularMarketDayHigh)))
+	}
+	if quote.FiftyDayAverage != 0 {
+		field("50-Day Average", fmt.Sprintf("%s (%s)",
+			money(quote.FiftyDayAverage),
+			l.SignedPercent(quote.FiftyDayAverageChangePercent*100)))
+	}
+	if quote.TwoHundredDayAverage != 0 {
+		field("200-Day Average", fmt.Sprintf("%s (%s)",
+			money(quote.TwoHundredDayAverage),
+			l.SignedPercent(quote.TwoHundredDayAverageChangePercent*100)))
+	}
+	if quote.RegularMarketVolume != 0 {
+		field("Volume", l.Humanize(float64(quote.RegularMarketVolume)))
+	}
+	if quote.AverageDailyVolume3Month != 0 {
+		field("Avg. Volume (3M)", l.Humanize(float64(quote.AverageDailyVolume3Month)))
+	}
+	return fields
+}
+
+// EarningsDate describes the next (or, failing that, most recent) earnings
+// report for a quote.
+func EarningsDate(quote APIResult, l *Locale, now time.Time) string {
+	start := quote.EarningsTimestampStart
+	end := quote.EarningsTimestampEnd
+	// Yahoo only knows the day of an earnings report, not the time, so
+	// there's no point showing more.
+	date := func(ts int64) string {
+		return ExchangeTime(quote, ts).Format(l.DateFormat)
+	}
+	switch {
+	case quote.EarningsTimestamp > now.Unix():
+		return date(quote.EarningsTimestamp)
+	case start > now.Unix() && end > start && date(start) != date(end):
+		return l.Tf("%s - %s (estimated)", date(start), date(end))
+	case start > now.Unix():
+		return l.Tf("%s (estimated)", date(start))
+	case quote.EarningsTimestamp != 0:
+		return l.Tf("%s (last reported)", date(quote.EarningsTimestamp))
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFundamentalFields(t *testing.T) {
+	quote := APIResult{
+		Currency:                      "USD",
+		ExchangeTimezoneName:          "America/New_York",
+		MarketCap:                     16471872512,
+		SharesOutstanding:             739644032,
+		ForwardPE:                     49.48889,
+		EpsTrailingTwelveMonths:       -0.627,
+		FiftyTwoWeekLow:               14.12,
+		FiftyTwoWeekHigh:              22.4,
+		FiftyTwoWeekHighChangePercent: -0.005803534,
+		FiftyDayAverage:               19.315556,
+		FiftyDayAverageChangePercent:  0.15295677,
+		EarningsTimestamp:             1509021000,
+	}
+	now := time.Unix(1511384466, 0)
+	expected := map[string]string{
+		"Market Cap":         "$16.5B",
+		"Shares Outstanding": "740M",
+		"Forward P/E":        "49.49",
+		"EPS (TTM)":          "-$0.63",
+		"Earnings":           "Oct 26, 2017 (last reported)",
+		"52-Week Range":      "$14.12 - $22.40 (-0.58% from high)",
+		"50-Day Average":     "$19.32 (+15.30%)",
+	}
+	fields := FundamentalFields(quote, English, now)
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d fields, got %v", len(expected), fields)
+	}
+	for _, f := range fields {
+		title := f["title"].(string)
+		if f["value"] != expected[title] {
+			t.Errorf("%s: expected %q, got %q", title, expected[title], f["value"])
+		}
+	}
+
+	// Stocks already show their market cap, and indices their day range.
+	for _, q := range []APIResult{
+		{QuoteType: "EQUITY", MarketCap: 1e9},
+		{QuoteType: "INDEX", RegularMarketDayLow: 1, RegularMarketDayHigh: 2},
+	} {
+		if fields := FundamentalFields(q, English, now); len(fields) != 0 {
+			t.Errorf("expected nothing the quote shows already, got %v", fields)
+		}
+	}
+
+	if a := FundamentalsAttachment(APIResult{}, English, now); a["fields"] != nil {
+		t.Errorf("expected no fields for an empty quote, got %v", a)
+	}
+
+	expected = map[string]string{
+		"Marktkapitalisierung":  "16,5 Mrd. $",
+		"Ausstehende Aktien":    "740 Mio.",
+		"Erwartetes KGV":        "49,49",
+		"Gewinn je Aktie (12M)": "-0,63 $",
+		"Quartalszahlen":        "26.10.2017 (zuletzt gemeldet)",
+		"52-Wochen-Spanne":      "14,12 $ - 22,40 $ (-0,58 % vom Hoch)",
+		"50-Tage-Durchschnitt":  "19,32 $ (+15,30 %)",
+	}
+	fields = FundamentalFields(quote, German, now)
+	if len(fields) != len(expected) {
+		t.Errorf("expected %d German fields, got %v", len(expected), fields)
+	}
+	for _, f := range fields {
+		title := f["title"].(string)
+		if f["value"] != expected[title] {
+			t.Errorf("%s: expected %q, got %q", title, expected[title], f["value"])
+		}
+	}
+	if fields := FundamentalFields(APIResult{QuoteType: "EQUITY", MarketCap: 1e9}, German, now); len(fields) != 0 {
+		t.Errorf("expected the German market cap to be left out too, got %v", fields)
+	}
+}
+
+func TestEarningsDate(t *testing.T) {
+	now := time.Unix(1511384466, 0) // Nov 22, 2017
+	tests := []struct {
+		quote  APIResult
+		output string
+	}{
+		{APIResult{}, ""},
+		{APIResult{EarningsTimestamp: 1518442200}, "Feb 12, 2018"},
+		{APIResult{EarningsTimestamp: 1509021000, EarningsTimestampStart: 1518010200,
+			EarningsTimestampEnd: 1518442200}, "Feb 7, 2018 - Feb 12, 2018 (estimated)"},
+		{APIResult{EarningsTimestamp: 1509021000, EarningsTimestampStart: 1518010200},
+			"Feb 7, 2018 (estimated)"},
+	}
+	for i, test := range tests {
+		test.quote.ExchangeTimezoneName = "America/New_York"
+		if out := EarningsDate(test.quote, English, now); out != test.output {
+			t.Errorf("%d. expected %q, got %q", i, test.output, out)
+		}
+	}
+}
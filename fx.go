@@ -0,0 +1,142 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/logic/slacker/slash"
+)
+
+var currencyCodeRegexp = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// FXOpts represents a set of parsed /fx command options.
+type FXOpts struct {
+	Amount float64
+	From   string
+	To     string
+	Prefer string
+}
+
+// FXCommand is the "/fx" Slack slash command.
+var FXCommand = &slash.Command{
+	Name:     "/fx",
+	Args:     "[amount] from to",
+	Help:     "Convert between currencies, or choose one to also see /ticker prices in.",
+	Response: "in_channel",
+	Flags: []slash.Flag{
+		{Name: "prefer", Default: "", Usage: "`currency` to also show /ticker prices in [ISO 4217 code, or none]"},
+	},
+	Run: runFX,
+}
+
+func init() {
+	slash.RegisterCommand(FXCommand)
+}
+
+// ParseFXCommand takes the /fx command line and parses it into FXOpts,
+// returning an error if anything goes wrong.
+func ParseFXCommand(cmd string) (FXOpts, error) {
+	args, err := slash.Tokenize(cmd)
+	if err != nil {
+		return FXOpts{}, FXCommand.UsageError(FXCommand.Name, err.Error(), English)
+	}
+	inv, err := FXCommand.Parse(args, English)
+	if err != nil {
+		return FXOpts{}, err
+	}
+	return fxOpts(inv)
+}
+
+func fxOpts(inv *slash.Invocation) (FXOpts, error) {
+	opts := FXOpts{Amount: 1, Prefer: inv.String("prefer")}
+	if opts.Prefer != "" {
+		opts.Prefer = strings.ToUpper(opts.Prefer)
+		if opts.Prefer != "NONE" && !currencyCodeRegexp.MatchString(opts.Prefer) {
+			return opts, inv.Errorf("currencies are three-letter codes, like USD or EUR")
+		}
+		if len(inv.Args) == 0 {
+			return opts, nil
+		}
+	}
+
+	args := inv.Args
+	if len(args) == 3 {
+		amount, err := localeOf(inv).ParseNumber(args[0])
+		if err != nil || amount <= 0 {
+			return opts, inv.Errorf("amount must be a positive number")
+		}
+		opts.Amount = amount
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		return opts, inv.Errorf("need a currency to convert from and to")
+	}
+	opts.From = strings.ToUpper(args[0])
+	opts.To = strings.ToUpper(args[1])
+	if !currencyCodeRegexp.MatchString(opts.From) || !currencyCodeRegexp.MatchString(opts.To) {
+		return opts, inv.Errorf("currencies are three-letter codes, like USD or EUR")
+	}
+	return opts, nil
+}
+
+// runFX answers an /fx command.
+func runFX(inv *slash.Invocation) (map[string]interface{}, error) {
+	opts, err := fxOpts(inv)
+	if err != nil {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          err.Error(),
+		}, nil
+	}
+	if opts.Prefer == "" {
+		return BuildFXPayload(opts, localeOf(inv), inv.Request.Context()), nil
+	}
+
+	prefer := opts.Prefer
+	if prefer == "NONE" {
+		prefer = ""
+	}
+	err = Prefs.Update(inv.Form("team_id"), inv.Form("user_id"),
+		func(p *UserPrefs) { p.Currency = prefer })
+	if err != nil {
+		return nil, err
+	}
+	text := inv.Locale.T("Ticker prices will only be shown in their own currency.")
+	if prefer != "" {
+		text = inv.Locale.Tf("Ticker prices will also be shown in %s.", prefer)
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}, nil
+}
+
+// BuildFXPayload converts an amount between currencies into a JSON payload
+// for rendering to the user in Slack.
+func BuildFXPayload(opts FXOpts, l *Locale, ctx context.Context) map[string]interface{} {
+	rate, err := YahooFromContext(ctx).GetFXRate(opts.From, opts.To)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text": l.Tf("An error occurred looking up _%s_",
+				FXSymbol(opts.From, opts.To)),
+		}
+	}
+	log.Printf("[%d] %s %0.4f\n", RequestID(ctx), FXSymbol(opts.From, opts.To), rate)
+	return map[string]interface{}{
+		"response_type": "in_channel",
+		"text": fmt.Sprintf("%s = *%s* _(1 %s = %s %s)_",
+			l.Money(opts.Amount, opts.From),
+			l.Money(opts.Amount*rate, opts.To),
+			opts.From, l.Number(rate, 4), opts.To),
+		"mrkdwn": true,
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseFXCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+		opts  FXOpts
+	}{
+		{"", false, FXOpts{}},
+		{"USD", false, FXOpts{}},
+		{"usd eur", true, FXOpts{Amount: 1, From: "USD", To: "EUR"}},
+		{"100 USD EUR", true, FXOpts{Amount: 100, From: "USD", To: "EUR"}},
+		{"1,000  USD  JPY", true, FXOpts{Amount: 1000, From: "USD", To: "JPY"}},
+		{"-5 USD EUR", false, FXOpts{}},
+		{"x USD EUR", false, FXOpts{}},
+		{"100 DOLLARS EUR", false, FXOpts{}},
+		{"-prefer eur", true, FXOpts{Amount: 1, Prefer: "EUR"}},
+		{"-prefer none", true, FXOpts{Amount: 1, Prefer: "NONE"}},
+		{"-prefer euros", false, FXOpts{}},
+	}
+	for i, test := range tests {
+		opts, err := ParseFXCommand(test.input)
+		if test.valid && err != nil {
+			t.Errorf("%d. expected input to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected input to be invalid", i)
+		} else if test.valid && opts != test.opts {
+			t.Errorf("%d. expected %+v, got %+v", i, test.opts, opts)
+		}
+	}
+}
+
+func TestParseFXGerman(t *testing.T) {
+	inv, err := FXCommand.Parse([]string{"1,5", "EUR", "USD"}, German)
+	if err != nil {
+		t.Fatal("Parse failed:", err)
+	}
+	opts, err := fxOpts(inv)
+	if err != nil {
+		t.Fatal("fxOpts failed:", err)
+	}
+	if opts.Amount != 1.5 {
+		t.Errorf("expected 1,5 to be 1.5, got %v", opts.Amount)
+	}
+}
+
+func TestFXPrefer(t *testing.T) {
+	Prefs = NewPrefsStore("")
+	for _, test := range []struct {
+		text     string
+		currency string
+	}{
+		{"-prefer eur", "EUR"},
+		{"-prefer none", ""},
+	} {
+		form := url.Values{
+			"team_id": {"T1"},
+			"user_id": {"U1"},
+			"text":    {test.text},
+		}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := CommandHandler(FXCommand)(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("FX failed:", err)
+		}
+		if c := Prefs.Get("T1", "U1").Currency; c != test.currency {
+			t.Errorf("expected preferred currency %q, got %q", test.currency, c)
+		}
+	}
+}
+
+func TestBuildFXPayload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"quoteResponse":{"result":[{"symbol":"EURUSD=X","regularMarketPrice":1.0877}]}}`)
+	}))
+	defer ts.Close()
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)), NewYahoo(ts.URL))
+
+	opts := FXOpts{Amount: 1500, From: "EUR", To: "USD"}
+	for _, test := range []struct {
+		l    *Locale
+		text string
+	}{
+		{English, "€1500.00 = *$1631.55* _(1 EUR = 1.0877 USD)_"},
+		{German, "1.500,00 € = *1.631,55 $* _(1 EUR = 1,0877 USD)_"},
+	} {
+		if p := BuildFXPayload(opts, test.l, ctx); p["text"] != test.text {
+			t.Errorf("%s: expected %q, got %q", test.l.Tag, test.text, p["text"])
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderStatus is how the requests we've made to an outside service have
+// gone.
+type ProviderStatus struct {
+	Name        string
+	Requests    uint64
+	Failures    uint64
+	LastSuccess time.Time
+	LastFailure time.Time
+	LastError   string
+	LastLatency time.Duration
+}
+
+// Healthy reports whether the most recent request to the provider worked.
+func (s ProviderStatus) Healthy() bool {
+	return !s.LastSuccess.Before(s.LastFailure)
+}
+
+var providers = struct {
+	sync.Mutex
+	status map[string]*ProviderStatus
+}{status: map[string]*ProviderStatus{}}
+
+// RecordProviderRequest notes how a request to an outside service went; a
+// nil err means it worked.
+func RecordProviderRequest(name string, latency time.Duration, err error) {
+	providers.Lock()
+	defer providers.Unlock()
+	s, ok := providers.status[name]
+	if !ok {
+		s = &ProviderStatus{Name: name}
+		providers.status[name] = s
+	}
+	s.Requests++
+	s.LastLatency = latency
+	if err != nil {
+		s.Failures++
+		s.LastFailure = time.Now()
+		s.LastError = err.Error()
+	} else {
+		s.LastSuccess = time.Now()
+	}
+}
+
+// ProviderHealth returns the status of every outside service we've made
+// requests to, by name.
+func ProviderHealth() []ProviderStatus {
+	providers.Lock()
+	defer providers.Unlock()
+	var all []ProviderStatus
+	for _, s := range providers.status {
+		all = append(all, *s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	return all
+}
+
+// providerTransport records how each request made through it goes, as
+// requests to the named provider. Server errors count as failures, since
+// they're the provider's fault; other statuses are up to the caller.
+type providerTransport struct {
+	name string
+	next http.RoundTripper
+}
+
+func (t providerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	failure := err
+	if err == nil && resp.StatusCode >= 500 {
+		failure = fmt.Errorf("%s returned %d status", req.URL.Host, resp.StatusCode)
+	}
+	RecordProviderRequest(t.name, time.Since(start), failure)
+	return resp, err
+}
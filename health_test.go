@@ -0,0 +1,57 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProviderHealth(t *testing.T) {
+	failing := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}})
+	client := providerClient("Test Provider", "")
+	status := func() ProviderStatus {
+		for _, s := range ProviderHealth() {
+			if s.Name == "Test Provider" {
+				return s
+			}
+		}
+		t.Fatal("expected the test provider to be tracked")
+		return ProviderStatus{}
+	}
+
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal("request failed:", err)
+	}
+	resp.Body.Close()
+	if s := status(); s.Healthy() || s.Failures != 1 || !strings.Contains(s.LastError, "502 status") {
+		t.Errorf("expected a failure, got %+v", s)
+	}
+	if text := slackerCall(t, "UADMIN", "health"); !strings.Contains(text, ":x: *Test Provider:* failing since") {
+		t.Errorf("unexpected health %q", text)
+	}
+
+	failing = false
+	resp, _ = client.Get(ts.URL)
+	resp.Body.Close()
+	if s := status(); !s.Healthy() || s.Requests != 2 || s.Failures != 1 {
+		t.Errorf("expected recovery, got %+v", s)
+	}
+	if text := slackerCall(t, "UADMIN", "health"); !strings.Contains(text, ":white_check_mark: *Test Provider:* OK") ||
+		!strings.Contains(text, "1 of 2 requests failed") {
+		t.Errorf("unexpected health %q", text)
+	}
+}
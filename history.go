@@ -0,0 +1,182 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// historyDateFormat is how dates are given to -on and -range.
+const historyDateFormat = "2006-01-02"
+
+// historyLookback is how far before a requested date we fetch bars, so we
+// can snap to the nearest prior session across weekends and long holidays.
+const historyLookback = 10 * 24 * time.Hour
+
+// ParseHistoryRange parses the arguments to -on and -range into the first
+// and last day asked for, returning an error if they make no sense. The
+// error's text is an English message, for the caller to translate.
+func ParseHistoryRange(on, dateRange string, now time.Time) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	switch {
+	case on != "" && dateRange != "":
+		return start, end, errors.New("use either -on or -range, not both")
+	case on != "":
+		if start, err = time.Parse(historyDateFormat, on); err != nil {
+			return start, end, errors.New("-on takes a date like 2024-03-15")
+		}
+		end = start
+	case dateRange != "":
+		parts := strings.Split(dateRange, ":")
+		if len(parts) != 2 {
+			return start, end, errors.New("-range takes dates like 2024-01-01:2024-06-30")
+		}
+		if start, err = time.Parse(historyDateFormat, parts[0]); err != nil {
+			return start, end, errors.New("-range takes dates like 2024-01-01:2024-06-30")
+		}
+		if end, err = time.Parse(historyDateFormat, parts[1]); err != nil {
+			return start, end, errors.New("-range takes dates like 2024-01-01:2024-06-30")
+		}
+		if !start.Before(end) {
+			return start, end, errors.New("the start of a -range must be before its end")
+		}
+	default:
+		return start, end, errors.New("no date given")
+	}
+	if start.After(now) {
+		return start, end, errors.New("that hasn't happened yet")
+	}
+	return start, end, nil
+}
+
+// SessionOnOrBefore returns the index of the last bar traded on or before
+// the given day (in the exchange's timezone), or -1 if there isn't one.
+func SessionOnOrBefore(bars []Bar, day time.Time) int {
+	want := day.Format(historyDateFormat)
+	found := -1
+	for i, bar := range bars {
+		if bar.Time.Format(historyDateFormat) > want {
+			break
+		}
+		found = i
+	}
+	return found
+}
+
+// BuildHistoryPayload formats historical prices for the requested day or
+// range of days into a JSON payload for rendering to the user in Slack.
+func BuildHistoryPayload(opts TickerOpts, ctx context.Context) map[string]interface{} {
+	l := LocaleFor(opts.TeamID, opts.UserID)
+	payload := map[string]interface{}{}
+	start, end, err := ParseHistoryRange(opts.On, opts.Range, time.Now())
+	if err != nil {
+		payload["text"] = l.Tf("*Error:* %s", l.T(err.Error()))
+		return payload
+	}
+
+	// Fetch a little before the start, in case it wasn't a trading day,
+	// and through the end of the last day.
+	history, err := YahooFromContext(ctx).GetHistory(opts.Symbol, start.Add(-historyLookback),
+		end.Add(36*time.Hour))
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		payload["text"] = l.Tf("An error occurred looking up _%s_", opts.Symbol)
+		return payload
+	}
+	first := SessionOnOrBefore(history.Bars, start)
+	last := SessionOnOrBefore(history.Bars, end)
+	if first < 0 || last < 0 {
+		payload["text"] = l.Tf("No trading history for _%s_ on or before %s",
+			opts.Symbol, start.Format(l.WeekdayDateFormat))
+		return payload
+	}
+
+	money := func(v float64) string {
+		return l.Money(v, history.Currency)
+	}
+	snapped := func(bar Bar, day time.Time) string {
+		if bar.Time.Format(historyDateFormat) == day.Format(historyDateFormat) {
+			return bar.Time.Format(l.WeekdayDateFormat)
+		}
+		return l.Tf("%s _(nearest session before %s)_",
+			bar.Time.Format(l.WeekdayDateFormat), day.Format(l.WeekdayDateFormat))
+	}
+
+	var attachment map[string]interface{}
+	if opts.On != "" {
+		bar := history.Bars[last]
+		attachment = map[string]interface{}{
+			"fallback": l.Tf("%s on %s: open %s, high %s, low %s, close %s",
+				opts.Symbol, bar.Time.Format(l.WeekdayDateFormat),
+				money(bar.Open), money(bar.High), money(bar.Low), money(bar.Close)),
+			"pretext": l.Tf(":calendar: *%s* on %s", opts.Symbol, snapped(bar, end)),
+			"fields": []map[string]interface{}{
+				{"title": l.T("Open"), "value": money(bar.Open), "short": true},
+				{"title": l.T("Close"), "value": money(bar.Close), "short": true},
+				{"title": l.T("High"), "value": money(bar.High), "short": true},
+				{"title": l.T("Low"), "value": money(bar.Low), "short": true},
+				{"title": l.T("Volume"), "value": l.Humanize(float64(bar.Volume)), "short": true},
+			},
+			"mrkdwn_in": []string{"pretext"},
+		}
+	} else {
+		// If the range starts on a trading day, it starts at that day's
+		// open; otherwise it starts at the close of the session before.
+		from, to := history.Bars[first], history.Bars[last]
+		startPrice := from.Open
+		sessions := history.Bars[first : last+1]
+		if from.Time.Format(historyDateFormat) != start.Format(historyDateFormat) {
+			startPrice = from.Close
+			if len(sessions) > 1 {
+				sessions = sessions[1:]
+			}
+		}
+		high, low := sessions[0].High, sessions[0].Low
+		var volume int64
+		for _, bar := range sessions {
+			if bar.High > high {
+				high = bar.High
+			}
+			if bar.Low < low {
+				low = bar.Low
+			}
+			volume += bar.Volume
+		}
+		change := (to.Close/startPrice - 1) * 100
+		color := "warning"
+		if change < 0 {
+			color = "danger"
+		} else if change > 0 {
+			color = "good"
+		}
+		attachment = map[string]interface{}{
+			"fallback": l.Tf("%s from %s to %s: %s to %s (%s)",
+				opts.Symbol, from.Time.Format(l.WeekdayDateFormat),
+				to.Time.Format(l.WeekdayDateFormat), money(startPrice),
+				money(to.Close), l.SignedPercent(change)),
+			"pretext": l.Tf(":calendar: *%s* from %s to %s", opts.Symbol,
+				snapped(from, start), snapped(to, end)),
+			"color": color,
+			"fields": []map[string]interface{}{
+				{"title": l.T("Open"), "value": money(startPrice), "short": true},
+				{"title": l.T("Close"), "value": money(to.Close), "short": true},
+				{"title": l.T("High"), "value": money(high), "short": true},
+				{"title": l.T("Low"), "value": money(low), "short": true},
+				{"title": l.T("Total Return"), "value": l.SignedPercent(change), "short": true},
+				{"title": l.T("Volume"), "value": l.Humanize(float64(volume)), "short": true},
+			},
+			"mrkdwn_in": []string{"pretext"},
+		}
+	}
+	payload["attachments"] = []map[string]interface{}{attachment}
+	payload["response_type"] = "in_channel"
+	log.Printf("[%d] %s history %s%s\n", RequestID(ctx), opts.Symbol, opts.On, opts.Range)
+	return payload
+}
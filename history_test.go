@@ -0,0 +1,148 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	now := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		on    string
+		rng   string
+		valid bool
+	}{
+		{"", "", false},
+		{"2024-03-15", "", true},
+		{"2024-03-15", "2024-01-01:2024-06-30", false},
+		{"15/03/2024", "", false},
+		{"2025-01-01", "", false},
+		{"", "2024-01-01:2024-06-30", true},
+		{"", "2024-06-30:2024-01-01", false},
+		{"", "2024-01-01", false},
+		{"", "2024-01-01:June", false},
+	}
+	for i, test := range tests {
+		_, _, err := ParseHistoryRange(test.on, test.rng, now)
+		if test.valid && err != nil {
+			t.Errorf("%d. expected range to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected range to be invalid", i)
+		}
+	}
+}
+
+// historyHandler serves a week of AAPL sessions, Thursday March 14 to
+// Wednesday March 20 2024, with nothing over the weekend.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/AAPL") {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"chart":{"result":null,"error":{"code":"Not Found","description":"No data found, symbol may be delisted"}}}`)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{"chart":{"result":[{"meta":{"currency":"USD","symbol":"AAPL",`+
+		`"exchangeTimezoneName":"America/New_York","gmtoffset":-14400},`+
+		`"timestamp":[1710423000,1710509400,1710768600,1710855000,1710941400],`+
+		`"indicators":{"quote":[{`+
+		`"open":[172.9,171.2,175.6,174.3,175.7],`+
+		`"high":[174.3,172.6,177.7,176.6,178.7],`+
+		`"low":[172.0,170.3,175.1,173.9,175.1],`+
+		`"close":[173.0,172.6,173.7,176.1,178.7],`+
+		`"volume":[60000000,120000000,70000000,55000000,53000000]}]}}],"error":null}}`)
+}
+
+func TestGetHistory(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(historyHandler))
+	defer ts.Close()
+	yahoo := NewYahoo(ts.URL)
+
+	history, err := yahoo.GetHistory("AAPL", time.Unix(1710000000, 0), time.Unix(1711000000, 0))
+	if err != nil {
+		t.Fatal("GetHistory failed:", err)
+	}
+	if len(history.Bars) != 5 || history.Currency != "USD" {
+		t.Fatalf("unexpected history %+v", history)
+	}
+	if day := history.Bars[1].Time.Format(historyDateFormat); day != "2024-03-15" {
+		t.Errorf("expected 2024-03-15 in exchange time, got %s", day)
+	}
+	if _, err := yahoo.GetHistory("NOPE", time.Unix(1710000000, 0), time.Unix(1711000000, 0)); err == nil {
+		t.Error("GetHistory didn't catch unknown symbol")
+	}
+}
+
+func TestBuildHistoryPayload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(historyHandler))
+	defer ts.Close()
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)), NewYahoo(ts.URL))
+
+	field := func(payload map[string]interface{}, title string) string {
+		attachments := payload["attachments"].([]map[string]interface{})
+		for _, f := range attachments[0]["fields"].([]map[string]interface{}) {
+			if f["title"] == title {
+				return f["value"].(string)
+			}
+		}
+		return ""
+	}
+
+	// Saturday snaps back to Friday's session.
+	payload := BuildHistoryPayload(TickerOpts{Symbol: "AAPL", On: "2024-03-16"}, ctx)
+	if payload["response_type"] != "in_channel" {
+		t.Fatalf("unexpected payload %v", payload)
+	}
+	if close := field(payload, "Close"); close != "$172.60" {
+		t.Errorf("expected Friday's close of $172.60, got %s", close)
+	}
+
+	payload = BuildHistoryPayload(TickerOpts{Symbol: "AAPL", Range: "2024-03-15:2024-03-20"}, ctx)
+	if open := field(payload, "Open"); open != "$171.20" {
+		t.Errorf("expected Friday's open of $171.20, got %s", open)
+	}
+	if ret := field(payload, "Total Return"); ret != "+4.38%" {
+		t.Errorf("expected +4.38%% return, got %s", ret)
+	}
+	if low := field(payload, "Low"); low != "$170.30" {
+		t.Errorf("expected low of $170.30, got %s", low)
+	}
+
+	// Starting on Sunday starts from Friday's close, and leaves Friday
+	// out of the range.
+	payload = BuildHistoryPayload(TickerOpts{Symbol: "AAPL", Range: "2024-03-17:2024-03-20"}, ctx)
+	if open := field(payload, "Open"); open != "$172.60" {
+		t.Errorf("expected Friday's close of $172.60, got %s", open)
+	}
+	if low := field(payload, "Low"); low != "$173.90" {
+		t.Errorf("expected low of $173.90, got %s", low)
+	}
+
+	payload = BuildHistoryPayload(TickerOpts{Symbol: "AAPL", On: "2024-03-01"}, ctx)
+	if _, ok := payload["response_type"]; ok {
+		t.Errorf("expected an error before the first session, got %v", payload)
+	}
+
+	changeTestConfig(func(c *Configuration) { c.Locale = "de" })
+	defer changeTestConfig(func(c *Configuration) { c.Locale = "" })
+	payload = BuildHistoryPayload(TickerOpts{Symbol: "AAPL", On: "2024-03-16"}, ctx)
+	if close := field(payload, "Schluss"); close != "172,60 $" {
+		t.Errorf("expected a German close of 172,60 $, got %s", close)
+	}
+	pretext := payload["attachments"].([]map[string]interface{})[0]["pretext"]
+	if pretext != ":calendar: *AAPL* am 15.3.2024 _(letzter Handelstag vor dem 16.3.2024)_" {
+		t.Errorf("unexpected German pretext %q", pretext)
+	}
+	payload = BuildHistoryPayload(TickerOpts{Symbol: "AAPL", Range: "2024-03-15:2024-03-20"}, ctx)
+	if ret := field(payload, "Gesamtrendite"); ret != "+4,38 %" {
+		t.Errorf("expected a German return of +4,38 %%, got %s", ret)
+	}
+}
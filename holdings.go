@@ -0,0 +1,322 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// paperPortfolioName is reserved for the paper-trading game; real portfolios
+// can't use it.
+const paperPortfolioName = "paper"
+
+var portfolioNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Holding is a real position a user has imported. Cost is the total cost
+// basis of the position, in paperCurrency.
+type Holding struct {
+	Symbol   string
+	Quantity float64
+	Cost     float64
+}
+
+// HoldingsStore is a persistent, concurrency-safe map of Slack users to
+// their imported portfolios, each of which has a name.
+type HoldingsStore struct {
+	sync.RWMutex
+	path  string
+	users map[string]map[string][]Holding
+}
+
+// NewHoldingsStore creates an empty store backed by the file at path. If
+// path is empty, portfolios are only kept in memory.
+func NewHoldingsStore(path string) *HoldingsStore {
+	return &HoldingsStore{
+		path:  path,
+		users: map[string]map[string][]Holding{},
+	}
+}
+
+// Load replaces the contents of the store with what is saved on disk.
+func (s *HoldingsStore) Load() error {
+	users := map[string]map[string][]Holding{}
+	if err := loadJSONFile(s.path, &users); err != nil {
+		return err
+	}
+	s.Lock()
+	s.users = users
+	s.Unlock()
+	return nil
+}
+
+// Get returns one of a user's named portfolios, if it exists.
+func (s *HoldingsStore) Get(teamID, userID, name string) ([]Holding, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	holdings, ok := s.users[prefsKey(teamID, userID)][name]
+	return append([]Holding(nil), holdings...), ok
+}
+
+// Names returns the names of all of a user's portfolios, in order.
+func (s *HoldingsStore) Names(teamID, userID string) []string {
+	s.RLock()
+	defer s.RUnlock()
+	var names []string
+	for name := range s.users[prefsKey(teamID, userID)] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save replaces one of a user's named portfolios, and persists the store.
+func (s *HoldingsStore) Save(teamID, userID, name string, holdings []Holding) error {
+	s.Lock()
+	defer s.Unlock()
+	key := prefsKey(teamID, userID)
+	if s.users[key] == nil {
+		s.users[key] = map[string][]Holding{}
+	}
+	s.users[key][name] = holdings
+	return saveJSONFile(s.path, s.users)
+}
+
+// Delete removes one of a user's named portfolios, and persists the store.
+func (s *HoldingsStore) Delete(teamID, userID, name string) error {
+	s.Lock()
+	defer s.Unlock()
+	key := prefsKey(teamID, userID)
+	if _, ok := s.users[key][name]; !ok {
+		return nil
+	}
+	delete(s.users[key], name)
+	return saveJSONFile(s.path, s.users)
+}
+
+// ValidPortfolioName reports whether a name can be used for an imported
+// portfolio.
+func ValidPortfolioName(name string) bool {
+	return name != paperPortfolioName && portfolioNameRegexp.MatchString(name)
+}
+
+// ParseHoldingsCSV reads holdings from CSV, one "symbol,quantity,cost basis"
+// line per holding. A header line is skipped, and repeated symbols are
+// combined. Errors mention the line they were found on.
+func ParseHoldingsCSV(r io.Reader) ([]Holding, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var holdings []Holding
+	index := map[string]int{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(record) != 3 {
+			return nil, fmt.Errorf("line %d: expected symbol, quantity and cost basis", line)
+		}
+		symbol := ResolveSymbol(strings.TrimSpace(record[0]))
+		qty, qtyErr := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		cost, costErr := strconv.ParseFloat(strings.Trim(
+			strings.Replace(record[2], ",", "", -1), " $"), 64)
+		if line == 1 && qtyErr != nil && costErr != nil {
+			// Probably a header.
+			continue
+		}
+		if !ValidSymbol(symbol) {
+			return nil, fmt.Errorf("line %d: invalid ticker symbol '%s'", line, record[0])
+		}
+		if qtyErr != nil || qty <= 0 {
+			return nil, fmt.Errorf("line %d: quantity must be a positive number", line)
+		}
+		if costErr != nil || cost < 0 {
+			return nil, fmt.Errorf("line %d: cost basis must be a number", line)
+		}
+		if i, ok := index[symbol]; ok {
+			holdings[i].Quantity += qty
+			holdings[i].Cost += cost
+			continue
+		}
+		index[symbol] = len(holdings)
+		holdings = append(holdings, Holding{symbol, qty, cost})
+	}
+	if len(holdings) == 0 {
+		return nil, fmt.Errorf("no holdings found")
+	}
+	return holdings, nil
+}
+
+// HoldingsCSV renders holdings back into the CSV format that
+// ParseHoldingsCSV reads.
+func HoldingsCSV(holdings []Holding) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"symbol", "quantity", "cost basis"})
+	for _, h := range holdings {
+		w.Write([]string{h.Symbol,
+			strconv.FormatFloat(h.Quantity, 'f', -1, 64),
+			strconv.FormatFloat(h.Cost, 'f', 2, 64)})
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// BuildHoldingsValuePayload describes the current value, day change and
+// unrealised gain of an imported portfolio, privately, to its owner.
+func BuildHoldingsValuePayload(name string, holdings []Holding, l *Locale, ctx context.Context) map[string]interface{} {
+	var symbols []string
+	for _, h := range holdings {
+		symbols = append(symbols, h.Symbol)
+	}
+	prices, quotes, err := QuotePrices(symbols, ctx)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.Tf("An error occurred valuing _%s_", name),
+		}
+	}
+
+	var total, cost, day float64
+	var lines bytes.Buffer
+	for _, h := range holdings {
+		qty := l.Number(h.Quantity, -1)
+		price, ok := prices[h.Symbol]
+		if !ok {
+			fmt.Fprintln(&lines, l.Tf("*%s* %s _(no price available)_", h.Symbol, qty))
+			total += h.Cost
+			cost += h.Cost
+			continue
+		}
+		quote := quotes[h.Symbol]
+		worth := h.Quantity * price
+		// The day change is in the quote's currency; scale it into ours
+		// the same way the price was.
+		change := 0.0
+		if quote.RegularMarketPrice != 0 {
+			change = h.Quantity * quote.RegularMarketChange * price / quote.RegularMarketPrice
+		}
+		total += worth
+		cost += h.Cost
+		day += change
+		fmt.Fprintln(&lines, l.Tf("*%s* %s @ %s = %s _(day %s, gain %s)_", h.Symbol, qty,
+			l.Money(quote.RegularMarketPrice, quote.Currency),
+			l.Money(worth, paperCurrency), l.Money(change, paperCurrency),
+			l.Money(worth-h.Cost, paperCurrency)))
+	}
+
+	gainPct, dayPct := 0.0, 0.0
+	if cost != 0 {
+		gainPct = (total/cost - 1) * 100
+	}
+	if total != day {
+		dayPct = day / (total - day) * 100
+	}
+	text := l.Tf("*Portfolio %s:* %s\nDay change: %s _(%s)_\nUnrealised gain: %s _(%s)_\n%s",
+		name, l.Money(total, paperCurrency),
+		l.Money(day, paperCurrency), l.SignedPercent(dayPct),
+		l.Money(total-cost, paperCurrency), l.SignedPercent(gainPct),
+		strings.TrimSpace(lines.String()))
+	log.Printf("[%d] Valued portfolio %s (%d holdings)\n", RequestID(ctx), name, len(holdings))
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+}
+
+// portfolioImportMetadata is what we stash in the import modal, so we know
+// where to report back once it's submitted.
+type portfolioImportMetadata struct {
+	ChannelID string `json:"channel_id"`
+}
+
+// PortfolioImportView builds the modal for pasting in a portfolio's CSV.
+func PortfolioImportView(name, channelID string) map[string]interface{} {
+	metadata, _ := json.Marshal(portfolioImportMetadata{channelID})
+	nameInput := map[string]interface{}{
+		"type":      "plain_text_input",
+		"action_id": "value",
+	}
+	if name != "" {
+		nameInput["initial_value"] = name
+	}
+	return map[string]interface{}{
+		"type":             "modal",
+		"callback_id":      "portfolio_import",
+		"private_metadata": string(metadata),
+		"title":            map[string]interface{}{"type": "plain_text", "text": "Import portfolio"},
+		"submit":           map[string]interface{}{"type": "plain_text", "text": "Import"},
+		"close":            map[string]interface{}{"type": "plain_text", "text": "Cancel"},
+		"blocks": []map[string]interface{}{
+			{
+				"type":     "input",
+				"block_id": "name",
+				"label":    map[string]interface{}{"type": "plain_text", "text": "Portfolio name"},
+				"element":  nameInput,
+			},
+			{
+				"type":     "input",
+				"block_id": "csv",
+				"label":    map[string]interface{}{"type": "plain_text", "text": "Holdings (CSV)"},
+				"hint": map[string]interface{}{"type": "plain_text",
+					"text": "One holding per line: symbol, quantity, total cost basis in USD"},
+				"element": map[string]interface{}{
+					"type":      "plain_text_input",
+					"action_id": "value",
+					"multiline": true,
+				},
+			},
+		},
+	}
+}
+
+// PortfolioImportSubmission stores the portfolio pasted into the import
+// modal, or points out what's wrong with it.
+func PortfolioImportSubmission(ctx context.Context, p InteractionPayload) (map[string]interface{}, error) {
+	name := strings.ToLower(strings.TrimSpace(p.View.State.Value("name", "value")))
+	if !ValidPortfolioName(name) {
+		return ViewErrors(map[string]string{
+			"name": "Use up to 32 letters, numbers, - or _ (and not \"paper\")",
+		}), nil
+	}
+	holdings, err := ParseHoldingsCSV(strings.NewReader(p.View.State.Value("csv", "value")))
+	if err != nil {
+		return ViewErrors(map[string]string{"csv": err.Error()}), nil
+	}
+	if err := Holdings.Save(p.Team.ID, p.User.ID, name, holdings); err != nil {
+		return nil, err
+	}
+	log.Printf("[%d] Imported portfolio %s (%d holdings)\n", RequestID(ctx), name, len(holdings))
+
+	var metadata portfolioImportMetadata
+	json.Unmarshal([]byte(p.View.PrivateMetadata), &metadata)
+	if inst, ok := InstallationFromContext(ctx); ok && metadata.ChannelID != "" {
+		text := fmt.Sprintf("Imported %d holdings into portfolio _%s_; see it with `/portfolio show %s`",
+			len(holdings), name, name)
+		if err := SlackFromContext(ctx).PostEphemeral(inst.BotToken, metadata.ChannelID, p.User.ID, text); err != nil {
+			log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHoldingsCSV(t *testing.T) {
+	tests := []struct {
+		input    string
+		valid    bool
+		holdings []Holding
+	}{
+		{"", false, nil},
+		{"symbol,quantity,cost basis\nAAPL,10,1500\n", true,
+			[]Holding{{"AAPL", 10, 1500}}},
+		{"aapl, 10, \"$1,500.00\"\n\n# comment\nmsft,5,1000\naapl,5,500", true,
+			[]Holding{{"AAPL", 15, 2000}, {"MSFT", 5, 1000}}},
+		{"AAPL,10", false, nil},
+		{"AAPL,ten,1500", false, nil},
+		{"AAPL,10,1500\nA B,1,1", false, nil},
+		{"AAPL,10,1500\nMSFT,1,-1", false, nil},
+	}
+	for i, test := range tests {
+		holdings, err := ParseHoldingsCSV(strings.NewReader(test.input))
+		if test.valid && err != nil {
+			t.Errorf("%d. expected input to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected input to be invalid", i)
+		} else if test.valid && !reflect.DeepEqual(holdings, test.holdings) {
+			t.Errorf("%d. expected %+v, got %+v", i, test.holdings, holdings)
+		}
+	}
+
+	_, err := ParseHoldingsCSV(strings.NewReader("AAPL,10,1500\nAAPL,x,1"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+}
+
+func TestHoldingsCSVRoundTrip(t *testing.T) {
+	holdings := []Holding{{"AAPL", 10, 1500}, {"BRK-B", 0.5, 200.25}}
+	parsed, err := ParseHoldingsCSV(strings.NewReader(HoldingsCSV(holdings)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, holdings) {
+		t.Errorf("expected %+v, got %+v", holdings, parsed)
+	}
+}
+
+func TestBuildHoldingsValuePayload(t *testing.T) {
+	quoteHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"quoteResponse":{"result":[`+
+			`{"symbol":"AAPL","currency":"USD","regularMarketPrice":110,"regularMarketChange":10},`+
+			`{"symbol":"MSFT","currency":"USD","regularMarketPrice":50,"regularMarketChange":-5}]}}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(quoteHandler))
+	defer ts.Close()
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)), NewYahoo(ts.URL))
+
+	payload := BuildHoldingsValuePayload("ira", []Holding{{"AAPL", 10, 1000}, {"MSFT", 10, 600}}, English, ctx)
+	text := payload["text"].(string)
+	for _, expected := range []string{
+		"*Portfolio ira:* $1600.00",
+		"Day change: $50.00 _(+3.23%)_",
+		"Unrealised gain: $0.00 _(+0.00%)_",
+		"*MSFT* 10 @ $50.00 = $500.00 _(day -$50.00, gain -$100.00)_",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in %q", expected, text)
+		}
+	}
+
+	payload = BuildHoldingsValuePayload("ira", []Holding{{"AAPL", 10, 1000}, {"MSFT", 10, 600}}, German, ctx)
+	text = payload["text"].(string)
+	for _, expected := range []string{
+		"*Portfolio ira:* 1.600,00 $",
+		"Tagesänderung: 50,00 $ _(+3,23 %)_",
+		"Nicht realisierter Gewinn: 0,00 $ _(+0,00 %)_",
+		"*MSFT* 10 @ 50,00 $ = 500,00 $ _(Tag -50,00 $, Gewinn -100,00 $)_",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("expected %q in %q", expected, text)
+		}
+	}
+}
+
+func TestPortfolioImportSubmission(t *testing.T) {
+	SetConfig(Configuration{})
+	Installations = NewInstallationStore("")
+	Holdings = NewHoldingsStore("")
+
+	submit := func(name, csv string) map[string]interface{} {
+		view := PortfolioImportView("", "C1")
+		view["state"] = map[string]interface{}{
+			"values": map[string]interface{}{
+				"name": map[string]interface{}{"value": map[string]interface{}{"type": "plain_text_input", "value": name}},
+				"csv":  map[string]interface{}{"value": map[string]interface{}{"type": "plain_text_input", "value": csv}},
+			},
+		}
+		p, _ := json.Marshal(map[string]interface{}{
+			"type": "view_submission",
+			"team": map[string]interface{}{"id": "T1"},
+			"user": map[string]interface{}{"id": "U1"},
+			"view": view,
+		})
+		form := url.Values{"payload": {string(p)}}
+		req := httptest.NewRequest("POST", "/interactive", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := InteractionDispatcher(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("InteractionDispatcher failed:", err)
+		}
+		if w.Body.Len() == 0 {
+			return nil
+		}
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	if r := submit("paper", "AAPL,1,1"); r == nil || r["errors"].(map[string]interface{})["name"] == nil {
+		t.Errorf("expected a name error, got %v", r)
+	}
+	if r := submit("ira", "AAPL,x,1"); r == nil || r["errors"].(map[string]interface{})["csv"] == nil {
+		t.Errorf("expected a CSV error, got %v", r)
+	}
+	if r := submit("IRA", "AAPL,1,1"); r != nil {
+		t.Errorf("expected the modal to close, got %v", r)
+	}
+	if holdings, ok := Holdings.Get("T1", "U1", "ira"); !ok || len(holdings) != 1 {
+		t.Errorf("expected imported portfolio, got %v", holdings)
+	}
+	if names := Holdings.Names("T1", "U1"); !reflect.DeepEqual(names, []string{"ira"}) {
+		t.Errorf("expected [ira], got %v", names)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxRecentLookups is how many of a user's recent /ticker lookups we keep.
+const maxRecentLookups = 10
+
+// homeQuotes remembers the quotes we last showed on each user's Home tab,
+// so that flicking back and forth to it doesn't hammer the quote provider.
+var homeQuotes = NewCache(time.Minute)
+
+// RecordLookup adds a symbol to the front of a user's recent lookups.
+func RecordLookup(teamID, userID, symbol string) error {
+	return Prefs.Update(teamID, userID, func(p *UserPrefs) {
+		p.Recent = prependSymbol(p.Recent, symbol, maxRecentLookups)
+	})
+}
+
+// AddFavourite adds a symbol to a user's favourites, if it isn't there
+// already.
+func AddFavourite(teamID, userID, symbol string) error {
+	return Prefs.Update(teamID, userID, func(p *UserPrefs) {
+		if !containsSymbol(p.Favourites, symbol) {
+			p.Favourites = append(p.Favourites, symbol)
+		}
+	})
+}
+
+// RemoveFavourite removes a symbol from a user's favourites.
+func RemoveFavourite(teamID, userID, symbol string) error {
+	return Prefs.Update(teamID, userID, func(p *UserPrefs) {
+		p.Favourites = removeSymbol(p.Favourites, symbol)
+	})
+}
+
+// UpdateFavourites handles /ticker -fav and -unfav.
+func UpdateFavourites(opts TickerOpts) (map[string]interface{}, error) {
+	l := LocaleFor(opts.TeamID, opts.UserID)
+	text := l.Tf("Added *%s* to your favourites", opts.Symbol)
+	update := AddFavourite
+	if opts.Unfav {
+		text = l.Tf("Removed *%s* from your favourites", opts.Symbol)
+		update = RemoveFavourite
+	}
+	if err := update(opts.TeamID, opts.UserID, opts.Symbol); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}, nil
+}
+
+func containsSymbol(symbols []string, symbol string) bool {
+	for _, s := range symbols {
+		if s == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+func removeSymbol(symbols []string, symbol string) []string {
+	var out []string
+	for _, s := range symbols {
+		if s != symbol {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// prependSymbol moves (or adds) symbol to the front of a list, keeping at
+// most max entries.
+func prependSymbol(symbols []string, symbol string, max int) []string {
+	out := append([]string{symbol}, removeSymbol(symbols, symbol)...)
+	if len(out) > max {
+		out = out[:max]
+	}
+	return out
+}
+
+// HomeQuotes looks up every symbol on a user's Home tab in one go, reusing
+// the last answer if they opened it very recently.
+func HomeQuotes(teamID, userID string, symbols []string, ctx context.Context) (map[string]APIResult, error) {
+	key := prefsKey(teamID, userID) + ":" + strings.Join(symbols, ",")
+	if quotes, ok := homeQuotes.Get(key); ok {
+		return quotes.(map[string]APIResult), nil
+	}
+	quotes := map[string]APIResult{}
+	if len(symbols) > 0 {
+		results, err := YahooFromContext(ctx).GetTickers(symbols)
+		if err != nil {
+			return nil, err
+		}
+		for _, quote := range results {
+			quotes[quote.Symbol] = quote
+		}
+	}
+	homeQuotes.Set(key, quotes)
+	return quotes, nil
+}
+
+// homeQuoteLine describes one symbol on the Home tab.
+func homeQuoteLine(symbol string, quotes map[string]APIResult, l *Locale) string {
+	quote, ok := quotes[symbol]
+	if !ok || quote.RegularMarketPrice == 0 {
+		return l.Tf("*%s* _(no price available)_", symbol)
+	}
+	return fmt.Sprintf("*%s* %s %s _(%s)_", symbol,
+		l.Money(quote.RegularMarketPrice, quote.Currency),
+		l.Money(quote.RegularMarketChange, quote.Currency),
+		l.SignedPercent(quote.RegularMarketChangePercent))
+}
+
+// HomeView builds a user's Home tab: their favourites, with buttons to
+// remove them, followed by what they've looked up recently.
+func HomeView(prefs UserPrefs, quotes map[string]APIResult, l *Locale, now time.Time) map[string]interface{} {
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"type": "mrkdwn", "text": s}
+	}
+	header := func(s string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": "header",
+			"text": map[string]interface{}{"type": "plain_text", "text": s},
+		}
+	}
+
+	blocks := []map[string]interface{}{header(l.T("Favourites"))}
+	var favourites bytes.Buffer
+	var buttons []map[string]interface{}
+	for i, symbol := range prefs.Favourites {
+		fmt.Fprintln(&favourites, homeQuoteLine(symbol, quotes, l))
+		buttons = append(buttons, map[string]interface{}{
+			"type":      "button",
+			"action_id": fmt.Sprintf("home_remove_%d", i),
+			"text":      map[string]interface{}{"type": "plain_text", "text": l.Tf("Remove %s", symbol)},
+			"value":     symbol,
+		})
+	}
+	if favourites.Len() == 0 {
+		favourites.WriteString(l.T("Add one with `/ticker -fav AAPL`."))
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type": "section",
+		"text": text(strings.TrimSpace(favourites.String())),
+	})
+	if len(buttons) > 0 {
+		// Slack allows at most 25 elements in an actions block.
+		if len(buttons) > 25 {
+			buttons = buttons[:25]
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "actions",
+			"block_id": "home_favourites",
+			"elements": buttons,
+		})
+	}
+
+	blocks = append(blocks, map[string]interface{}{"type": "divider"},
+		header(l.T("Recent lookups")))
+	var recent bytes.Buffer
+	for _, symbol := range prefs.Recent {
+		fmt.Fprintln(&recent, homeQuoteLine(symbol, quotes, l))
+	}
+	if recent.Len() == 0 {
+		recent.WriteString(l.T("Nothing yet; try `/ticker AAPL`."))
+	}
+	blocks = append(blocks, map[string]interface{}{
+		"type": "section",
+		"text": text(strings.TrimSpace(recent.String())),
+	}, map[string]interface{}{
+		"type": "context",
+		"elements": []map[string]interface{}{
+			text(l.Tf("Updated <!date^%d^{date_short_pretty} {time}|%s>",
+				now.Unix(), now.UTC().Format(l.DateTimeFormat))),
+		},
+	})
+	return map[string]interface{}{
+		"type":   "home",
+		"blocks": blocks,
+	}
+}
+
+// PublishHome refreshes a user's Home tab.
+func PublishHome(ctx context.Context, teamID, userID string) error {
+	inst, ok := InstallationFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("No installation for %s", teamID)
+	}
+	prefs := Prefs.Get(teamID, userID)
+	var symbols []string
+	for _, symbol := range append(append([]string{}, prefs.Favourites...), prefs.Recent...) {
+		if !containsSymbol(symbols, symbol) {
+			symbols = append(symbols, symbol)
+		}
+	}
+	quotes, err := HomeQuotes(teamID, userID, symbols, ctx)
+	if err != nil {
+		// Still show them their lists, just without prices.
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		quotes = map[string]APIResult{}
+	}
+	return SlackFromContext(ctx).PublishView(inst.BotToken, userID, HomeView(prefs, quotes, LocaleFor(teamID, userID), time.Now()))
+}
+
+// AppHomeOpened publishes a fresh Home tab whenever a user opens it.
+func AppHomeOpened(ctx context.Context, env EventEnvelope) error {
+	var event struct {
+		User string `json:"user"`
+		Tab  string `json:"tab"`
+	}
+	if err := json.Unmarshal(env.Event, &event); err != nil {
+		return err
+	}
+	if event.Tab != "home" {
+		return nil
+	}
+	return PublishHome(ctx, env.TeamID, event.User)
+}
+
+// HomeFavouriteAction removes a favourite from the Home tab, and then
+// refreshes it.
+func HomeFavouriteAction(ctx context.Context, p InteractionPayload, action BlockAction) error {
+	if err := RemoveFavourite(p.Team.ID, p.User.ID, action.Value); err != nil {
+		return err
+	}
+	return PublishHome(ctx, p.Team.ID, p.User.ID)
+}
@@ -0,0 +1,112 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrependSymbol(t *testing.T) {
+	recent := prependSymbol([]string{"A", "B", "C"}, "B", 3)
+	if !reflect.DeepEqual(recent, []string{"B", "A", "C"}) {
+		t.Errorf("expected [B A C], got %v", recent)
+	}
+	recent = prependSymbol(recent, "D", 3)
+	if !reflect.DeepEqual(recent, []string{"D", "B", "A"}) {
+		t.Errorf("expected [D B A], got %v", recent)
+	}
+}
+
+func TestAppHomeOpened(t *testing.T) {
+	var quoteCalls int
+	var symbols string
+	qs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quoteCalls++
+		symbols = r.URL.Query().Get("symbols")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"quoteResponse":{"result":[`+
+			`{"symbol":"AAPL","currency":"USD","regularMarketPrice":150,"regularMarketChange":1.5,"regularMarketChangePercent":1.01},`+
+			`{"symbol":"MSFT","currency":"USD","regularMarketPrice":300}]}}`)
+	}))
+	defer qs.Close()
+	var published []string
+	ss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			UserID string `json:"user_id"`
+			View   struct {
+				Blocks []map[string]interface{} `json:"blocks"`
+			} `json:"view"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		blocks, _ := json.Marshal(request.View.Blocks)
+		published = append(published, request.UserID+" "+string(blocks))
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ss.Close()
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	homeQuotes = NewCache(time.Minute)
+	inst := Installation{TeamID: "T1", BotToken: "xoxb-1"}
+	ctx := WithInstallation(context.WithValue(context.Background(), requestIDKey, uint64(0)), inst)
+	ctx = WithYahoo(ctx, NewYahoo(qs.URL))
+	ctx = WithSlack(ctx, NewSlack(ss.URL))
+
+	AddFavourite("T1", "U1", "AAPL")
+	RecordLookup("T1", "U1", "MSFT")
+	RecordLookup("T1", "U1", "AAPL")
+	env := EventEnvelope{TeamID: "T1",
+		Event: json.RawMessage(`{"type":"app_home_opened","user":"U1","tab":"home"}`)}
+	for i := 0; i < 2; i++ {
+		if err := AppHomeOpened(ctx, env); err != nil {
+			t.Fatal("AppHomeOpened failed:", err)
+		}
+	}
+	if quoteCalls != 1 || symbols != "AAPL,MSFT" {
+		t.Errorf("expected one batched lookup of AAPL,MSFT, got %d of %s", quoteCalls, symbols)
+	}
+	if len(published) != 2 || !strings.HasPrefix(published[0], "U1 ") ||
+		!strings.Contains(published[0], "*AAPL* $150.00 $1.50") ||
+		!strings.Contains(published[0], "Remove AAPL") {
+		t.Errorf("unexpected Home tab: %v", published)
+	}
+
+	env.Event = json.RawMessage(`{"type":"app_home_opened","user":"U1","tab":"messages"}`)
+	AppHomeOpened(ctx, env)
+	if len(published) != 2 {
+		t.Errorf("expected the messages tab to be ignored")
+	}
+
+	RemoveFavourite("T1", "U1", "AAPL")
+	if prefs := Prefs.Get("T1", "U1"); len(prefs.Favourites) != 0 {
+		t.Errorf("expected no favourites, got %v", prefs.Favourites)
+	}
+}
+
+func TestGermanHomeView(t *testing.T) {
+	quotes := map[string]APIResult{"AAPL": {Symbol: "AAPL", Currency: "USD",
+		RegularMarketPrice: 1150, RegularMarketChange: -1.5, RegularMarketChangePercent: -0.13}}
+	view := HomeView(UserPrefs{Favourites: []string{"AAPL"}, Recent: []string{"MSFT"}},
+		quotes, German, time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC))
+	blocks, _ := json.Marshal(view["blocks"])
+	for _, expected := range []string{
+		`"text":"Favoriten"`,
+		"*AAPL* 1.150,00 $ -1,50 $ _(-0,13 %)_",
+		"AAPL entfernen",
+		"*MSFT* _(kein Kurs verfügbar)_",
+		"|19.10.26 14:30 UTC",
+	} {
+		if !strings.Contains(string(blocks), expected) {
+			t.Errorf("expected %q in %s", expected, blocks)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The destinations we make requests to, which can each be given their own
+// timeout under [HTTPTimeouts].
+const (
+	destinationYahoo     = "yahoo"
+	destinationSlack     = "slack"
+	destinationResponses = "responses"
+	destinationWebhooks  = "webhooks"
+)
+
+var httpDestinations = []string{
+	destinationYahoo,
+	destinationSlack,
+	destinationResponses,
+	destinationWebhooks,
+}
+
+// NewTransport builds the transport all our outbound requests share, so
+// connections to the same host are reused. Requests go through proxy if it
+// is set, or else whatever HTTP_PROXY, HTTPS_PROXY and NO_PROXY say. The
+// certificates in the PEM file caBundle, if set, are trusted on top of the
+// system's.
+func NewTransport(proxy, caBundle string) (*http.Transport, error) {
+	// These are http.DefaultTransport's settings, which can't be copied
+	// before Go 1.13.
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("HTTPProxy: %s", err)
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("HTTPProxy: '%s' isn't a URL", proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if caBundle != "" {
+		pem, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("CABundle: %s", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CABundle: no certificates found in %s", caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+	return transport, nil
+}
+
+// redactedProxy hides the password in a proxy URL, if it has one.
+func redactedProxy(proxy string) string {
+	u, err := url.Parse(proxy)
+	if err != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
+
+// ValidateHTTPTimeouts checks that [HTTPTimeouts] only names destinations we
+// know about.
+func ValidateHTTPTimeouts(config *Configuration) error {
+	for destination, seconds := range config.HTTPTimeouts {
+		known := false
+		for _, d := range httpDestinations {
+			known = known || d == destination
+		}
+		if !known {
+			return fmt.Errorf("HTTPTimeouts: unknown destination '%s' (expected one of %v)",
+				destination, httpDestinations)
+		}
+		if seconds < 0 {
+			return fmt.Errorf("HTTPTimeouts: %s must be zero (for HTTPClientTimeout) or more", destination)
+		}
+	}
+	return nil
+}
+
+// Timeout is how long to wait for requests to a destination.
+func (c *Configuration) Timeout(destination string) time.Duration {
+	if seconds := c.HTTPTimeouts[destination]; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return c.HTTPClientTimeout
+}
+
+// Transport is what requests to the outside world are made through: the
+// transport built from the configuration, or a default one if there wasn't
+// a configuration file. Providers such as Yahoo can be given their own.
+func (c *Configuration) Transport() http.RoundTripper {
+	if c.transport != nil {
+		return c.transport
+	}
+	return http.DefaultTransport
+}
+
+// userAgentTransport identifies us, and our version, on requests that don't
+// say who they're from already.
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", versionString())
+	}
+	return t.next.RoundTrip(req)
+}
+
+// providerClient returns an HTTP client for requests to the named provider,
+// whose health is tracked, with the timeout for its destination.
+func providerClient(name, destination string) *http.Client {
+	return providerClientVia(name, destination, Config().Transport())
+}
+
+// providerClientVia is providerClient, making its requests through the
+// given transport rather than the configured one.
+func providerClientVia(name, destination string, transport http.RoundTripper) *http.Client {
+	return &http.Client{
+		Timeout: Config().Timeout(destination),
+		Transport: providerTransport{
+			name: name,
+			next: userAgentTransport{next: transport},
+		},
+	}
+}
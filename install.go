@@ -0,0 +1,103 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const installationKey uint64 = 1
+
+// Installation records everything we learned about a workspace when the app
+// was installed into it via the OAuth flow.
+type Installation struct {
+	TeamID       string
+	TeamName     string
+	EnterpriseID string
+	AppID        string
+	BotUserID    string
+	BotToken     string
+	Scope        string
+	InstalledBy  string
+	InstalledAt  time.Time
+}
+
+// InstallationStore is a persistent, concurrency-safe map of Slack team IDs
+// to their installations.
+type InstallationStore struct {
+	sync.RWMutex
+	path  string
+	teams map[string]Installation
+}
+
+// NewInstallationStore creates an empty store backed by the file at path. If
+// path is empty, installations are only kept in memory.
+func NewInstallationStore(path string) *InstallationStore {
+	return &InstallationStore{
+		path:  path,
+		teams: map[string]Installation{},
+	}
+}
+
+// Load replaces the contents of the store with what is saved on disk.
+func (s *InstallationStore) Load() error {
+	teams := map[string]Installation{}
+	if err := loadJSONFile(s.path, &teams); err != nil {
+		return err
+	}
+	s.Lock()
+	s.teams = teams
+	s.Unlock()
+	return nil
+}
+
+// Get returns the installation for a team, if there is one.
+func (s *InstallationStore) Get(teamID string) (Installation, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	inst, ok := s.teams[teamID]
+	return inst, ok
+}
+
+// Save adds or replaces the installation for a team, and persists the store.
+func (s *InstallationStore) Save(inst Installation) error {
+	s.Lock()
+	defer s.Unlock()
+	s.teams[inst.TeamID] = inst
+	return saveJSONFile(s.path, s.teams)
+}
+
+// Delete removes the installation for a team (on uninstall, for example),
+// and persists the store.
+func (s *InstallationStore) Delete(teamID string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.teams[teamID]; !ok {
+		return nil
+	}
+	delete(s.teams, teamID)
+	return saveJSONFile(s.path, s.teams)
+}
+
+// Len returns the number of installed workspaces.
+func (s *InstallationStore) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+	return len(s.teams)
+}
+
+// WithInstallation attaches a workspace installation to a context.
+func WithInstallation(ctx context.Context, inst Installation) context.Context {
+	return context.WithValue(ctx, installationKey, inst)
+}
+
+// InstallationFromContext retrieves the workspace installation attached to
+// a context, if any.
+func InstallationFromContext(ctx context.Context) (Installation, bool) {
+	inst, ok := ctx.Value(installationKey).(Installation)
+	return inst, ok
+}
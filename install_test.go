@@ -0,0 +1,60 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallationStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "installations.json")
+
+	s := NewInstallationStore(path)
+	if err := s.Load(); err != nil {
+		t.Error("Loading a missing store failed:", err)
+	}
+	if err := s.Save(Installation{TeamID: "T1", BotToken: "xoxb-1"}); err != nil {
+		t.Fatal("Saving installation failed:", err)
+	}
+	if err := s.Save(Installation{TeamID: "T2", BotToken: "xoxb-2"}); err != nil {
+		t.Fatal("Saving installation failed:", err)
+	}
+
+	s = NewInstallationStore(path)
+	if err := s.Load(); err != nil {
+		t.Fatal("Reloading store failed:", err)
+	}
+	if s.Len() != 2 {
+		t.Errorf("expected 2 installations, got %d", s.Len())
+	}
+	if inst, ok := s.Get("T2"); !ok || inst.BotToken != "xoxb-2" {
+		t.Errorf("expected T2 with xoxb-2, got %+v", inst)
+	}
+	if err := s.Delete("T2"); err != nil {
+		t.Error("Deleting installation failed:", err)
+	}
+	if _, ok := s.Get("T2"); ok {
+		t.Error("T2 still installed after delete")
+	}
+}
+
+func TestInstallationContext(t *testing.T) {
+	if _, ok := InstallationFromContext(context.Background()); ok {
+		t.Error("found an installation in an empty context")
+	}
+	ctx := WithInstallation(context.Background(), Installation{TeamID: "T1"})
+	if inst, ok := InstallationFromContext(ctx); !ok || inst.TeamID != "T1" {
+		t.Errorf("expected T1, got %+v", inst)
+	}
+}
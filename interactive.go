@@ -0,0 +1,177 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// InteractionPayload is the subset of a Slack interactivity payload (a
+// button click, for example) that we care about.
+type InteractionPayload struct {
+	Type string `json:"type"`
+	Team struct {
+		ID     string `json:"id"`
+		Domain string `json:"domain"`
+	} `json:"team"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Channel struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"channel"`
+	TriggerID   string        `json:"trigger_id"`
+	ResponseURL string        `json:"response_url"`
+	Actions     []BlockAction `json:"actions"`
+	View        View          `json:"view"`
+}
+
+// View is the subset of a Block Kit view (a modal or a Home tab) that comes
+// back to us in interactivity payloads.
+type View struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	CallbackID      string    `json:"callback_id"`
+	PrivateMetadata string    `json:"private_metadata"`
+	State           ViewState `json:"state"`
+}
+
+// ViewState holds the values of every input in a view, keyed by block ID
+// and then action ID.
+type ViewState struct {
+	Values map[string]map[string]ViewValue `json:"values"`
+}
+
+// ViewValue is the current value of a single input element.
+type ViewValue struct {
+	Type           string `json:"type"`
+	Value          string `json:"value"`
+	SelectedOption *struct {
+		Value string `json:"value"`
+	} `json:"selected_option,omitempty"`
+	SelectedOptions []struct {
+		Value string `json:"value"`
+	} `json:"selected_options,omitempty"`
+}
+
+// Value returns the value of the input in the given block, whatever kind of
+// element it is, or an empty string if there isn't one.
+func (s ViewState) Value(blockID, actionID string) string {
+	v := s.Values[blockID][actionID]
+	if v.SelectedOption != nil {
+		return v.SelectedOption.Value
+	}
+	if len(v.SelectedOptions) > 0 {
+		return v.SelectedOptions[0].Value
+	}
+	return v.Value
+}
+
+// BlockAction is a single interaction with a Block Kit element.
+type BlockAction struct {
+	ActionID string `json:"action_id"`
+	BlockID  string `json:"block_id"`
+	Value    string `json:"value"`
+}
+
+// BlockActionHandler processes an interaction with an element of a block.
+type BlockActionHandler func(ctx context.Context, p InteractionPayload, action BlockAction) error
+
+// BlockActions are the blocks we know how to handle interactions with,
+// keyed by block ID.
+var BlockActions = map[string]BlockActionHandler{
+	"ticker_search":   TickerSearchAction,
+	"home_favourites": HomeFavouriteAction,
+}
+
+// ViewSubmissionHandler processes the submission of a modal. It returns the
+// response_action payload to send back to Slack (to show validation errors,
+// for example), or nil to simply close the modal.
+type ViewSubmissionHandler func(ctx context.Context, p InteractionPayload) (map[string]interface{}, error)
+
+// ViewSubmissions are the modals we know how to handle submissions of, keyed
+// by callback ID.
+var ViewSubmissions = map[string]ViewSubmissionHandler{
+	"portfolio_import": PortfolioImportSubmission,
+	"ticker_options":   TickerOptionsSubmission,
+}
+
+// ViewErrors builds the response_action payload that shows validation
+// errors next to the offending inputs of a modal, keyed by block ID.
+func ViewErrors(errs map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"response_action": "errors",
+		"errors":          errs,
+	}
+}
+
+// InteractionDispatcher validates Slack interactivity requests, and routes
+// them to an appropriate handler.
+func InteractionDispatcher(w http.ResponseWriter, req *http.Request) error {
+	if req.Method != "POST" {
+		return StatusError{http.StatusBadRequest,
+			errors.New("Only POST is supported")}
+	}
+	if err := VerifySlackSignature(req); err != nil {
+		return StatusError{http.StatusUnauthorized, err}
+	}
+
+	var p InteractionPayload
+	if err := json.Unmarshal([]byte(req.FormValue("payload")), &p); err != nil {
+		return StatusError{http.StatusBadRequest,
+			fmt.Errorf("Could not decode interaction: %s", err)}
+	}
+	ctx := req.Context()
+	if inst, ok := Installations.Get(p.Team.ID); ok {
+		ctx = WithInstallation(ctx, inst)
+	}
+	rid := RequestID(ctx)
+
+	switch p.Type {
+	case "block_actions":
+		for _, action := range p.Actions {
+			handler, ok := BlockActions[action.BlockID]
+			if !ok {
+				log.Printf("[%d] Ignoring action %s/%s", rid,
+					action.BlockID, action.ActionID)
+				continue
+			}
+			log.Printf("[%d] %s@%s %s/%s %s", rid, p.User.Username,
+				p.Team.Domain, action.BlockID, action.ActionID,
+				action.Value)
+			if err := handler(ctx, p, action); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "view_submission":
+		handler, ok := ViewSubmissions[p.View.CallbackID]
+		if !ok {
+			return StatusError{http.StatusBadRequest,
+				fmt.Errorf("View '%s' is invalid", p.View.CallbackID)}
+		}
+		log.Printf("[%d] %s@%s submitted %s", rid, p.User.Username,
+			p.Team.Domain, p.View.CallbackID)
+		response, err := handler(ctx, p)
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			return WriteSlackResponse(w, response)
+		}
+		return nil
+	case "view_closed":
+		return nil
+	}
+	return StatusError{http.StatusBadRequest,
+		fmt.Errorf("Interaction type '%s' is invalid", p.Type)}
+}
@@ -0,0 +1,53 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestInteractionDispatcher(t *testing.T) {
+	SetConfig(Configuration{})
+	Installations = NewInstallationStore("")
+	var clicked string
+	BlockActions["test_block"] = func(ctx context.Context, p InteractionPayload, action BlockAction) error {
+		clicked = p.User.ID + ":" + action.Value
+		return nil
+	}
+	defer delete(BlockActions, "test_block")
+
+	tests := []struct {
+		payload string
+		valid   bool
+		clicked string
+	}{
+		{`{"type":"block_actions","user":{"id":"U1"},"actions":[{"block_id":"test_block","value":"AAPL"}]}`,
+			true, "U1:AAPL"},
+		{`{"type":"block_actions","user":{"id":"U1"},"actions":[{"block_id":"other_block","value":"AAPL"}]}`,
+			true, ""},
+		{`{"type":"bogus"}`, false, ""},
+		{`{`, false, ""},
+	}
+	for i, test := range tests {
+		clicked = ""
+		form := url.Values{"payload": {test.payload}}
+		req := httptest.NewRequest("POST", "/interactive", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		err := InteractionDispatcher(w, req.WithContext(NewContext(req.Context(), req)))
+		if test.valid && err != nil {
+			t.Errorf("%d. expected interaction to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected interaction to be invalid", i)
+		}
+		if clicked != test.clicked {
+			t.Errorf("%d. expected click %q, got %q", i, test.clicked, clicked)
+		}
+	}
+}
@@ -0,0 +1,569 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Locale is a language to answer in, and the conventions for writing
+// numbers, money and dates that go with it.
+type Locale struct {
+	Tag  string
+	Name string // in its own language
+	// Decimal separates whole numbers from fractions, and Group (if set)
+	// separates thousands.
+	Decimal string
+	Group   string
+	// SymbolAfter puts currency symbols after amounts, like "150,00 $"
+	// rather than "$150.00".
+	SymbolAfter bool
+	// PercentSpace puts a space before percent signs.
+	PercentSpace bool
+	// DateTimeFormat, TimeFormat and ShortTimeFormat are time.Format
+	// layouts for a full timestamp, a time of day, and a recent date and
+	// time.
+	DateTimeFormat  string
+	TimeFormat      string
+	ShortTimeFormat string
+	// DateFormat, WeekdayDateFormat and MonthFormat are time.Format
+	// layouts for a day, a day along with its weekday, and a month. Go only
+	// knows the English names of months and days, so other locales write
+	// them as numbers.
+	DateFormat        string
+	WeekdayDateFormat string
+	MonthFormat       string
+	// Messages translates our English messages, including format
+	// strings, into this locale. Anything missing is left in English.
+	Messages map[string]string
+}
+
+// English is the locale we answer in unless asked otherwise. Its catalog is
+// empty: messages are written in English to begin with.
+var English = &Locale{
+	Tag:               "en",
+	Name:              "English",
+	Decimal:           ".",
+	DateTimeFormat:    "02 Jan 06 15:04 MST",
+	TimeFormat:        "3:04PM MST",
+	ShortTimeFormat:   "Jan 2 3:04PM MST",
+	DateFormat:        "Jan 2, 2006",
+	WeekdayDateFormat: "Mon Jan 2, 2006",
+	MonthFormat:       "Jan 2006",
+}
+
+// German is the German locale.
+var German = &Locale{
+	Tag:               "de",
+	Name:              "Deutsch",
+	Decimal:           ",",
+	Group:             ".",
+	SymbolAfter:       true,
+	PercentSpace:      true,
+	DateTimeFormat:    "02.01.06 15:04 MST",
+	TimeFormat:        "15:04 MST",
+	ShortTimeFormat:   "2.1. 15:04 MST",
+	DateFormat:        "2.1.2006",
+	WeekdayDateFormat: "2.1.2006",
+	MonthFormat:       "01.2006",
+	Messages: map[string]string{
+		// Command usage.
+		"*Usage:* `%s`":                    "*Aufruf:* `%s`",
+		"[flags]":                          "[Optionen]",
+		"*Flags:*":                         "*Optionen:*",
+		"*Commands:*":                      "*Befehle:*",
+		"(default `%s`)":                   "(Standard `%s`)",
+		"*Error:* %s":                      "*Fehler:* %s",
+		"unknown command '%s'":             "unbekannter Befehl '%s'",
+		"only show the answer to you":      "Antwort nur dir zeigen",
+		"unterminated quote":               "Anführungszeichen nicht geschlossen",
+		"trailing backslash":               "Backslash am Ende",
+		"`%s` has been turned off for now": "`%s` ist gerade abgeschaltet",
+		"Sorry, only admins can use `%s`":  "Nur Admins dürfen `%s` verwenden",
+		"An error occurred running `%s`":   "Beim Ausführen von `%s` ist ein Fehler aufgetreten",
+
+		// /ticker usage and validation.
+		"symbol": "Symbol",
+		"Look up a stock, index, future, fund, currency or coin.":                           "Kurs einer Aktie, eines Index, Futures, Fonds, einer Währung oder Kryptowährung abfragen.",
+		"chart `period` [xd|xY]":                                                            "`Zeitraum` des Charts [xd|xY]",
+		"chart interval in `seconds`":                                                       "Intervall des Charts in `Sekunden`",
+		"chart `type` [line|bar|candle]":                                                    "`Art` des Charts [line|bar|candle]",
+		"use a logarithmic chart scale":                                                     "logarithmische Skala verwenden",
+		"search for symbols matching a name":                                                "nach Symbolen zu einem Namen suchen",
+		"show valuation and earnings data":                                                  "Bewertungs- und Gewinndaten zeigen",
+		"add the symbol to your favourites":                                                 "Symbol zu deinen Favoriten hinzufügen",
+		"remove the symbol from your favourites":                                            "Symbol aus deinen Favoriten entfernen",
+		"show prices on a past `date` [YYYY-MM-DD]":                                         "Kurse an einem vergangenen `Datum` zeigen [YYYY-MM-DD]",
+		"show prices over a past `range` [YYYY-MM-DD:YYYY-MM-DD]":                           "Kurse über einen vergangenen `Zeitraum` zeigen [YYYY-MM-DD:YYYY-MM-DD]",
+		"answer in another `language` [en|de|default]":                                      "in einer anderen `Sprache` antworten [en|de|default]",
+		"nothing to search for":                                                             "nichts zu suchen",
+		"period must be a positive number (followed by [d|Y])":                              "der Zeitraum muss eine positive Zahl sein (gefolgt von [d|Y])",
+		"period must be one of 'd' (days) or 'Y' (years)":                                   "der Zeitraum muss 'd' (Tage) oder 'Y' (Jahre) sein",
+		"interval must be zero or more seconds":                                             "das Intervall muss null oder mehr Sekunden sein",
+		"interval must be a number of seconds":                                              "das Intervall muss eine Anzahl Sekunden sein",
+		"chart type must be one of 'line', 'bar' or 'candle'":                               "die Art des Charts muss 'line', 'bar' oder 'candle' sein",
+		"no ticker symbol specified":                                                        "kein Tickersymbol angegeben",
+		"only one ticker symbol at a time":                                                  "nur ein Tickersymbol auf einmal",
+		"Invalid ticker symbol (like AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD or EURUSD=X)": "Ungültiges Tickersymbol (wie AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD oder EURUSD=X)",
+		"-locale doesn't take a symbol":                                                     "-locale nimmt kein Symbol",
+		"unknown locale '%s' (try %s)":                                                      "unbekannte Sprache '%s' (versuche %s)",
+		"Added *%s* to your favourites":                                                     "*%s* zu deinen Favoriten hinzugefügt",
+		"Removed *%s* from your favourites":                                                 "*%s* aus deinen Favoriten entfernt",
+		"Replies to you will now be in %s.":                                                 "Antworten an dich sind jetzt auf %s.",
+		"Replies to you will now be in the workspace's language, %s.":                       "Antworten an dich sind jetzt in der Sprache des Workspace, %s.",
+
+		"show the most looked-up symbols this week": "die meistgesuchten Symbole dieser Woche zeigen",
+		"-top doesn't take a symbol":                "-top nimmt kein Symbol",
+
+		// /ticker answers.
+		"(%d lookups)": "(%d Abfragen)",
+		"This workspace has opted out of lookup statistics":              "Dieser Workspace hat Abfragestatistiken abgeschaltet",
+		"Nobody has looked anything up this week":                        "Diese Woche hat noch niemand etwas abgefragt",
+		"*Most looked-up symbols this week:*":                            "*Die meistgesuchten Symbole dieser Woche:*",
+		"*Last week on slacker:* %d lookups by %d people in %d channels": "*Letzte Woche bei slacker:* %d Abfragen von %d Personen in %d Kanälen",
+		"Busiest channel: <#%s>. Busiest hour: %02d:00 UTC.":             "Aktivster Kanal: <#%s>. Aktivste Stunde: %02d:00 UTC.",
+		"An error occurred looking up _%s_":                              "Beim Abrufen von _%s_ ist ein Fehler aufgetreten",
+		"Unknown ticker symbol _%s_":                                     "Unbekanntes Tickersymbol _%s_",
+		"An error occurred searching for _%s_":                           "Bei der Suche nach _%s_ ist ein Fehler aufgetreten",
+		"Nothing found matching _%s_":                                    "Nichts gefunden für _%s_",
+		"Symbols matching _%s_:":                                         "Symbole für _%s_:",
+		"%s. Did you mean one of these?":                                 "%s. Meintest du eines davon?",
+		"up %s":                                                          "plus %s",
+		"down %s":                                                        "minus %s",
+		"unchanged":                                                      "unverändert",
+		"in 24 hours":                                                    "in 24 Stunden",
+		"from previous close of %s":                                      "gegenüber dem Schlusskurs von %s",
+		"from previous NAV of %s":                                        "gegenüber dem letzten NAV von %s",
+		"as of %s":                                                       "Stand %s",
+		"(%s exchange time)":                                             "(%s Börsenzeit)",
+		"Pre-market":                                                     "Vorbörslich",
+		"After hours":                                                    "Nachbörslich",
+		"%s: *%s* _(%s)_ as of %s":                                       "%s: *%s* _(%s)_ Stand %s",
+
+		// The /ticker modal.
+		"Look up a quote": "Kurs abfragen",
+		"Look up":         "Abfragen",
+		"Cancel":          "Abbrechen",
+		"Symbol":          "Symbol",
+		"Like AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD or EURUSD=X": "Wie AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD oder EURUSD=X",
+		"Chart period": "Zeitraum des Charts",
+		"A number of days or years, like 5d or 1Y": "Eine Anzahl Tage oder Jahre, wie 5d oder 1Y",
+		"Chart interval": "Intervall des Charts",
+		"In seconds":     "In Sekunden",
+		"Chart type":     "Art des Charts",
+		"Line":           "Linie",
+		"Bar":            "Balken",
+		"Candle":         "Kerzen",
+		"Scale":          "Skala",
+		"Logarithmic":    "Logarithmisch",
+
+		// Numbers.
+		"%sT": "%s Bio.",
+		"%sB": "%s Mrd.",
+		"%sM": "%s Mio.",
+		"%sK": "%s Tsd.",
+
+		// Quote fields and /ticker -detail.
+		"Market Cap":                "Marktkapitalisierung",
+		"Day Range":                 "Tagesspanne",
+		"Contract":                  "Kontrakt",
+		"Underlying":                "Basiswert",
+		"Open Interest":             "Offene Kontrakte",
+		"Net Assets":                "Fondsvermögen",
+		"YTD Return":                "Rendite seit Jahresbeginn",
+		"24h Change":                "Änderung 24h",
+		"24h Volume":                "Volumen 24h",
+		"Circulating Supply":        "Umlaufmenge",
+		"Fundamentals":              "Kennzahlen",
+		"No fundamentals available": "Keine Kennzahlen verfügbar",
+		"_No fundamentals available for this symbol._": "_Für dieses Symbol sind keine Kennzahlen verfügbar._",
+		"Shares Outstanding":                           "Ausstehende Aktien",
+		"P/E (TTM)":                                    "KGV (12M)",
+		"Forward P/E":                                  "Erwartetes KGV",
+		"EPS (TTM)":                                    "Gewinn je Aktie (12M)",
+		"Forward EPS":                                  "Erwarteter Gewinn je Aktie",
+		"Price/Book":                                   "Kurs-Buchwert-Verhältnis",
+		"Earnings":                                     "Quartalszahlen",
+		"52-Week Range":                                "52-Wochen-Spanne",
+		"%s - %s (%s from high)":                       "%s - %s (%s vom Hoch)",
+		"50-Day Average":                               "50-Tage-Durchschnitt",
+		"200-Day Average":                              "200-Tage-Durchschnitt",
+		"Volume":                                       "Volumen",
+		"Avg. Volume (3M)":                             "Durchschn. Volumen (3M)",
+		"%s - %s (estimated)":                          "%s - %s (geschätzt)",
+		"%s (estimated)":                               "%s (geschätzt)",
+		"%s (last reported)":                           "%s (zuletzt gemeldet)",
+
+		// /ticker -on and -range.
+		"Open":         "Eröffnung",
+		"Close":        "Schluss",
+		"High":         "Hoch",
+		"Low":          "Tief",
+		"Total Return": "Gesamtrendite",
+		"No trading history for _%s_ on or before %s":   "Kein Handel mit _%s_ am oder vor dem %s",
+		"%s _(nearest session before %s)_":              "%s _(letzter Handelstag vor dem %s)_",
+		"%s on %s: open %s, high %s, low %s, close %s":  "%s am %s: Eröffnung %s, Hoch %s, Tief %s, Schluss %s",
+		":calendar: *%s* on %s":                         ":calendar: *%s* am %s",
+		"%s from %s to %s: %s to %s (%s)":               "%s vom %s bis %s: %s auf %s (%s)",
+		":calendar: *%s* from %s to %s":                 ":calendar: *%s* vom %s bis %s",
+		"use either -on or -range, not both":            "entweder -on oder -range verwenden, nicht beides",
+		"-on takes a date like 2024-03-15":              "-on nimmt ein Datum wie 2024-03-15",
+		"-range takes dates like 2024-01-01:2024-06-30": "-range nimmt Daten wie 2024-01-01:2024-06-30",
+		"the start of a -range must be before its end":  "der Anfang von -range muss vor seinem Ende liegen",
+		"no date given":                                 "kein Datum angegeben",
+		"that hasn't happened yet":                      "das ist noch nicht passiert",
+
+		// /fx.
+		"[amount] from to": "[Betrag] von nach",
+		"Convert between currencies, or choose one to also see /ticker prices in.": "Zwischen Währungen umrechnen, oder eine wählen, in der /ticker Kurse auch zeigt.",
+		"`currency` to also show /ticker prices in [ISO 4217 code, or none]":       "`Währung`, in der /ticker Kurse auch zeigt [ISO-4217-Code, oder none]",
+		"currencies are three-letter codes, like USD or EUR":                       "Währungen sind Codes aus drei Buchstaben, wie USD oder EUR",
+		"amount must be a positive number":                                         "der Betrag muss eine positive Zahl sein",
+		"need a currency to convert from and to":                                   "es fehlt eine Währung, von der und in die umgerechnet wird",
+		"Ticker prices will only be shown in their own currency.":                  "Tickerkurse werden nur in ihrer eigenen Währung gezeigt.",
+		"Ticker prices will also be shown in %s.":                                  "Tickerkurse werden auch in %s gezeigt.",
+
+		// /crypto.
+		"coin":                      "Coin",
+		"Look up a cryptocurrency.": "Kurs einer Kryptowährung abfragen.",
+		"`currency` to quote the coin in [ISO 4217 code]": "`Währung`, in der der Coin notiert wird [ISO-4217-Code]",
+		"no coin specified":                       "kein Coin angegeben",
+		"only one coin at a time":                 "nur ein Coin auf einmal",
+		"Invalid coin (like BTC, ETH or BTC-EUR)": "Ungültiger Coin (wie BTC, ETH oder BTC-EUR)",
+
+		// /slacker.
+		"Look after slacker (admins only).":                                 "slacker verwalten (nur Admins).",
+		"Show how slacker is doing.":                                        "Zeigen, wie es slacker geht.",
+		"Show the configuration, without secrets.":                          "Die Konfiguration zeigen, ohne Geheimnisse.",
+		"Show how the caches are doing.":                                    "Zeigen, wie es den Caches geht.",
+		"Show how the services slacker relies on are doing.":                "Zeigen, wie es den Diensten geht, die slacker nutzt.",
+		"Load the configuration file again.":                                "Die Konfigurationsdatei neu laden.",
+		"command":                                                           "Befehl",
+		"Turn a command off until it's enabled again, or slacker restarts.": "Einen Befehl abschalten, bis er wieder eingeschaltet wird oder slacker neu startet.",
+		"Turn a command that was disabled back on.":                         "Einen abgeschalteten Befehl wieder einschalten.",
+		"which command?":                                                    "welcher Befehl?",
+		"`%s` isn't a command we serve":                                     "`%s` ist kein Befehl, den wir anbieten",
+		"`%s` can't be turned off":                                          "`%s` kann nicht abgeschaltet werden",
+		"Turned `%s` off":                                                   "`%s` abgeschaltet",
+		"Turned `%s` on":                                                    "`%s` eingeschaltet",
+		"• Up for %s":                                                       "• Läuft seit %s",
+		"• Serving %s":                                                      "• Bietet %s an",
+		"• Turned off: %s":                                                  "• Abgeschaltet: %s",
+		"• Installed in %d workspaces":                                      "• In %d Workspaces installiert",
+		"• %d answers waiting to be delivered":                              "• %d Antworten warten auf Zustellung",
+		"• %d goroutines, %s of heap":                                       "• %d Goroutinen, %s Heap",
+		"Home tab quotes":                                                   "Kurse im Home-Tab",
+		"User timezones":                                                    "Zeitzonen der Nutzer",
+		"• *%s:* %d entries, %d hits, %d misses":                            "• *%s:* %d Einträge, %d Treffer, %d Fehlschläge",
+		"No requests made to other services yet":                            "Noch keine Anfragen an andere Dienste",
+		"• :white_check_mark: *%s:* OK (%dms)":                              "• :white_check_mark: *%s:* OK (%d ms)",
+		"• :x: *%s:* failing since %s: %s":                                  "• :x: *%s:* fehlerhaft seit %s: %s",
+		", %d of %d requests failed":                                        ", %d von %d Anfragen fehlgeschlagen",
+		"couldn't reload %s: %s":                                            "%s konnte nicht neu geladen werden: %s",
+		"Reloaded %s":                                                       "%s neu geladen",
+		"[symbol]":                                                          "[Symbol]",
+		"Show who asked for what, most recent first.":                       "Zeigen, wer was abgefragt hat, das Neueste zuerst.",
+		"only show commands run by a `user` (like U0123ABCD or @someone)":   "nur Befehle eines `Nutzers` zeigen (wie U0123ABCD oder @jemand)",
+		"only show commands since a `time` (YYYY-MM-DD, RFC 3339, or a duration ago like 24h)": "nur Befehle seit einem `Zeitpunkt` zeigen (YYYY-MM-DD, RFC 3339, oder eine Dauer zurück wie 24h)",
+		"only show commands before a `time`":                                                   "nur Befehle vor einem `Zeitpunkt` zeigen",
+		"show at most this many `entries`":                                                     "höchstens so viele `Einträge` zeigen",
+		"only one symbol at a time":                                                            "nur ein Symbol auf einmal",
+		"'%s' is not a date (YYYY-MM-DD), time (RFC 3339) or duration (like 24h)":              "'%s' ist kein Datum (YYYY-MM-DD), Zeitpunkt (RFC 3339) oder Dauer (wie 24h)",
+		"The audit log isn't kept without a DataDir":                                           "Ohne DataDir wird kein Audit-Log geführt",
+		"No matching commands in the audit log":                                                "Keine passenden Befehle im Audit-Log",
+		"*Audit log* (%d most recent)":                                                         "*Audit-Log* (die %d neuesten)",
+		"`%s` <@%s> in <#%s> `%s` %s, %dms":                                                    "`%s` <@%s> in <#%s> `%s` %s, %d ms",
+
+		// The Home tab.
+		"*%s* _(no price available)_":                      "*%s* _(kein Kurs verfügbar)_",
+		"Favourites":                                       "Favoriten",
+		"Remove %s":                                        "%s entfernen",
+		"Add one with `/ticker -fav AAPL`.":                "Füge einen mit `/ticker -fav AAPL` hinzu.",
+		"Recent lookups":                                   "Letzte Abfragen",
+		"Nothing yet; try `/ticker AAPL`.":                 "Noch nichts; versuche `/ticker AAPL`.",
+		"Updated <!date^%d^{date_short_pretty} {time}|%s>": "Aktualisiert <!date^%d^{date_short_pretty} {time}|%s>",
+
+		// /portfolio.
+		"Play the paper-trading game, or track your real portfolios.": "Das Börsenspiel spielen, oder deine echten Portfolios verfolgen.",
+		"quantity symbol": "Menge Symbol",
+		"[name]":          "[Name]",
+		"[name [csv]]":    "[Name [CSV]]",
+		"name":            "Name",
+		"Buy something at the current price, in the paper-trading game.":  "Im Börsenspiel etwas zum aktuellen Kurs kaufen.",
+		"Sell something at the current price, in the paper-trading game.": "Im Börsenspiel etwas zum aktuellen Kurs verkaufen.",
+		"Show what your paper-trading account holds, and how it's doing.": "Zeigen, was dein Depot im Börsenspiel hält und wie es sich entwickelt.",
+		"Rank everybody who has paper-traded in this channel.":            "Alle, die in diesem Kanal am Börsenspiel teilnehmen, in eine Rangliste bringen.",
+		"List your portfolios.":                     "Deine Portfolios auflisten.",
+		"Show the value of one of your portfolios.": "Den Wert eines deiner Portfolios zeigen.",
+		"Import a real portfolio from CSV (symbol,quantity,cost per line), or open a form to paste it into.": "Ein echtes Portfolio aus CSV importieren (Symbol,Menge,Kosten pro Zeile), oder ein Formular zum Einfügen öffnen.",
+		"Give a real portfolio back as CSV.":                                     "Ein echtes Portfolio als CSV ausgeben.",
+		"Delete a real portfolio.":                                               "Ein echtes Portfolio löschen.",
+		"%s doesn't take any arguments":                                          "%s nimmt keine Argumente",
+		"%s takes just the name of a portfolio":                                  "%s nimmt nur den Namen eines Portfolios",
+		"%s which portfolio?":                                                    "%s welches Portfolio?",
+		"portfolio names are up to 32 letters, numbers, - or _ (and not \"%s\")": "Portfolionamen bestehen aus bis zu 32 Buchstaben, Ziffern, - oder _ (und sind nicht \"%s\")",
+		"import into which portfolio?":                                           "in welches Portfolio importieren?",
+		"%s what, and how many?":                                                 "%s was, und wie viel?",
+		"quantity must be a positive number":                                     "die Menge muss eine positive Zahl sein",
+		"_%s_ isn't something you can buy":                                       "_%s_ kann man nicht kaufen",
+		"You only hold %s shares of %s":                                          "Du hältst nur %s Anteile an %s",
+		"That costs %s, but you only have %s":                                    "Das kostet %s, aber du hast nur %s",
+		"Deleted portfolio _%s_":                                                 "Portfolio _%s_ gelöscht",
+		"You don't have a portfolio called _%s_ (see `/portfolio list`)":         "Du hast kein Portfolio namens _%s_ (siehe `/portfolio list`)",
+		"Your portfolios: _%s_":                                                  "Deine Portfolios: _%s_",
+		"Imported %d holdings into portfolio _%s_":                               "%d Positionen in Portfolio _%s_ importiert",
+		"Paste your holdings after the portfolio name, one per line:\n`/portfolio import name`\n`AAPL,10,1500.00`\n`MSFT,5,1000.00`": "Füge deine Positionen nach dem Namen des Portfolios ein, eine pro Zeile:\n`/portfolio import name`\n`AAPL,10,1500.00`\n`MSFT,5,1000.00`",
+		"Opening the import form...": "Das Importformular wird geöffnet...",
+		"Quotes for _%s_ are delayed by %d minutes, so it can't be traded here": "Kurse für _%s_ sind %d Minuten verzögert, deshalb kann es hier nicht gehandelt werden",
+		"An error occurred converting %s to %s":                                 "Beim Umrechnen von %s in %s ist ein Fehler aufgetreten",
+		"<@%s> bought %s *%s* at %s (%s total)":                                 "<@%s> hat %s *%s* zu %s gekauft (insgesamt %s)",
+		"<@%s> sold %s *%s* at %s (%s total)":                                   "<@%s> hat %s *%s* zu %s verkauft (insgesamt %s)",
+		":warning: _this quote is delayed by %d minutes; the trade is flagged_": ":warning: _dieser Kurs ist %d Minuten verzögert; der Trade ist markiert_",
+		"*%s* %s _(no price available)_":                                        "*%s* %s _(kein Kurs verfügbar)_",
+		":hourglass: %dm delayed":                                               ":hourglass: %d Min. verzögert",
+		"An error occurred valuing your portfolio":                              "Beim Bewerten deines Portfolios ist ein Fehler aufgetreten",
+		"*Paper portfolio:* %s _(%s, %s since you started)_":                    "*Depot:* %s _(%s, %s seit dem Start)_",
+		"Cash: %s": "Bargeld: %s",
+		":warning: %d trades made on delayed quotes":                                ":warning: %d Trades zu verzögerten Kursen",
+		"Nobody has traded in this channel yet.":                                    "In diesem Kanal hat noch niemand gehandelt.",
+		"An error occurred valuing portfolios":                                      "Beim Bewerten der Portfolios ist ein Fehler aufgetreten",
+		":trophy: *Paper trading leaderboard*":                                      ":trophy: *Rangliste des Börsenspiels*",
+		":warning: %d delayed trades":                                               ":warning: %d verzögerte Trades",
+		"An error occurred valuing _%s_":                                            "Beim Bewerten von _%s_ ist ein Fehler aufgetreten",
+		"*%s* %s @ %s = %s _(day %s, gain %s)_":                                     "*%s* %s @ %s = %s _(Tag %s, Gewinn %s)_",
+		"*Portfolio %s:* %s\nDay change: %s _(%s)_\nUnrealised gain: %s _(%s)_\n%s": "*Portfolio %s:* %s\nTagesänderung: %s _(%s)_\nNicht realisierter Gewinn: %s _(%s)_\n%s",
+	},
+}
+
+// locales are the locales we can answer in, by tag.
+var locales = map[string]*Locale{
+	English.Tag: English,
+	German.Tag:  German,
+}
+
+// LookupLocale finds a locale by its tag. Only the language matters, so
+// "de-AT" and "de_CH" are both German.
+func LookupLocale(tag string) (*Locale, bool) {
+	tag = strings.ToLower(tag)
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	l, ok := locales[tag]
+	return l, ok
+}
+
+// LocaleTags lists the locales we can answer in.
+func LocaleTags() []string {
+	var tags []string
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// LocaleFor works out which locale to answer someone in: their own choice
+// if they've made one, then their workspace's, then the configured default.
+func LocaleFor(teamID, userID string) *Locale {
+	for _, tag := range []string{
+		Prefs.Get(teamID, userID).Locale,
+		Config().WorkspaceLocales[teamID],
+		Config().Locale,
+	} {
+		if l, ok := LookupLocale(tag); ok {
+			return l
+		}
+	}
+	return English
+}
+
+// T translates a message, leaving it in English if the catalog doesn't
+// have it.
+func (l *Locale) T(msg string) string {
+	if s, ok := l.Messages[msg]; ok {
+		return s
+	}
+	return msg
+}
+
+// Tf translates a format string and formats it, like fmt.Sprintf.
+func (l *Locale) Tf(format string, a ...interface{}) string {
+	return fmt.Sprintf(l.T(format), a...)
+}
+
+// Number formats a number with the given number of decimal places, or -1
+// for as many as it needs.
+func (l *Locale) Number(v float64, decimals int) string {
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if l.Group != "" {
+		var grouped []string
+		for len(whole) > 3 {
+			grouped = append([]string{whole[len(whole)-3:]}, grouped...)
+			whole = whole[:len(whole)-3]
+		}
+		whole = strings.Join(append([]string{whole}, grouped...), l.Group)
+	}
+	if fraction != "" {
+		return sign + whole + l.Decimal + fraction
+	}
+	return sign + whole
+}
+
+// ParseNumber reads a number written the way this locale writes them, so
+// "1.234,5" is 1234.5 in German. Locales that don't group digits still
+// allow commas between them, as in "1,000".
+func (l *Locale) ParseNumber(s string) (float64, error) {
+	group := l.Group
+	if group == "" && l.Decimal != "," {
+		group = ","
+	}
+	if group != "" {
+		s = strings.Replace(s, group, "", -1)
+	}
+	return strconv.ParseFloat(strings.Replace(s, l.Decimal, ".", 1), 64)
+}
+
+// Percent formats a percentage to two decimal places.
+func (l *Locale) Percent(v float64) string {
+	if l.PercentSpace {
+		return l.Number(v, 2) + " %"
+	}
+	return l.Number(v, 2) + "%"
+}
+
+// SignedPercent is Percent with an explicit sign, for changes.
+func (l *Locale) SignedPercent(v float64) string {
+	s := l.Percent(v)
+	if strings.HasPrefix(s, "-") {
+		return s
+	}
+	return "+" + s
+}
+
+// Humanize is HumanizeNumber for this locale.
+func (l *Locale) Humanize(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	for _, m := range []struct {
+		Size   float64
+		Format string
+	}{
+		{1e12, "%sT"},
+		{1e9, "%sB"},
+		{1e6, "%sM"},
+		{1e3, "%sK"},
+	} {
+		if v >= m.Size {
+			v = v / m.Size
+			if v >= 100 {
+				return sign + l.Tf(m.Format, l.Number(v, 0))
+			}
+			return sign + l.Tf(m.Format, l.Number(v, 1))
+		}
+	}
+	return sign + l.Number(v, 0)
+}
+
+// HumanizeMoney is Humanize with a currency symbol, like $1.6B.
+func (l *Locale) HumanizeMoney(amount float64, code string) string {
+	if code == "" {
+		code = "USD"
+	}
+	amount, code = NormalizeCurrency(amount, code)
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	number := l.Humanize(amount)
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		return fmt.Sprintf("%s%s %s", sign, number, code)
+	}
+	if l.SymbolAfter {
+		return fmt.Sprintf("%s%s %s", sign, number, symbol)
+	}
+	return sign + symbol + number
+}
+
+// Money is FormatMoney for this locale.
+func (l *Locale) Money(amount float64, code string) string {
+	if code == "" {
+		code = "USD"
+	}
+	amount, code = NormalizeCurrency(amount, code)
+	decimals, ok := currencyDecimals[code]
+	if !ok {
+		decimals = 2
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	number := l.Number(amount, decimals)
+	symbol, ok := currencySymbols[code]
+	if !ok {
+		return fmt.Sprintf("%s%s %s", sign, number, code)
+	}
+	if l.SymbolAfter {
+		return fmt.Sprintf("%s%s %s", sign, number, symbol)
+	}
+	return fmt.Sprintf("%s%s%s", sign, symbol, number)
+}
+
+// SetLocale records which locale someone wants answers in; "default" goes
+// back to their workspace's.
+func SetLocale(opts TickerOpts) (map[string]interface{}, error) {
+	tag := ""
+	if opts.Locale != "default" {
+		l, _ := LookupLocale(opts.Locale)
+		tag = l.Tag
+	}
+	err := Prefs.Update(opts.TeamID, opts.UserID, func(p *UserPrefs) {
+		p.Locale = tag
+	})
+	if err != nil {
+		return nil, err
+	}
+	l := LocaleFor(opts.TeamID, opts.UserID)
+	text := l.Tf("Replies to you will now be in %s.", l.Name)
+	if tag == "" {
+		text = l.Tf("Replies to you will now be in the workspace's language, %s.", l.Name)
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}, nil
+}
+
+// ValidateLocales checks that the configured locales are ones we have.
+func ValidateLocales(config *Configuration) error {
+	if _, ok := LookupLocale(config.Locale); config.Locale != "" && !ok {
+		return fmt.Errorf("Unknown locale '%s' (expected one of %s)",
+			config.Locale, strings.Join(LocaleTags(), ", "))
+	}
+	for team, tag := range config.WorkspaceLocales {
+		if _, ok := LookupLocale(tag); !ok {
+			return fmt.Errorf("Workspace %s: unknown locale '%s' (expected one of %s)",
+				team, tag, strings.Join(LocaleTags(), ", "))
+		}
+	}
+	return nil
+}
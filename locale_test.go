@@ -0,0 +1,244 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/logic/slacker/slash"
+)
+
+func TestLocaleFormatting(t *testing.T) {
+	tests := []struct {
+		locale *Locale
+		got    string
+		want   string
+	}{
+		{English, English.Number(1234567.891, 2), "1234567.89"},
+		{English, English.Number(-0.5, 0), "-0"},
+		{English, English.Money(1234.5, "USD"), "$1234.50"},
+		{English, English.Money(-3, "CHF"), "-3.00 CHF"},
+		{English, English.Money(1234, "JPY"), "¥1234"},
+		{English, English.Percent(1.005), "1.00%"},
+		{German, German.Number(1234567.891, 2), "1.234.567,89"},
+		{German, German.Number(999, 0), "999"},
+		{German, German.Money(1234.5, "USD"), "1.234,50 $"},
+		{German, German.Money(-3, "CHF"), "-3,00 CHF"},
+		{German, German.Money(1250, "GBp"), "12,50 £"},
+		{German, German.Percent(-1.5), "-1,50 %"},
+		{German, German.SignedPercent(1.5), "+1,50 %"},
+		{German, German.Humanize(16471872512), "16,5 Mrd."},
+		{German, German.HumanizeMoney(-2.5e6, "EUR"), "-2,5 Mio. €"},
+		{English, English.HumanizeMoney(-2.5e6, "EUR"), "-€2.5M"},
+	}
+	for i, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%d. %s: expected %q, got %q", i, test.locale.Tag, test.want, test.got)
+		}
+	}
+	if English.Money(12.3, "EUR") != FormatMoney(12.3, "EUR") {
+		t.Error("expected English money to match FormatMoney")
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		locale *Locale
+		input  string
+		want   float64
+	}{
+		{English, "1.5", 1.5},
+		{English, "1,000.25", 1000.25},
+		{German, "1,5", 1.5},
+		{German, "1.000,25", 1000.25},
+		{German, "12", 12},
+	}
+	for i, test := range tests {
+		got, err := test.locale.ParseNumber(test.input)
+		if err != nil || got != test.want {
+			t.Errorf("%d. %s: expected %v, got %v (%v)", i, test.locale.Tag, test.want, got, err)
+		}
+	}
+	if _, err := German.ParseNumber("1,5,0"); err == nil {
+		t.Error("expected a second decimal separator to be invalid")
+	}
+}
+
+// TestGermanUsage checks that usage messages and validation errors are
+// translated for commands other than /ticker.
+func TestGermanUsage(t *testing.T) {
+	SetConfig(Configuration{CryptoCurrency: "USD"})
+	tests := []struct {
+		command *slash.Command
+		args    []string
+		want    []string
+	}{
+		{FXCommand, []string{"USD"}, []string{"*Fehler:* es fehlt eine Währung", "Zwischen Währungen umrechnen"}},
+		{FXCommand, []string{"-prefer", "euros"}, []string{"Codes aus drei Buchstaben", "[Betrag] von nach"}},
+		{CryptoCommand, nil, []string{"kein Coin angegeben", "Kurs einer Kryptowährung"}},
+		{CryptoCommand, []string{"b$c"}, []string{"*Fehler:* Ungültiger Coin"}},
+		{PortfolioCommand, []string{"buy", "x", "AAPL"}, []string{"die Menge muss eine positive Zahl sein"}},
+		{PortfolioCommand, []string{"list", "x"}, []string{"list nimmt keine Argumente", "Deine Portfolios auflisten."}},
+	}
+	for i, test := range tests {
+		inv, err := test.command.Parse(test.args, German)
+		if err == nil {
+			switch test.command {
+			case FXCommand:
+				_, err = fxOpts(inv)
+			case CryptoCommand:
+				_, err = cryptoOpts(inv)
+			case PortfolioCommand:
+				_, err = portfolioOpts(inv, strings.Join(test.args, " "))
+			}
+		}
+		if err == nil {
+			t.Errorf("%d. expected %v to be invalid", i, test.args)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%d. expected %q in %q", i, want, err)
+			}
+		}
+	}
+
+	_, _, err := ParseHistoryRange("2024-03-15", "2024-01-01:2024-06-30", time.Now())
+	if got := German.T(err.Error()); got != "entweder -on oder -range verwenden, nicht beides" {
+		t.Errorf("expected a German history error, got %q", got)
+	}
+}
+
+func TestLocaleMessages(t *testing.T) {
+	if got := German.Tf("Unknown ticker symbol _%s_", "XYZ"); got != "Unbekanntes Tickersymbol _XYZ_" {
+		t.Errorf("unexpected translation %q", got)
+	}
+	if got := English.Tf("Unknown ticker symbol _%s_", "XYZ"); got != "Unknown ticker symbol _XYZ_" {
+		t.Errorf("unexpected English %q", got)
+	}
+	if got := German.T("Something nobody translated"); got != "Something nobody translated" {
+		t.Errorf("expected untranslated messages in English, got %q", got)
+	}
+	for _, tag := range []string{"de", "DE", "de-AT", "de_CH"} {
+		if l, ok := LookupLocale(tag); !ok || l != German {
+			t.Errorf("%s: expected German", tag)
+		}
+	}
+	if _, ok := LookupLocale("tlh"); ok {
+		t.Error("expected Klingon to be unknown")
+	}
+}
+
+func TestLocaleFor(t *testing.T) {
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	if LocaleFor("T1", "U1") != English {
+		t.Error("expected English by default")
+	}
+	loadTestConfig(t, `
+Locale = "de"
+[WorkspaceLocales]
+T2 = "en"
+`)
+	if LocaleFor("T1", "U1") != German || LocaleFor("T2", "U1") != English {
+		t.Error("expected the workspace's locale, then the default")
+	}
+	Prefs.Update("T2", "U2", func(p *UserPrefs) { p.Locale = "de" })
+	if LocaleFor("T2", "U2") != German {
+		t.Error("expected the user's own locale first")
+	}
+
+	for _, bad := range []string{"Locale = \"xx\"\n", "[WorkspaceLocales]\nT1 = \"xx\"\n"} {
+		var c Configuration
+		if err := LoadConfig(&c, strings.NewReader(bad)); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestGermanTicker(t *testing.T) {
+	view := sampleQuoteView
+	view.Locale = German
+	view.Converted = "150,00 $"
+	view.PreviousClose = "148,50 $"
+	text, err := RenderQuote(TickerTemplates("T1"), view)
+	if err != nil {
+		t.Fatal("RenderQuote failed:", err)
+	}
+	want := "*150,00 $* _(plus 1,01 % gegenüber dem Schlusskurs von 148,50 $)_ \nas of Jan 2 4:00PM EST"
+	if text["text"] != want {
+		t.Errorf("expected %q, got %q", want, text["text"])
+	}
+
+	quote := APIResult{
+		Currency:                  "USD",
+		ExchangeTimezoneName:      "America/New_York",
+		ExchangeTimezoneShortName: "EST",
+		GmtOffSetMilliseconds:     -18000000,
+		RegularMarketTime:         1511384466,
+		MarketState:               "POST",
+		PostMarketPrice:           1022.26,
+		PostMarketChange:          -0.01,
+		PostMarketChangePercent:   -0.04,
+		PostMarketTime:            1511398614,
+	}
+	if ext, _ := ExtendedHoursQuote(quote, German); ext != "Nachbörslich: *1.022,26 $* _(minus 0,04 %)_ Stand 22.11. 19:56 EST" {
+		t.Errorf("unexpected extended hours %q", ext)
+	}
+	plain, token := FormatAsOf(quote, nil, German)
+	if plain != "22.11.17 16:01 EST" || !strings.HasSuffix(token, "(16:01 EST Börsenzeit)") {
+		t.Errorf("unexpected as of %q, %q", plain, token)
+	}
+}
+
+func TestLocaleCommand(t *testing.T) {
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	call := func(text string) string {
+		form := url.Values{"text": {text}, "team_id": {"T1"}, "user_id": {"U1"}}
+		req := httptest.NewRequest("POST", "/ticker", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := CommandHandler(TickerCommand)(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("handler failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return payload["text"].(string)
+	}
+
+	if text := call("-locale de"); text != "Antworten an dich sind jetzt auf Deutsch." {
+		t.Errorf("unexpected answer %q", text)
+	}
+	help := call("help")
+	for _, line := range []string{
+		"*Aufruf:* `/ticker [Optionen] Symbol`",
+		"• `-period Zeitraum` Zeitraum des Charts [xd|xY] (Standard `1d`)",
+		"• `-private` Antwort nur dir zeigen",
+	} {
+		if !strings.Contains(help, line) {
+			t.Errorf("expected %q in help:\n%s", line, help)
+		}
+	}
+	if text := call("-type pie AAPL"); !strings.HasPrefix(text,
+		"*Fehler:* die Art des Charts muss 'line', 'bar' oder 'candle' sein\n") {
+		t.Errorf("unexpected error %q", text)
+	}
+	if text := call("-locale xx"); !strings.HasPrefix(text, "*Fehler:* unbekannte Sprache 'xx'") {
+		t.Errorf("unexpected error %q", text)
+	}
+
+	if text := call("-locale default"); text != "Replies to you will now be in the workspace's language, English." {
+		t.Errorf("unexpected answer %q", text)
+	}
+	if Prefs.Get("T1", "U1").Locale != "" {
+		t.Error("expected the user's locale to be cleared")
+	}
+}
@@ -10,17 +10,89 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-// Config is our global (read-only) configuration state.
-var Config Configuration
+// published is the configuration in effect, and the commands built from
+// it. Requests are served while ReloadConfig replaces them, so they're only
+// ever swapped as a whole, and read through Config and Commands.
+var published atomic.Value
 
-// Commands are any Slack commands that we recognize, and their handlers
-var Commands SlashCommands
+type publication struct {
+	config   *Configuration
+	commands SlashCommands
+}
+
+func init() {
+	published.Store(publication{config: &Configuration{}})
+}
+
+// Config is our global configuration state. It's shared by every request,
+// so it's read-only; a changed configuration is published with SetConfig.
+func Config() *Configuration {
+	return published.Load().(publication).config
+}
+
+// Commands are the Slack commands that we serve (see Register), and their
+// handlers
+func Commands() SlashCommands {
+	return published.Load().(publication).commands
+}
+
+// Published returns the configuration and the commands built from it, as
+// they were published together.
+func Published() (*Configuration, SlashCommands) {
+	p := published.Load().(publication)
+	return p.config, p.commands
+}
+
+// Publish starts serving a configuration and the commands built from it,
+// together.
+func Publish(config Configuration, commands SlashCommands) {
+	published.Store(publication{&config, commands})
+}
+
+// SetConfig publishes a configuration, keeping the commands being served.
+func SetConfig(config Configuration) {
+	Publish(config, Commands())
+}
+
+// SetCommands publishes the commands to serve, keeping the configuration.
+func SetCommands(commands SlashCommands) {
+	Publish(*Config(), commands)
+}
+
+// Installations are the workspaces we have been installed into via OAuth.
+var Installations = NewInstallationStore("")
+
+// Prefs are the per-user settings people have chosen.
+var Prefs = NewPrefsStore("")
+
+// Portfolios are everyone's paper-trading accounts.
+var Portfolios = NewPortfolioStore("", "")
+
+// Holdings are the real portfolios people have imported.
+var Holdings = NewHoldingsStore("")
+
+// Analytics are the counts of lookups made in each workspace.
+var Analytics = NewAnalyticsStore("")
+
+// Audit is the record of every command we've dispatched.
+var Audit = NewAuditLog("", 0)
 
 var version = "development version"
 var timestamp = "unknown"
 
+// startTime is when we started, for /slacker status.
+var startTime = time.Now()
+
+// flagConfig is the configuration given on the command line, which the
+// configuration file is loaded on top of (again, on /slacker reload).
+var flagConfig Configuration
+
 func versionString() string {
 	return fmt.Sprintf("slacker %s (build date %s)", version, timestamp)
 }
@@ -38,15 +110,26 @@ func parseCli() Configuration {
 	flag.StringVar(&c.ListenAddress, "listen-address", "0.0.0.0:8000",
 		"Address and port to listen on")
 	flag.BoolVar(&c.AsyncResponse, "async-response", true,
-		"Whether to respond to requests asynchronously")
+		"Whether to deliver slow answers asynchronously")
 	flag.DurationVar(&c.HTTPClientTimeout, "http-client-timeout", 0,
 		"Time to wait before cancelling an external request")
+	flag.StringVar(&c.DataDir, "data-dir", "",
+		"Directory to keep persistent state in")
+	flag.StringVar(&c.OAuthScopes, "oauth-scopes", "commands,chat:write,users:read,links:read,links:write",
+		"Bot scopes to request when installing into a workspace")
+	flag.StringVar(&c.CryptoCurrency, "crypto-currency", "USD",
+		"Currency to quote /crypto coins in by default")
+	flag.Float64Var(&c.PaperStartingCash, "paper-starting-cash", 100000,
+		"Cash (in USD) each /portfolio paper-trading account starts with")
+	flag.BoolVar(&c.PaperRejectDelayed, "paper-reject-delayed", false,
+		"Refuse /portfolio trades on delayed quotes, instead of flagging them")
 	ver := flag.Bool("version", false, "Display current version")
 	flag.Parse()
 	if *ver {
 		fmt.Println(versionString())
 		os.Exit(0)
 	}
+	flagConfig = c
 	if f, err := os.Open(c.File); err != nil {
 		log.Printf("Warning: could not load configuration file %s\n",
 			c.File)
@@ -60,15 +143,64 @@ func parseCli() Configuration {
 }
 
 func main() {
-	Config = parseCli()
+	SetConfig(parseCli())
 	log.Printf("%s started\n", versionString())
 
-	Commands = SlashCommands{
-		"/ticker": Ticker,
+	Installations = NewInstallationStore(DataPath("installations.json"))
+	if err := Installations.Load(); err != nil {
+		log.Fatal("Could not load installations: ", err)
+	}
+	Prefs = NewPrefsStore(DataPath("prefs.json"))
+	if err := Prefs.Load(); err != nil {
+		log.Fatal("Could not load preferences: ", err)
+	}
+	Portfolios = NewPortfolioStore(DataPath("portfolios.json"), DataPath("trades.log"))
+	if err := Portfolios.Load(); err != nil {
+		log.Fatal("Could not load portfolios: ", err)
+	}
+	Holdings = NewHoldingsStore(DataPath("holdings.json"))
+	if err := Holdings.Load(); err != nil {
+		log.Fatal("Could not load holdings: ", err)
 	}
+	Analytics = NewAnalyticsStore(DataPath("analytics.json"))
+	if err := Analytics.Load(); err != nil {
+		log.Fatal("Could not load analytics: ", err)
+	}
+	if err := Analytics.ForgetOptedOut(); err != nil {
+		log.Fatal("Could not forget opted-out analytics: ", err)
+	}
+	Audit = NewAuditLog(DataPath("audit"), 0)
+
+	commands, err := BuildCommands(Config())
+	if err != nil {
+		log.Fatal("Could not set up commands: ", err)
+	}
+	SetCommands(commands)
+
+	go WeeklyReporter()
+	go Analytics.SaveEvery(analyticsSaveInterval)
+	go saveOnShutdown()
 
 	http.Handle("/cmd", RequestIDMiddleware(ErrorHandler(SlackDispatcher)))
-	if err := http.ListenAndServe(Config.ListenAddress, nil); err != nil {
+	http.Handle("/events", RequestIDMiddleware(SignedOnly(EventDispatcher)))
+	http.Handle("/interactive", RequestIDMiddleware(SignedOnly(InteractionDispatcher)))
+	http.Handle("/slack/install", RequestIDMiddleware(ErrorHandler(InstallHandler)))
+	http.Handle("/slack/oauth", RequestIDMiddleware(ErrorHandler(OAuthCallback)))
+	http.Handle("/audit", RequestIDMiddleware(ErrorHandler(AuditHandler)))
+	if err := http.ListenAndServe(Config().ListenAddress, nil); err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
 }
+
+// saveOnShutdown (as a goroutine) saves what is only saved periodically
+// before we stop, when we're interrupted or asked to terminate.
+func saveOnShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	if err := Analytics.Save(); err != nil {
+		log.Printf("Error saving analytics: %s", err)
+	}
+	log.Printf("Stopping on %s\n", sig)
+	os.Exit(0)
+}
@@ -0,0 +1,198 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var slackAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+const oauthStateCookie = "slacker_oauth_state"
+
+// oauthStateTTL is how long a user has to complete the "Add to Slack" flow
+// before the state we handed them expires.
+const oauthStateTTL = 10 * time.Minute
+
+// OAuthAccessResponse is the subset of the oauth.v2.access response that we
+// keep around.
+type OAuthAccessResponse struct {
+	SlackResponse
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	Scope       string `json:"scope"`
+	BotUserID   string `json:"bot_user_id"`
+	AppID       string `json:"app_id"`
+	Team        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"team"`
+	Enterprise *struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"enterprise"`
+	AuthedUser struct {
+		ID string `json:"id"`
+	} `json:"authed_user"`
+}
+
+// signOAuthState computes the signature binding a nonce and timestamp to
+// our client secret.
+func signOAuthState(nonce string, ts int64) string {
+	mac := hmac.New(sha256.New, []byte(Config().ClientSecret))
+	fmt.Fprintf(mac, "%s.%d", nonce, ts)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewOAuthState returns a fresh random nonce and the signed state parameter
+// that carries it through Slack's authorization page.
+func NewOAuthState(now time.Time) (string, string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	nonce := hex.EncodeToString(buf)
+	ts := now.Unix()
+	return nonce, fmt.Sprintf("%s.%d.%s", nonce, ts, signOAuthState(nonce, ts)), nil
+}
+
+// VerifyOAuthState checks that a state parameter was issued by us, has not
+// expired, and belongs to the browser presenting the given nonce cookie.
+func VerifyOAuthState(state, nonce string, now time.Time) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 {
+		return errors.New("Malformed OAuth state")
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errors.New("Malformed OAuth state")
+	}
+	expected := signOAuthState(parts[0], ts)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return errors.New("OAuth state signature mismatch")
+	}
+	if now.Sub(time.Unix(ts, 0)) > oauthStateTTL {
+		return errors.New("OAuth state has expired")
+	}
+	if nonce == "" || !hmac.Equal([]byte(nonce), []byte(parts[0])) {
+		return errors.New("OAuth state does not match this browser")
+	}
+	return nil
+}
+
+// InstallHandler starts the "Add to Slack" flow by redirecting the user to
+// Slack's authorization page.
+func InstallHandler(w http.ResponseWriter, req *http.Request) error {
+	if Config().ClientID == "" || Config().ClientSecret == "" {
+		return StatusError{http.StatusNotFound,
+			errors.New("OAuth installation is not configured")}
+	}
+	nonce, state, err := NewOAuthState(time.Now())
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    nonce,
+		Path:     "/",
+		MaxAge:   int(oauthStateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https",
+	})
+
+	params := url.Values{
+		"client_id": {Config().ClientID},
+		"scope":     {Config().OAuthScopes},
+		"state":     {state},
+	}
+	if Config().OAuthRedirectURL != "" {
+		params.Set("redirect_uri", Config().OAuthRedirectURL)
+	}
+	http.Redirect(w, req, slackAuthorizeURL+"?"+params.Encode(),
+		http.StatusFound)
+	return nil
+}
+
+// OAuthCallback completes the "Add to Slack" flow: it validates the state,
+// exchanges the temporary code for a bot token, and stores the installation.
+func OAuthCallback(w http.ResponseWriter, req *http.Request) error {
+	if Config().ClientID == "" || Config().ClientSecret == "" {
+		return StatusError{http.StatusNotFound,
+			errors.New("OAuth installation is not configured")}
+	}
+	if e := req.FormValue("error"); e != "" {
+		return StatusError{http.StatusForbidden,
+			fmt.Errorf("Installation was not authorized: %s", e)}
+	}
+
+	var nonce string
+	if cookie, err := req.Cookie(oauthStateCookie); err == nil {
+		nonce = cookie.Value
+	}
+	if err := VerifyOAuthState(req.FormValue("state"), nonce, time.Now()); err != nil {
+		return StatusError{http.StatusBadRequest, err}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:   oauthStateCookie,
+		Path:   "/",
+		MaxAge: -1,
+	})
+
+	code := req.FormValue("code")
+	if code == "" {
+		return StatusError{http.StatusBadRequest,
+			errors.New("No OAuth code supplied")}
+	}
+	form := url.Values{
+		"client_id":     {Config().ClientID},
+		"client_secret": {Config().ClientSecret},
+		"code":          {code},
+	}
+	if Config().OAuthRedirectURL != "" {
+		form.Set("redirect_uri", Config().OAuthRedirectURL)
+	}
+	var access OAuthAccessResponse
+	if err := SlackFromContext(req.Context()).CallForm("oauth.v2.access", "", form, &access); err != nil {
+		return StatusError{http.StatusBadGateway, err}
+	}
+
+	inst := Installation{
+		TeamID:      access.Team.ID,
+		TeamName:    access.Team.Name,
+		AppID:       access.AppID,
+		BotUserID:   access.BotUserID,
+		BotToken:    access.AccessToken,
+		Scope:       access.Scope,
+		InstalledBy: access.AuthedUser.ID,
+		InstalledAt: time.Now().UTC(),
+	}
+	if access.Enterprise != nil {
+		inst.EnterpriseID = access.Enterprise.ID
+	}
+	if inst.TeamID == "" {
+		return StatusError{http.StatusBadGateway,
+			errors.New("Slack did not tell us which team installed us")}
+	}
+	if err := Installations.Save(inst); err != nil {
+		return err
+	}
+	log.Printf("[%d] Installed into %s (%s) by %s", RequestID(req.Context()),
+		inst.TeamName, inst.TeamID, inst.InstalledBy)
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "Slacker has been installed into %s.\n", inst.TeamName)
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOAuthState(t *testing.T) {
+	SetConfig(Configuration{ClientID: "id", ClientSecret: "secret"})
+	now := time.Now()
+	nonce, state, err := NewOAuthState(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyOAuthState(state, nonce, now); err != nil {
+		t.Error("valid state rejected:", err)
+	}
+	if err := VerifyOAuthState(state, "other", now); err == nil {
+		t.Error("state accepted for the wrong browser")
+	}
+	if err := VerifyOAuthState(state, nonce, now.Add(2*oauthStateTTL)); err == nil {
+		t.Error("expired state accepted")
+	}
+	if err := VerifyOAuthState(state+"0", nonce, now); err == nil {
+		t.Error("tampered state accepted")
+	}
+	if err := VerifyOAuthState("garbage", nonce, now); err == nil {
+		t.Error("malformed state accepted")
+	}
+}
+
+func TestInstallHandler(t *testing.T) {
+	SetConfig(Configuration{ClientID: "id", ClientSecret: "secret",
+		OAuthScopes: "commands"})
+	req := httptest.NewRequest("GET", "/slack/install", nil)
+	w := httptest.NewRecorder()
+	if err := InstallHandler(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+		t.Fatal("InstallHandler failed:", err)
+	}
+	if w.Code != http.StatusFound {
+		t.Errorf("expected redirect, got %d", w.Code)
+	}
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.Query().Get("client_id") != "id" || loc.Query().Get("scope") != "commands" {
+		t.Errorf("unexpected authorize URL %s", loc)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !strings.HasPrefix(loc.Query().Get("state"), cookies[0].Value+".") {
+		t.Errorf("state cookie does not match state parameter")
+	}
+}
+
+func TestOAuthCallback(t *testing.T) {
+	SetConfig(Configuration{ClientID: "id", ClientSecret: "secret"})
+	Installations = NewInstallationStore("")
+	slackHandler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth.v2.access" || r.FormValue("code") != "code" ||
+			r.FormValue("client_secret") != "secret" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"access_token":"xoxb-1","bot_user_id":"B1",`+
+			`"team":{"id":"T1","name":"Team"},"authed_user":{"id":"U1"}}`)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(slackHandler))
+	defer ts.Close()
+
+	nonce, state, err := NewOAuthState(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/slack/oauth?code=code&state="+
+		url.QueryEscape(state), nil)
+	req.AddCookie(&http.Cookie{Name: oauthStateCookie, Value: nonce})
+	w := httptest.NewRecorder()
+	ctx := WithSlack(NewContext(req.Context(), req), NewSlack(ts.URL))
+	if err := OAuthCallback(w, req.WithContext(ctx)); err != nil {
+		t.Fatal("OAuthCallback failed:", err)
+	}
+	inst, ok := Installations.Get("T1")
+	if !ok || inst.BotToken != "xoxb-1" || inst.InstalledBy != "U1" {
+		t.Errorf("unexpected installation %+v", inst)
+	}
+
+	req = httptest.NewRequest("GET", "/slack/oauth?code=code&state="+
+		url.QueryEscape(state), nil)
+	w = httptest.NewRecorder()
+	ctx = WithSlack(NewContext(req.Context(), req), NewSlack(ts.URL))
+	if err := OAuthCallback(w, req.WithContext(ctx)); err == nil {
+		t.Error("OAuthCallback accepted a request without a state cookie")
+	}
+}
@@ -0,0 +1,769 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logic/slacker/slash"
+)
+
+// paperCurrency is the currency every paper account is kept in; trades in
+// anything else are converted at the current exchange rate.
+const paperCurrency = "USD"
+
+// quantityEpsilon is how close to zero a position has to get to count as
+// sold, since fractional quantities don't add up exactly in floating point.
+const quantityEpsilon = 1e-9
+
+// Position is a holding of a single symbol.
+type Position struct {
+	Quantity float64
+	Cost     float64 // total cost basis, in paperCurrency
+}
+
+// PaperAccount is one user's virtual portfolio in the paper-trading game.
+type PaperAccount struct {
+	Cash          float64
+	StartingCash  float64 // what the account was opened with
+	Positions     map[string]*Position
+	Channels      []string // where the user has traded, for leaderboards
+	DelayedTrades int
+	Created       time.Time
+}
+
+// Trade is a single journaled buy or sell.
+type Trade struct {
+	Time      time.Time
+	TeamID    string
+	UserID    string
+	ChannelID string
+	Side      string
+	Symbol    string
+	Quantity  float64
+	Price     float64 // per share, in Currency
+	Currency  string
+	FXRate    float64 // from Currency to paperCurrency
+	DelayedBy int     `json:",omitempty"` // minutes, if the quote was delayed
+}
+
+// PortfolioStore is a persistent, concurrency-safe map of Slack users to
+// their paper-trading accounts, along with an append-only journal of every
+// trade made.
+type PortfolioStore struct {
+	sync.Mutex
+	path     string
+	journal  string
+	accounts map[string]*PaperAccount
+}
+
+// NewPortfolioStore creates an empty store backed by the file at path, with
+// trades journaled to the file at journal. If either is empty, that part is
+// only kept in memory (or, for the journal, the log).
+func NewPortfolioStore(path, journal string) *PortfolioStore {
+	return &PortfolioStore{
+		path:     path,
+		journal:  journal,
+		accounts: map[string]*PaperAccount{},
+	}
+}
+
+// Load replaces the contents of the store with what is saved on disk.
+func (s *PortfolioStore) Load() error {
+	accounts := map[string]*PaperAccount{}
+	if err := loadJSONFile(s.path, &accounts); err != nil {
+		return err
+	}
+	for _, acct := range accounts {
+		// Accounts opened before we kept track started with whatever
+		// was configured then, most likely what's configured now.
+		if acct.StartingCash == 0 {
+			acct.StartingCash = Config().PaperStartingCash
+		}
+	}
+	s.Lock()
+	s.accounts = accounts
+	s.Unlock()
+	return nil
+}
+
+// account returns a user's account, opening one if they don't have one yet.
+// The caller must hold the lock.
+func (s *PortfolioStore) account(teamID, userID string) *PaperAccount {
+	key := prefsKey(teamID, userID)
+	acct, ok := s.accounts[key]
+	if !ok {
+		acct = &PaperAccount{
+			Cash:         Config().PaperStartingCash,
+			StartingCash: Config().PaperStartingCash,
+			Positions:    map[string]*Position{},
+			Created:      time.Now().UTC(),
+		}
+		s.accounts[key] = acct
+	}
+	if acct.Positions == nil {
+		acct.Positions = map[string]*Position{}
+	}
+	return acct
+}
+
+// copyAccount returns a copy of an account that shares nothing with it, so
+// it can be read without the lock. The caller must hold the lock.
+func copyAccount(acct *PaperAccount) PaperAccount {
+	c := *acct
+	c.Positions = map[string]*Position{}
+	for symbol, pos := range acct.Positions {
+		p := *pos
+		c.Positions[symbol] = &p
+	}
+	c.Channels = append([]string(nil), acct.Channels...)
+	return c
+}
+
+// Get returns a copy of a user's account.
+func (s *PortfolioStore) Get(teamID, userID string) PaperAccount {
+	s.Lock()
+	defer s.Unlock()
+	return copyAccount(s.account(teamID, userID))
+}
+
+// Execute applies a trade to a user's account, journals it, and persists the
+// store. It returns an error, leaving the account untouched, if the user
+// can't afford the purchase or doesn't hold enough to sell.
+func (s *PortfolioStore) Execute(trade Trade) error {
+	s.Lock()
+	defer s.Unlock()
+	acct := s.account(trade.TeamID, trade.UserID)
+	amount := trade.Quantity * trade.Price * trade.FXRate
+	pos := acct.Positions[trade.Symbol]
+
+	switch trade.Side {
+	case "buy":
+		if amount > acct.Cash {
+			return TradeError{Trade: trade, Cost: amount, Cash: acct.Cash}
+		}
+		if pos == nil {
+			pos = &Position{}
+			acct.Positions[trade.Symbol] = pos
+		}
+		acct.Cash -= amount
+		pos.Quantity += trade.Quantity
+		pos.Cost += amount
+	case "sell":
+		if pos == nil || pos.Quantity < trade.Quantity-quantityEpsilon {
+			held := 0.0
+			if pos != nil {
+				held = pos.Quantity
+			}
+			return TradeError{Trade: trade, Held: held}
+		}
+		// Selling reduces the cost basis proportionally (average cost).
+		acct.Cash += amount
+		pos.Cost -= pos.Cost * trade.Quantity / pos.Quantity
+		pos.Quantity -= trade.Quantity
+		if pos.Quantity < quantityEpsilon {
+			delete(acct.Positions, trade.Symbol)
+		}
+	default:
+		return fmt.Errorf("Unknown trade side '%s'", trade.Side)
+	}
+
+	if trade.DelayedBy > 0 {
+		acct.DelayedTrades++
+	}
+	found := false
+	for _, c := range acct.Channels {
+		if c == trade.ChannelID {
+			found = true
+			break
+		}
+	}
+	if !found && trade.ChannelID != "" {
+		acct.Channels = append(acct.Channels, trade.ChannelID)
+	}
+
+	if err := s.appendJournal(trade); err != nil {
+		return err
+	}
+	return saveJSONFile(s.path, s.accounts)
+}
+
+// TradeError is why Execute refused a trade: a purchase costing more than
+// the cash left, or a sale of more than is held. It keeps the amounts, so
+// the trader can be told in their own language.
+type TradeError struct {
+	Trade Trade
+	Cost  float64
+	Cash  float64
+	Held  float64
+}
+
+// Error describes the refusal in English.
+func (e TradeError) Error() string { return e.Describe(English) }
+
+// Describe describes the refusal in the given locale.
+func (e TradeError) Describe(l *Locale) string {
+	if e.Trade.Side == "sell" {
+		return l.Tf("You only hold %s shares of %s", l.Number(e.Held, -1), e.Trade.Symbol)
+	}
+	return l.Tf("That costs %s, but you only have %s",
+		l.Money(e.Cost, paperCurrency), l.Money(e.Cash, paperCurrency))
+}
+
+// appendJournal records a trade in the journal. The caller must hold the
+// lock.
+func (s *PortfolioStore) appendJournal(trade Trade) error {
+	line, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+	if s.journal == "" {
+		log.Printf("Trade: %s", line)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.journal), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.journal, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Players returns the users who have traded in a channel, keyed as in the
+// store, along with a copy of their accounts.
+func (s *PortfolioStore) Players(teamID, channelID string) map[string]PaperAccount {
+	s.Lock()
+	defer s.Unlock()
+	players := map[string]PaperAccount{}
+	for key, acct := range s.accounts {
+		if !strings.HasPrefix(key, teamID+":") {
+			continue
+		}
+		for _, c := range acct.Channels {
+			if c == channelID {
+				players[strings.TrimPrefix(key, teamID+":")] = copyAccount(acct)
+				break
+			}
+		}
+	}
+	return players
+}
+
+// PortfolioOpts represents a set of parsed /portfolio command options.
+type PortfolioOpts struct {
+	Action   string
+	Quantity float64
+	Symbol   string
+	Name     string
+	CSV      string
+}
+
+// PortfolioCommand is the "/portfolio" Slack slash command. On its own, it
+// shows your paper-trading account.
+var PortfolioCommand = &slash.Command{
+	Name:     "/portfolio",
+	Help:     "Play the paper-trading game, or track your real portfolios.",
+	Response: "ephemeral",
+	Run:      runPortfolio,
+	Subcommands: []*slash.Command{
+		{Name: "buy", Args: "quantity symbol", Run: runPortfolio,
+			Help: "Buy something at the current price, in the paper-trading game."},
+		{Name: "sell", Args: "quantity symbol", Run: runPortfolio,
+			Help: "Sell something at the current price, in the paper-trading game."},
+		{Name: "holdings", Run: runPortfolio,
+			Help: "Show what your paper-trading account holds, and how it's doing."},
+		{Name: "leaderboard", Run: runPortfolio,
+			Help: "Rank everybody who has paper-traded in this channel."},
+		{Name: "list", Run: runPortfolio,
+			Help: "List your portfolios."},
+		{Name: "show", Args: "[name]", Run: runPortfolio,
+			Help: "Show the value of one of your portfolios."},
+		{Name: "import", Args: "[name [csv]]", Run: runPortfolio,
+			Help: "Import a real portfolio from CSV (symbol,quantity,cost per line), or open a form to paste it into."},
+		{Name: "export", Args: "name", Run: runPortfolio,
+			Help: "Give a real portfolio back as CSV."},
+		{Name: "delete", Args: "name", Run: runPortfolio,
+			Help: "Delete a real portfolio."},
+	},
+}
+
+func init() {
+	slash.RegisterCommand(PortfolioCommand)
+}
+
+// ParsePortfolioCommand takes the /portfolio command line and parses it into
+// PortfolioOpts, returning an error if anything goes wrong.
+func ParsePortfolioCommand(cmd string) (PortfolioOpts, error) {
+	args, err := slash.Tokenize(cmd)
+	if err != nil {
+		return PortfolioOpts{}, PortfolioCommand.UsageError(PortfolioCommand.Name, err.Error(), English)
+	}
+	inv, err := PortfolioCommand.Parse(args, English)
+	if err != nil {
+		return PortfolioOpts{}, err
+	}
+	return portfolioOpts(inv, cmd)
+}
+
+// portfolioOpts works out what a /portfolio invocation asks for. The whole
+// command line is needed too, since CSV pasted after an import keeps its
+// own lines.
+func portfolioOpts(inv *slash.Invocation, text string) (PortfolioOpts, error) {
+	opts := PortfolioOpts{Action: inv.Command.Name}
+	args := inv.Args
+	switch opts.Action {
+	case "/portfolio", "holdings":
+		opts.Action = "show"
+		if len(args) > 0 {
+			return opts, inv.Errorf("unknown command '%s'", args[0])
+		}
+	case "leaderboard", "list":
+		if len(args) > 0 {
+			return opts, inv.Errorf("%s doesn't take any arguments", opts.Action)
+		}
+	case "show", "export", "delete", "import":
+		if len(args) > 0 {
+			opts.Name = strings.ToLower(args[0])
+		}
+		if opts.Action == "import" {
+			// CSV can follow the name, either on the following lines,
+			// or one holding per word on the same line.
+			if lines := strings.SplitN(strings.TrimSpace(text), "\n", 2); len(lines) > 1 {
+				opts.CSV = strings.TrimSpace(lines[1])
+			} else if len(args) > 1 {
+				opts.CSV = strings.Join(args[1:], "\n")
+			}
+		} else if len(args) > 1 {
+			return opts, inv.Errorf("%s takes just the name of a portfolio", opts.Action)
+		}
+		if opts.Name == "" && opts.Action != "show" && opts.Action != "import" {
+			return opts, inv.Errorf("%s which portfolio?", opts.Action)
+		}
+		if opts.Name == paperPortfolioName && opts.Action == "show" {
+			opts.Name = ""
+		} else if opts.Name != "" && !ValidPortfolioName(opts.Name) {
+			return opts, inv.Errorf("portfolio names are up to 32 letters, numbers, - or _ (and not \"%s\")",
+				paperPortfolioName)
+		}
+		if opts.CSV != "" && opts.Name == "" {
+			return opts, inv.Errorf("import into which portfolio?")
+		}
+	case "buy", "sell":
+		if len(args) != 2 {
+			return opts, inv.Errorf("%s what, and how many?", opts.Action)
+		}
+		qty, err := localeOf(inv).ParseNumber(args[0])
+		if err != nil || qty <= 0 {
+			return opts, inv.Errorf("quantity must be a positive number")
+		}
+		opts.Quantity = qty
+		opts.Symbol = ResolveSymbol(args[1])
+		switch SymbolQuoteType(opts.Symbol) {
+		case "", "INDEX", "CURRENCY":
+			return opts, inv.Errorf("_%s_ isn't something you can buy", opts.Symbol)
+		}
+	}
+	return opts, nil
+}
+
+// runPortfolio answers a /portfolio command.
+func runPortfolio(inv *slash.Invocation) (map[string]interface{}, error) {
+	var payload map[string]interface{}
+	req := inv.Request
+	teamID := req.FormValue("team_id")
+	userID := req.FormValue("user_id")
+
+	opts, err := portfolioOpts(inv, req.FormValue("text"))
+	if err != nil {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          err.Error(),
+		}, nil
+	}
+	l := localeOf(inv)
+	switch opts.Action {
+	case "show":
+		if opts.Name == "" {
+			payload = BuildHoldingsPayload(Portfolios.Get(teamID, userID), l, req.Context())
+		} else if holdings, ok := Holdings.Get(teamID, userID, opts.Name); ok {
+			payload = BuildHoldingsValuePayload(opts.Name, holdings, l, req.Context())
+		} else {
+			payload = unknownPortfolio(opts.Name, l)
+		}
+	case "list":
+		payload = BuildPortfolioListPayload(Holdings.Names(teamID, userID), l)
+	case "import":
+		payload, err = ImportPortfolio(opts, l, req)
+		if err != nil {
+			return nil, err
+		}
+	case "export":
+		if holdings, ok := Holdings.Get(teamID, userID, opts.Name); ok {
+			payload = map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          fmt.Sprintf("```\n%s```", HoldingsCSV(holdings)),
+			}
+		} else {
+			payload = unknownPortfolio(opts.Name, l)
+		}
+	case "delete":
+		if _, ok := Holdings.Get(teamID, userID, opts.Name); !ok {
+			payload = unknownPortfolio(opts.Name, l)
+		} else if err := Holdings.Delete(teamID, userID, opts.Name); err != nil {
+			return nil, err
+		} else {
+			payload = map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          l.Tf("Deleted portfolio _%s_", opts.Name),
+			}
+		}
+	case "leaderboard":
+		payload = BuildLeaderboardPayload(teamID, req.FormValue("channel_id"), l, req.Context())
+	case "buy", "sell":
+		payload = PaperTrade(opts, teamID, userID, req.FormValue("channel_id"), l, req.Context())
+	}
+	return payload, nil
+}
+
+// unknownPortfolio explains that a user has no portfolio by that name.
+func unknownPortfolio(name string, l *Locale) map[string]interface{} {
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text": l.Tf("You don't have a portfolio called _%s_ (see `/portfolio list`)",
+			name),
+	}
+}
+
+// BuildPortfolioListPayload lists a user's portfolios.
+func BuildPortfolioListPayload(names []string, l *Locale) map[string]interface{} {
+	text := l.Tf("Your portfolios: _%s_", paperPortfolioName)
+	for _, name := range names {
+		text += fmt.Sprintf(", _%s_", name)
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+}
+
+// ImportPortfolio stores holdings pasted along with the command, or, if
+// there weren't any, opens a modal to paste them into.
+func ImportPortfolio(opts PortfolioOpts, l *Locale, req *http.Request) (map[string]interface{}, error) {
+	teamID := req.FormValue("team_id")
+	userID := req.FormValue("user_id")
+	if opts.CSV != "" {
+		holdings, err := ParseHoldingsCSV(strings.NewReader(opts.CSV))
+		if err != nil {
+			return map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          l.Tf("*Error:* %s", err),
+			}, nil
+		}
+		if err := Holdings.Save(teamID, userID, opts.Name, holdings); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text": l.Tf("Imported %d holdings into portfolio _%s_",
+				len(holdings), opts.Name),
+		}, nil
+	}
+
+	inst, ok := InstallationFromContext(req.Context())
+	triggerID := req.FormValue("trigger_id")
+	if !ok || triggerID == "" {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text": l.T("Paste your holdings after the portfolio name, one per line:\n" +
+				"`/portfolio import name`\n`AAPL,10,1500.00`\n`MSFT,5,1000.00`"),
+		}, nil
+	}
+	view := PortfolioImportView(opts.Name, req.FormValue("channel_id"))
+	if err := SlackFromContext(req.Context()).OpenView(inst.BotToken, triggerID, view); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          l.T("Opening the import form..."),
+	}, nil
+}
+
+// PaperTrade executes a buy or sell at the current price, and describes the
+// result.
+func PaperTrade(opts PortfolioOpts, teamID, userID, channelID string, l *Locale, ctx context.Context) map[string]interface{} {
+	fail := func(text string) map[string]interface{} {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          text,
+		}
+	}
+	quotes, err := YahooFromContext(ctx).GetTickers([]string{opts.Symbol})
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return fail(l.Tf("An error occurred looking up _%s_", opts.Symbol))
+	}
+	if len(quotes) == 0 || quotes[0].RegularMarketPrice == 0 {
+		return fail(l.Tf("Unknown ticker symbol _%s_", opts.Symbol))
+	}
+	quote := quotes[0]
+	if quote.ExchangeDataDelayedBy > 0 && Config().PaperRejectDelayed {
+		return fail(l.Tf("Quotes for _%s_ are delayed by %d minutes, so it can't be traded here",
+			opts.Symbol, quote.ExchangeDataDelayedBy))
+	}
+
+	price, currency := NormalizeCurrency(quote.RegularMarketPrice, quote.Currency)
+	if currency == "" {
+		currency = paperCurrency
+	}
+	rate, err := YahooFromContext(ctx).GetFXRate(currency, paperCurrency)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return fail(l.Tf("An error occurred converting %s to %s", currency, paperCurrency))
+	}
+	trade := Trade{
+		Time:      time.Now().UTC(),
+		TeamID:    teamID,
+		UserID:    userID,
+		ChannelID: channelID,
+		Side:      opts.Action,
+		Symbol:    quote.Symbol,
+		Quantity:  opts.Quantity,
+		Price:     price,
+		Currency:  currency,
+		FXRate:    rate,
+		DelayedBy: quote.ExchangeDataDelayedBy,
+	}
+	if err := Portfolios.Execute(trade); err != nil {
+		if te, ok := err.(TradeError); ok {
+			return fail(te.Describe(l))
+		}
+		return fail(err.Error())
+	}
+
+	format := "<@%s> bought %s *%s* at %s (%s total)"
+	if trade.Side == "sell" {
+		format = "<@%s> sold %s *%s* at %s (%s total)"
+	}
+	text := l.Tf(format, userID, l.Number(trade.Quantity, -1), trade.Symbol,
+		l.Money(price, currency), l.Money(trade.Quantity*price*rate, paperCurrency))
+	if trade.DelayedBy > 0 {
+		text += "\n" + l.Tf(":warning: _this quote is delayed by %d minutes; the trade is flagged_",
+			trade.DelayedBy)
+	}
+	log.Printf("[%d] %s %s %s %v @ %0.4f %s\n", RequestID(ctx), userID, trade.Side,
+		trade.Symbol, trade.Quantity, price, currency)
+	return map[string]interface{}{
+		"response_type": "in_channel",
+		"text":          text,
+	}
+}
+
+// PortfolioValue is the current valuation of a set of positions.
+type PortfolioValue struct {
+	Total float64
+	Lines []string
+}
+
+// QuotePrices looks up the current price of every symbol in one batched
+// quote lookup, converted into paperCurrency, along with the quotes
+// themselves. Symbols without a quote are left out.
+func QuotePrices(symbols []string, ctx context.Context) (map[string]float64, map[string]APIResult, error) {
+	prices := map[string]float64{}
+	quotes := map[string]APIResult{}
+	if len(symbols) == 0 {
+		return prices, quotes, nil
+	}
+	results, err := YahooFromContext(ctx).GetTickers(symbols)
+	if err != nil {
+		return nil, nil, err
+	}
+	currencies := []string{}
+	for _, q := range results {
+		_, currency := NormalizeCurrency(q.RegularMarketPrice, q.Currency)
+		if currency == "" {
+			currency = paperCurrency
+		}
+		currencies = append(currencies, currency)
+	}
+	rates, err := YahooFromContext(ctx).GetFXRates(currencies, paperCurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, q := range results {
+		price, _ := NormalizeCurrency(q.RegularMarketPrice, q.Currency)
+		prices[q.Symbol] = price * rates[currencies[i]]
+		quotes[q.Symbol] = q
+	}
+	return prices, quotes, nil
+}
+
+// ValuePositions prices every position in one batched quote lookup, and
+// returns their total value in paperCurrency along with a line describing
+// each. Positions we can't price are valued at cost.
+func ValuePositions(positions map[string]*Position, l *Locale, ctx context.Context) (PortfolioValue, error) {
+	var value PortfolioValue
+	var symbols []string
+	for symbol := range positions {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	prices, quotes, err := QuotePrices(symbols, ctx)
+	if err != nil {
+		return value, err
+	}
+	for _, symbol := range symbols {
+		pos := positions[symbol]
+		qty := l.Number(pos.Quantity, -1)
+		price, ok := prices[symbol]
+		if !ok {
+			value.Lines = append(value.Lines, l.Tf("*%s* %s _(no price available)_",
+				symbol, qty))
+			value.Total += pos.Cost
+			continue
+		}
+		worth := pos.Quantity * price
+		gain := worth - pos.Cost
+		pct := 0.0
+		if pos.Cost != 0 {
+			pct = gain / pos.Cost * 100
+		}
+		value.Total += worth
+		quote := quotes[symbol]
+		line := fmt.Sprintf("*%s* %s @ %s = %s _(%s, %s)_", symbol, qty,
+			l.Money(quote.RegularMarketPrice, quote.Currency),
+			l.Money(worth, paperCurrency),
+			l.Money(gain, paperCurrency), l.SignedPercent(pct))
+		if quote.ExchangeDataDelayedBy > 0 {
+			line += " " + l.Tf(":hourglass: %dm delayed", quote.ExchangeDataDelayedBy)
+		}
+		value.Lines = append(value.Lines, line)
+	}
+	return value, nil
+}
+
+// paperReturn describes how a paper account worth total has done since it
+// was opened with start.
+func paperReturn(total, start float64, l *Locale) string {
+	if start == 0 {
+		return l.SignedPercent(0)
+	}
+	return l.SignedPercent((total/start - 1) * 100)
+}
+
+// BuildHoldingsPayload describes a paper account's holdings and profit or
+// loss, privately, to its owner.
+func BuildHoldingsPayload(acct PaperAccount, l *Locale, ctx context.Context) map[string]interface{} {
+	value, err := ValuePositions(acct.Positions, l, ctx)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.T("An error occurred valuing your portfolio"),
+		}
+	}
+	total := value.Total + acct.Cash
+	var text bytes.Buffer
+	fmt.Fprintln(&text, l.Tf("*Paper portfolio:* %s _(%s, %s since you started)_",
+		l.Money(total, paperCurrency),
+		l.Money(total-acct.StartingCash, paperCurrency),
+		paperReturn(total, acct.StartingCash, l)))
+	for _, line := range value.Lines {
+		fmt.Fprintln(&text, line)
+	}
+	fmt.Fprint(&text, l.Tf("Cash: %s", l.Money(acct.Cash, paperCurrency)))
+	if acct.DelayedTrades > 0 {
+		fmt.Fprint(&text, "\n"+l.Tf(":warning: %d trades made on delayed quotes", acct.DelayedTrades))
+	}
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text.String(),
+	}
+}
+
+// BuildLeaderboardPayload ranks everybody who has traded in a channel by
+// the current value of their paper account.
+func BuildLeaderboardPayload(teamID, channelID string, l *Locale, ctx context.Context) map[string]interface{} {
+	players := Portfolios.Players(teamID, channelID)
+	if len(players) == 0 {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.T("Nobody has traded in this channel yet."),
+		}
+	}
+
+	// Value everyone's holdings in a single quote lookup.
+	held := map[string]bool{}
+	var symbols []string
+	for _, acct := range players {
+		for symbol := range acct.Positions {
+			if !held[symbol] {
+				held[symbol] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	prices, _, err := QuotePrices(symbols, ctx)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.T("An error occurred valuing portfolios"),
+		}
+	}
+
+	type standing struct {
+		user    string
+		total   float64
+		start   float64
+		delayed int
+	}
+	var standings []standing
+	for user, acct := range players {
+		total := acct.Cash
+		for symbol, pos := range acct.Positions {
+			if price, ok := prices[symbol]; ok {
+				total += pos.Quantity * price
+			} else {
+				total += pos.Cost
+			}
+		}
+		standings = append(standings, standing{user, total, acct.StartingCash, acct.DelayedTrades})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		return standings[i].total > standings[j].total
+	})
+
+	var text bytes.Buffer
+	fmt.Fprintln(&text, l.T(":trophy: *Paper trading leaderboard*"))
+	for i, s := range standings {
+		fmt.Fprintf(&text, "%d. <@%s> %s _(%s)_", i+1, s.user,
+			l.Money(s.total, paperCurrency), paperReturn(s.total, s.start, l))
+		if s.delayed > 0 {
+			fmt.Fprint(&text, " "+l.Tf(":warning: %d delayed trades", s.delayed))
+		}
+		fmt.Fprintln(&text)
+	}
+	return map[string]interface{}{
+		"response_type": "in_channel",
+		"text":          strings.TrimSpace(text.String()),
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePortfolioCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		valid bool
+		opts  PortfolioOpts
+	}{
+		{"", true, PortfolioOpts{Action: "show"}},
+		{"leaderboard", true, PortfolioOpts{Action: "leaderboard"}},
+		{"buy 10 aapl", true, PortfolioOpts{Action: "buy", Quantity: 10, Symbol: "AAPL"}},
+		{"SELL 0.5 btc-usd", true, PortfolioOpts{Action: "sell", Quantity: 0.5, Symbol: "BTC-USD"}},
+		{"list", true, PortfolioOpts{Action: "list"}},
+		{"show paper", true, PortfolioOpts{Action: "show"}},
+		{"show Retirement", true, PortfolioOpts{Action: "show", Name: "retirement"}},
+		{"show bad!name", false, PortfolioOpts{}},
+		{"export", false, PortfolioOpts{}},
+		{"delete paper", false, PortfolioOpts{}},
+		{"import", true, PortfolioOpts{Action: "import"}},
+		{"import ira", true, PortfolioOpts{Action: "import", Name: "ira"}},
+		{"import ira AAPL,1,100 MSFT,2,200", true,
+			PortfolioOpts{Action: "import", Name: "ira", CSV: "AAPL,1,100\nMSFT,2,200"}},
+		{"import ira\nAAPL,1,100\nMSFT,2,200", true,
+			PortfolioOpts{Action: "import", Name: "ira", CSV: "AAPL,1,100\nMSFT,2,200"}},
+		{"buy aapl", false, PortfolioOpts{}},
+		{"buy -1 aapl", false, PortfolioOpts{}},
+		{"buy 1 spx", false, PortfolioOpts{}},
+		{"buy 1 EURUSD=X", false, PortfolioOpts{}},
+		{"short 1 AAPL", false, PortfolioOpts{}},
+	}
+	for i, test := range tests {
+		opts, err := ParsePortfolioCommand(test.input)
+		if test.valid && err != nil {
+			t.Errorf("%d. expected input to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected input to be invalid", i)
+		} else if test.valid && opts != test.opts {
+			t.Errorf("%d. expected %+v, got %+v", i, test.opts, opts)
+		}
+	}
+}
+
+func portfolioQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var results []string
+	for _, symbol := range strings.Split(r.URL.Query().Get("symbols"), ",") {
+		switch symbol {
+		case "AAPL":
+			results = append(results, `{"symbol":"AAPL","currency":"USD","regularMarketPrice":100}`)
+		case "VOD.L":
+			results = append(results, `{"symbol":"VOD.L","currency":"GBp","regularMarketPrice":5000,"exchangeDataDelayedBy":15}`)
+		case "GBPUSD=X":
+			results = append(results, `{"symbol":"GBPUSD=X","regularMarketPrice":2}`)
+		}
+	}
+	fmt.Fprintf(w, `{"quoteResponse":{"result":[%s]}}`, strings.Join(results, ","))
+}
+
+func TestPortfolioCommand(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(portfolioQuoteHandler))
+	defer ts.Close()
+	SetConfig(Configuration{PaperStartingCash: 10000})
+	Prefs = NewPrefsStore("")
+	Portfolios = NewPortfolioStore("", "")
+	Holdings = NewHoldingsStore("")
+	call := func(text string) map[string]interface{} {
+		form := url.Values{"text": {text}, "team_id": {"T1"}, "user_id": {"U1"}, "channel_id": {"C1"}}
+		req := httptest.NewRequest("POST", "/portfolio", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		ctx := WithYahoo(NewContext(req.Context(), req), NewYahoo(ts.URL))
+		if err := CommandHandler(PortfolioCommand)(w, req.WithContext(ctx)); err != nil {
+			t.Fatal("handler failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return payload
+	}
+
+	if text := call("help")["text"].(string); !strings.Contains(text, "`/portfolio leaderboard`") ||
+		!strings.Contains(text, "`/portfolio import`") {
+		t.Errorf("unexpected help %q", text)
+	}
+	if text := call("buy help")["text"].(string); !strings.HasPrefix(text, "*Usage:* `/portfolio buy [flags] quantity symbol`") {
+		t.Errorf("unexpected buy help %q", text)
+	}
+	if p := call("buy 1 AAPL"); p["response_type"] != "in_channel" {
+		t.Errorf("expected the trade to be announced, got %v", p)
+	}
+	if p := call("buy -private 1 AAPL"); p["response_type"] != "ephemeral" ||
+		!strings.Contains(p["text"].(string), "bought 1 *AAPL*") {
+		t.Errorf("expected a private trade, got %v", p)
+	}
+	if p := call(`import "ira" AAPL,1,100`); p["text"] != "Imported 1 holdings into portfolio _ira_" {
+		t.Errorf("unexpected import answer %v", p)
+	}
+	if p := call("holdings"); !strings.Contains(p["text"].(string), "*AAPL* 2 @") {
+		t.Errorf("unexpected holdings %v", p)
+	}
+	if p := call("frobnicate"); !strings.HasPrefix(p["text"].(string), "*Error:* unknown command 'frobnicate'") {
+		t.Errorf("expected an unknown command error, got %v", p)
+	}
+}
+
+func TestPaperTrading(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(portfolioQuoteHandler))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	journal := filepath.Join(dir, "trades.log")
+
+	SetConfig(Configuration{PaperStartingCash: 10000})
+	Portfolios = NewPortfolioStore(filepath.Join(dir, "portfolios.json"), journal)
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)), NewYahoo(ts.URL))
+
+	trades := []struct {
+		user  string
+		input string
+		ok    bool
+	}{
+		{"U1", "buy 50 AAPL", true},
+		{"U1", "buy 100 AAPL", false}, // can't afford it
+		{"U1", "sell 20 AAPL", true},
+		{"U1", "sell 40 AAPL", false}, // doesn't have them
+		{"U2", "buy 10 VOD.L", true},  // £50 = $100 a share, delayed
+	}
+	for i, trade := range trades {
+		opts, err := ParsePortfolioCommand(trade.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload := PaperTrade(opts, "T1", trade.user, "C1", English, ctx)
+		if ok := payload["response_type"] == "in_channel"; ok != trade.ok {
+			t.Errorf("%d. expected success %v, got %v", i, trade.ok, payload)
+		}
+	}
+
+	acct := Portfolios.Get("T1", "U1")
+	if acct.Cash != 7000 || acct.Positions["AAPL"].Quantity != 30 || acct.Positions["AAPL"].Cost != 3000 {
+		t.Errorf("unexpected account %+v %+v", acct, acct.Positions["AAPL"])
+	}
+	if acct := Portfolios.Get("T1", "U2"); acct.DelayedTrades != 1 || acct.Cash != 9000 {
+		t.Errorf("expected a flagged $1000 trade, got %+v", acct)
+	}
+
+	reloaded := NewPortfolioStore(filepath.Join(dir, "portfolios.json"), journal)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if acct := reloaded.Get("T1", "U1"); acct.Cash != 7000 || acct.StartingCash != 10000 {
+		t.Errorf("account not persisted: %+v", acct)
+	}
+
+	f, err := os.Open(journal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var journaled []Trade
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var trade Trade
+		if err := json.Unmarshal(scanner.Bytes(), &trade); err != nil {
+			t.Fatal(err)
+		}
+		journaled = append(journaled, trade)
+	}
+	if len(journaled) != 3 || journaled[2].DelayedBy != 15 || journaled[2].FXRate != 2 {
+		t.Errorf("unexpected journal %+v", journaled)
+	}
+
+	opts, _ := ParsePortfolioCommand("buy 1000 AAPL")
+	payload := PaperTrade(opts, "T1", "U1", "C1", German, ctx)
+	if payload["text"] != "Das kostet 100.000,00 $, aber du hast nur 7.000,00 $" {
+		t.Errorf("unexpected German refusal %q", payload["text"])
+	}
+	opts, _ = ParsePortfolioCommand("buy 0.5 AAPL")
+	payload = PaperTrade(opts, "T1", "U1", "C1", German, ctx)
+	if payload["text"] != "<@U1> hat 0,5 *AAPL* zu 100,00 $ gekauft (insgesamt 50,00 $)" {
+		t.Errorf("unexpected German trade %q", payload["text"])
+	}
+
+	changeTestConfig(func(c *Configuration) { c.PaperRejectDelayed = true })
+	opts, _ = ParsePortfolioCommand("buy 1 VOD.L")
+	if payload := PaperTrade(opts, "T1", "U2", "C1", English, ctx); payload["response_type"] != "ephemeral" {
+		t.Errorf("expected delayed trade to be refused, got %v", payload)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(portfolioQuoteHandler))
+	defer ts.Close()
+
+	SetConfig(Configuration{PaperStartingCash: 10000})
+	Portfolios = NewPortfolioStore("", "")
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)), NewYahoo(ts.URL))
+	Portfolios.Execute(Trade{TeamID: "T1", UserID: "U1", ChannelID: "C1",
+		Side: "buy", Symbol: "AAPL", Quantity: 10, Price: 50, FXRate: 1})
+	Portfolios.Execute(Trade{TeamID: "T1", UserID: "U2", ChannelID: "C1",
+		Side: "buy", Symbol: "AAPL", Quantity: 10, Price: 150, FXRate: 1, DelayedBy: 15})
+	Portfolios.Execute(Trade{TeamID: "T1", UserID: "U3", ChannelID: "C2",
+		Side: "buy", Symbol: "AAPL", Quantity: 1, Price: 1, FXRate: 1})
+
+	payload := BuildLeaderboardPayload("T1", "C1", English, ctx)
+	expected := ":trophy: *Paper trading leaderboard*\n" +
+		"1. <@U1> $10500.00 _(+5.00%)_\n" +
+		"2. <@U2> $9500.00 _(-5.00%)_ :warning: 1 delayed trades"
+	if payload["text"] != expected {
+		t.Errorf("expected %q, got %q", expected, payload["text"])
+	}
+	if payload := BuildLeaderboardPayload("T1", "C3", English, ctx); payload["response_type"] != "ephemeral" {
+		t.Errorf("expected empty leaderboard, got %v", payload)
+	}
+	payload = BuildLeaderboardPayload("T1", "C1", German, ctx)
+	expected = ":trophy: *Rangliste des Börsenspiels*\n" +
+		"1. <@U1> 10.500,00 $ _(+5,00 %)_\n" +
+		"2. <@U2> 9.500,00 $ _(-5,00 %)_ :warning: 1 verzögerte Trades"
+	if payload["text"] != expected {
+		t.Errorf("expected %q, got %q", expected, payload["text"])
+	}
+
+	// Returns are measured from what each account started with, whatever
+	// new accounts start with now.
+	changeTestConfig(func(c *Configuration) { c.PaperStartingCash = 0 })
+	payload = BuildLeaderboardPayload("T1", "C1", English, ctx)
+	if text, _ := payload["text"].(string); !strings.Contains(text, "<@U1> $10500.00 _(+5.00%)_") {
+		t.Errorf("expected U1's return to be unchanged, got %q", text)
+	}
+	holdings := BuildHoldingsPayload(Portfolios.Get("T1", "U1"), English, ctx)
+	if text, _ := holdings["text"].(string); !strings.Contains(text, "_($500.00, +5.00% since you started)_") {
+		t.Errorf("unexpected holdings %q", text)
+	}
+
+	// The players are copies, untouched by later trades.
+	players := Portfolios.Players("T1", "C1")
+	Portfolios.Execute(Trade{TeamID: "T1", UserID: "U1", ChannelID: "C1",
+		Side: "sell", Symbol: "AAPL", Quantity: 10, Price: 50, FXRate: 1})
+	if pos := players["U1"].Positions["AAPL"]; pos == nil || pos.Quantity != 10 {
+		t.Errorf("expected the copy to keep 10 AAPL, got %+v", pos)
+	}
+}
+
+func TestFractionalSell(t *testing.T) {
+	SetConfig(Configuration{PaperStartingCash: 10000})
+	Portfolios = NewPortfolioStore("", "")
+	for i := 0; i < 3; i++ {
+		Portfolios.Execute(Trade{TeamID: "T1", UserID: "U1", Side: "buy",
+			Symbol: "BTC-USD", Quantity: 0.1, Price: 100, FXRate: 1})
+	}
+	if err := Portfolios.Execute(Trade{TeamID: "T1", UserID: "U1", Side: "sell",
+		Symbol: "BTC-USD", Quantity: 0.3, Price: 100, FXRate: 1}); err != nil {
+		t.Fatal("expected to be able to sell everything:", err)
+	}
+	if acct := Portfolios.Get("T1", "U1"); len(acct.Positions) != 0 {
+		t.Errorf("expected the position to be closed, got %+v", acct.Positions["BTC-USD"])
+	}
+}
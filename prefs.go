@@ -0,0 +1,70 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"sync"
+)
+
+// UserPrefs are the per-user settings that persist between commands.
+type UserPrefs struct {
+	Currency   string   `json:",omitempty"`
+	Favourites []string `json:",omitempty"`
+	Recent     []string `json:",omitempty"`
+	Locale     string   `json:",omitempty"`
+}
+
+// PrefsStore is a persistent, concurrency-safe map of Slack users to their
+// preferences. Users are keyed by team and user ID, since user IDs are only
+// unique within a workspace.
+type PrefsStore struct {
+	sync.RWMutex
+	path  string
+	users map[string]UserPrefs
+}
+
+// NewPrefsStore creates an empty store backed by the file at path. If path
+// is empty, preferences are only kept in memory.
+func NewPrefsStore(path string) *PrefsStore {
+	return &PrefsStore{
+		path:  path,
+		users: map[string]UserPrefs{},
+	}
+}
+
+func prefsKey(teamID, userID string) string {
+	return teamID + ":" + userID
+}
+
+// Load replaces the contents of the store with what is saved on disk.
+func (s *PrefsStore) Load() error {
+	users := map[string]UserPrefs{}
+	if err := loadJSONFile(s.path, &users); err != nil {
+		return err
+	}
+	s.Lock()
+	s.users = users
+	s.Unlock()
+	return nil
+}
+
+// Get returns a user's preferences; users we have never seen get the zero
+// value.
+func (s *PrefsStore) Get(teamID, userID string) UserPrefs {
+	s.RLock()
+	defer s.RUnlock()
+	return s.users[prefsKey(teamID, userID)]
+}
+
+// Update applies fn to a user's preferences and persists the result.
+func (s *PrefsStore) Update(teamID, userID string, fn func(*UserPrefs)) error {
+	s.Lock()
+	defer s.Unlock()
+	key := prefsKey(teamID, userID)
+	prefs := s.users[key]
+	fn(&prefs)
+	s.users[key] = prefs
+	return saveJSONFile(s.path, s.users)
+}
@@ -0,0 +1,109 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/logic/slacker/slash"
+)
+
+// CanonicalCommand returns the name of the command that a command name
+// (lower-cased) stands for, looking through [CommandAliases], so policies
+// about a command apply whatever it's called.
+func CanonicalCommand(name string) string {
+	name = strings.ToLower(name)
+	for alias, command := range Config().CommandAliases {
+		if strings.ToLower(alias) == name {
+			return strings.ToLower(command)
+		}
+	}
+	return name
+}
+
+// withSettings hands a command's settings to its handler. They're decoded
+// afresh for every configuration, and never changed afterwards, so requests
+// can read them while a reload decodes the next ones.
+func withSettings(handler ErrorHandler, settings interface{}) ErrorHandler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return handler(w, req.WithContext(slash.WithSettings(req.Context(), settings)))
+	}
+}
+
+// decodeSettings decodes a command's section of the configuration into a
+// copy of its default settings.
+func decodeSettings(config *Configuration, r slash.Registration) (interface{}, error) {
+	defaults := reflect.ValueOf(r.Settings).Elem()
+	settings := reflect.New(defaults.Type())
+	settings.Elem().Set(defaults)
+	if err := config.DecodeCommandSettings(strings.TrimPrefix(r.Name, "/"), settings.Interface()); err != nil {
+		return nil, err
+	}
+	return settings.Interface(), nil
+}
+
+// BuildCommands decides which of the registered (and webhook) commands to
+// serve, and under what names, according to the configuration, and hands
+// each its settings.
+func BuildCommands(config *Configuration) (SlashCommands, error) {
+	return buildCommands(config, slash.Registrations())
+}
+
+func buildCommands(config *Configuration, registrations []slash.Registration) (SlashCommands, error) {
+	commands := SlashCommands{}
+	disabled := map[string]bool{}
+	for _, name := range config.DisabledCommands {
+		disabled[strings.ToLower(name)] = true
+	}
+	for _, r := range registrations {
+		if disabled[r.Name] {
+			continue
+		}
+		handler := ErrorHandler(r.Handler)
+		if r.Handler == nil {
+			handler = CommandHandler(r.Command)
+		}
+		if r.Settings != nil {
+			settings, err := decodeSettings(config, r)
+			if err != nil {
+				return nil, err
+			}
+			handler = withSettings(handler, settings)
+		}
+		commands[r.Name] = handler
+	}
+	for name, hook := range config.Webhooks {
+		name = strings.ToLower(name)
+		if disabled[name] {
+			continue
+		}
+		if _, ok := commands[name]; ok {
+			return nil, fmt.Errorf("Webhook command %s hides an existing command", name)
+		}
+		commands[name] = WebhookCommand(name, hook)
+	}
+	enabled := SlashCommands{}
+	for name, handler := range commands {
+		enabled[name] = handler
+	}
+	for alias, name := range config.CommandAliases {
+		alias, name = strings.ToLower(alias), strings.ToLower(name)
+		if !strings.HasPrefix(alias, "/") {
+			return nil, fmt.Errorf("Command alias '%s' must start with /", alias)
+		}
+		handler, ok := enabled[name]
+		if !ok {
+			return nil, fmt.Errorf("Command alias %s is for unknown or disabled command '%s'", alias, name)
+		}
+		if _, ok := commands[alias]; ok {
+			return nil, fmt.Errorf("Command alias %s hides an existing command", alias)
+		}
+		commands[alias] = handler
+	}
+	return commands, nil
+}
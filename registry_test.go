@@ -0,0 +1,91 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/logic/slacker/slash"
+)
+
+func TestBuildCommands(t *testing.T) {
+	type greetSettings struct {
+		Greeting string
+		Limit    int
+	}
+	defaults := greetSettings{Greeting: "hi", Limit: 1}
+	var settings *greetSettings
+	registrations := append(slash.Registrations(), slash.Registration{
+		Name: "/greet",
+		Handler: func(w http.ResponseWriter, req *http.Request) error {
+			settings = slash.SettingsFromContext(req.Context()).(*greetSettings)
+			return nil
+		},
+		Settings: &defaults,
+	})
+
+	var c Configuration
+	err := LoadConfig(&c, strings.NewReader(`
+DisabledCommands = ["/crypto"]
+[CommandAliases]
+"/stock" = "/ticker"
+[CommandSettings.greet]
+Greeting = "hello"
+Limit = 3
+`))
+	if err != nil {
+		t.Fatal("Error parsing TOML configuration:", err)
+	}
+	commands, err := buildCommands(&c, registrations)
+	if err != nil {
+		t.Fatal("BuildCommands failed:", err)
+	}
+	for _, name := range []string{"/ticker", "/stock", "/fx", "/portfolio", "/greet"} {
+		if commands[name] == nil {
+			t.Errorf("expected %s to be served", name)
+		}
+	}
+	if commands["/crypto"] != nil {
+		t.Error("expected /crypto to be disabled")
+	}
+	commands["/greet"](httptest.NewRecorder(), httptest.NewRequest("POST", "/cmd", nil))
+	if settings == nil || settings.Greeting != "hello" || settings.Limit != 3 {
+		t.Errorf("expected settings to be decoded, got %+v", settings)
+	}
+	if defaults.Greeting != "hi" || defaults.Limit != 1 {
+		t.Errorf("expected the defaults to be left alone, got %+v", defaults)
+	}
+
+	// A configuration without the section gets the defaults, and doesn't
+	// change what requests served by the first one see.
+	var bare Configuration
+	if err := LoadConfig(&bare, strings.NewReader("")); err != nil {
+		t.Fatal("Error parsing TOML configuration:", err)
+	}
+	first := settings
+	reloaded, err := buildCommands(&bare, registrations)
+	if err != nil {
+		t.Fatal("BuildCommands failed:", err)
+	}
+	reloaded["/greet"](httptest.NewRecorder(), httptest.NewRequest("POST", "/cmd", nil))
+	if settings.Greeting != "hi" || first.Greeting != "hello" {
+		t.Errorf("expected separate settings per configuration, got %+v and %+v", first, settings)
+	}
+
+	for _, aliases := range []map[string]string{
+		{"/coin": "/crypto"},
+		{"/coin": "/nonexistent"},
+		{"/fx": "/ticker"},
+		{"stock": "/ticker"},
+	} {
+		c.CommandAliases = aliases
+		if _, err := BuildCommands(&c); err == nil {
+			t.Errorf("expected aliases %v to be rejected", aliases)
+		}
+	}
+}
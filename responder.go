@@ -0,0 +1,128 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// responseBudget is how long a command gets to come up with an answer
+// before we acknowledge it and deliver the answer via its response URL
+// instead. Slack gives up on us after three seconds.
+var responseBudget = 2500 * time.Millisecond
+
+// pendingAnswers counts the answers we've deferred but not yet delivered.
+var pendingAnswers int64
+
+// QueueDepth is how many deferred answers are waiting to be delivered.
+func QueueDepth() int64 {
+	return atomic.LoadInt64(&pendingAnswers)
+}
+
+// Respond runs a command and delivers its answer: inline if it's ready in
+// time, or afterwards via the command's response URL if not (and if
+// Config.AsyncResponse allows it). Answers that don't say how they should be
+// shown are shown the given way, subject to the visibility policy; errors are
+// logged, and reported privately to whoever ran the command.
+func Respond(w http.ResponseWriter, req *http.Request, response string, run func() (map[string]interface{}, error)) error {
+	ctx := req.Context()
+	command := req.FormValue("command")
+	// Everything we need from the configuration is settled before the
+	// command runs, since it might reload it.
+	target := newResponseTarget(req)
+	responseURL := req.FormValue("response_url")
+	var budget <-chan time.Time
+	if Config().AsyncResponse && responseURL != "" {
+		budget = time.After(responseBudget)
+	}
+	answers := make(chan map[string]interface{}, 1)
+	// failed is only read once the answer has been received.
+	failed := false
+	go func() {
+		payload, err := run()
+		if err != nil {
+			log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+			NoteOutcome(ctx, "error")
+			failed = true
+			payload = map[string]interface{}{
+				"response_type": "ephemeral",
+				"text": LocaleFor(req.FormValue("team_id"), req.FormValue("user_id")).
+					Tf("An error occurred running `%s`", command),
+			}
+		}
+		if _, ok := payload["response_type"]; payload != nil && !ok {
+			payload["response_type"] = response
+		}
+		answers <- payload
+	}()
+
+	select {
+	case payload := <-answers:
+		if payload = target.Publish(ctx, payload); payload == nil {
+			// The command has already dealt with answering (by opening
+			// a modal, for example).
+			return nil
+		}
+		return WriteSlackResponse(w, payload)
+	case <-budget:
+		// An empty acknowledgement shows nothing, not even the command,
+		// so failures can still be reported privately later.
+		log.Printf("[%d] Deferring answer to %s\n", RequestID(ctx), command)
+		NoteOutcome(ctx, "deferred")
+		atomic.AddInt64(&pendingAnswers, 1)
+		go func() {
+			defer atomic.AddInt64(&pendingAnswers, -1)
+			payload := <-answers
+			outcome := "ok"
+			if failed {
+				outcome = "error"
+			}
+			if payload = target.Publish(ctx, payload); payload != nil {
+				if err := PostResponse(responseURL, payload, ctx); err != nil {
+					outcome = "undelivered"
+				}
+			}
+			AuditDelivery(ctx, outcome)
+		}()
+		return nil
+	}
+}
+
+// PostResponse delivers a message payload to a Slack response URL.
+func PostResponse(responseURL string, payload map[string]interface{}, ctx context.Context) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Couldn't marshal payload: %v", payload)
+		return err
+	}
+	client := providerClient("Slack responses", destinationResponses)
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(jsonPayload))
+	if err != nil {
+		log.Printf("[%d] POST failed for '%s': %s\n", RequestID(ctx),
+			responseURL, err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Printf("[%d] Couldn't read from '%s': %s\n",
+				RequestID(ctx), responseURL, err.Error())
+			return err
+		}
+		log.Printf("[%d] Got %d from %s: %s\n", RequestID(ctx),
+			resp.StatusCode, responseURL, string(body))
+		return fmt.Errorf("%s returned %d status", responseURL, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRespond(t *testing.T) {
+	posted := make(chan map[string]interface{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		posted <- payload
+	}))
+	defer ts.Close()
+	defer func(budget time.Duration) { responseBudget = budget }(responseBudget)
+	responseBudget = 20 * time.Millisecond
+
+	respond := func(run func() (map[string]interface{}, error)) (*httptest.ResponseRecorder, map[string]interface{}) {
+		form := url.Values{"command": {"/test"}, "response_url": {ts.URL}}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := Respond(w, req.WithContext(NewContext(req.Context(), req)), "in_channel", run); err != nil {
+			t.Fatal("Respond failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return w, payload
+	}
+	slow := func() (map[string]interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return map[string]interface{}{"text": "slow"}, nil
+	}
+
+	SetConfig(Configuration{AsyncResponse: true})
+	_, p := respond(func() (map[string]interface{}, error) {
+		return map[string]interface{}{"text": "quick"}, nil
+	})
+	if p["text"] != "quick" || p["response_type"] != "in_channel" {
+		t.Errorf("expected a quick inline answer, got %v", p)
+	}
+	_, p = respond(func() (map[string]interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if p["response_type"] != "ephemeral" || !strings.Contains(p["text"].(string), "`/test`") {
+		t.Errorf("expected a private error, got %v", p)
+	}
+
+	w, _ := respond(slow)
+	if w.Body.Len() != 0 {
+		t.Errorf("expected an empty acknowledgement, got `%s`", w.Body.String())
+	}
+	select {
+	case p := <-posted:
+		if p["text"] != "slow" || p["response_type"] != "in_channel" {
+			t.Errorf("unexpected deferred answer %v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("deferred answer was never posted")
+	}
+
+	SetConfig(Configuration{AsyncResponse: false})
+	if _, p := respond(slow); p["text"] != "slow" {
+		t.Errorf("expected a slow inline answer, got %v", p)
+	}
+}
+
+func TestAuditDeferredAnswers(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(budget time.Duration) { responseBudget = budget }(responseBudget)
+	responseBudget = 20 * time.Millisecond
+	SetConfig(Configuration{AsyncResponse: true})
+	Audit = NewAuditLog(dir, 0)
+	defer func() { Audit = NewAuditLog("", 0) }()
+
+	form := url.Values{"command": {"/test"}, "response_url": {ts.URL}}
+	req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	ctx, outcome := withAuditOutcome(NewContext(req.Context(), req),
+		AuditEntry{Time: time.Now().UTC(), UserID: "U1", Command: "/test"})
+	err = Respond(httptest.NewRecorder(), req.WithContext(ctx), "in_channel", func() (map[string]interface{}, error) {
+		time.Sleep(100 * time.Millisecond)
+		return nil, errors.New("boom")
+	})
+	if err != nil || outcome.String() != "deferred" {
+		t.Fatalf("expected the answer to be deferred, got %s (%v)", outcome, err)
+	}
+
+	// The dispatcher audits the acknowledgement; the delivery is audited
+	// once it's done.
+	for deadline := time.Now().Add(5 * time.Second); QueueDepth() > 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	entries, err := Audit.Query(AuditQuery{})
+	if err != nil {
+		t.Fatal("Query failed:", err)
+	}
+	if len(entries) != 1 || entries[0].Outcome != "error" || entries[0].Command != "/test" ||
+		entries[0].LatencyMS < 100 {
+		t.Errorf("expected the failed delivery to be audited, got %+v", entries)
+	}
+}
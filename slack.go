@@ -5,13 +5,26 @@
 package main
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// signatureMaxAge is how old a signed Slack request may be before we treat
+// it as a possible replay.
+const signatureMaxAge = 5 * time.Minute
+
 // SlashCommands represents a slack command and a handler for it
 type SlashCommands map[string]ErrorHandler
 
@@ -22,10 +35,16 @@ func SlackDispatcher(w http.ResponseWriter, req *http.Request) error {
 		return StatusError{http.StatusBadRequest,
 			errors.New("Only POST is supported")}
 	}
-	if len(Config.Tokens) > 0 {
+	if err := VerifySlackSignature(req); err != nil {
+		return StatusError{http.StatusUnauthorized, err}
+	}
+	// The request is checked and routed by the configuration as it was
+	// when it arrived, even if it's reloaded in the meantime.
+	config, commands := Published()
+	if len(config.Tokens) > 0 {
 		token := req.FormValue("token")
 		found := false
-		for _, t := range Config.Tokens {
+		for _, t := range config.Tokens {
 			if token == t {
 				found = true
 				break
@@ -37,6 +56,12 @@ func SlackDispatcher(w http.ResponseWriter, req *http.Request) error {
 		}
 	}
 
+	// Resolve the credentials of the workspace this command came from, so
+	// handlers can act on its behalf.
+	if inst, ok := Installations.Get(req.FormValue("team_id")); ok {
+		req = req.WithContext(WithInstallation(req.Context(), inst))
+	}
+
 	// All commands take a short-circuit "-version" argument.
 	if req.FormValue("text") == "-version" {
 		fmt.Fprint(w, versionString())
@@ -44,7 +69,7 @@ func SlackDispatcher(w http.ResponseWriter, req *http.Request) error {
 	}
 
 	command := strings.ToLower(req.FormValue("command"))
-	if handler, ok := Commands[command]; ok {
+	if handler, ok := commands[command]; ok {
 		log.Printf("[%d] %s@%s:%s %s %s",
 			RequestID(req.Context()),
 			req.FormValue("user_name"),
@@ -52,8 +77,91 @@ func SlackDispatcher(w http.ResponseWriter, req *http.Request) error {
 			req.FormValue("channel_name"),
 			command,
 			req.FormValue("text"))
-		return handler(w, req)
+		if CommandSwitchedOff(command) {
+			handler = switchedOff
+		}
+		start := time.Now()
+		entry := AuditEntry{
+			Time:        start.UTC(),
+			RequestID:   RequestID(req.Context()),
+			TeamID:      req.FormValue("team_id"),
+			TeamDomain:  req.FormValue("team_domain"),
+			ChannelID:   req.FormValue("channel_id"),
+			ChannelName: req.FormValue("channel_name"),
+			UserID:      req.FormValue("user_id"),
+			UserName:    req.FormValue("user_name"),
+			Command:     command,
+			Text:        req.FormValue("text"),
+		}
+		ctx, outcome := withAuditOutcome(req.Context(), entry)
+		err := handler(w, req.WithContext(ctx))
+		if err != nil {
+			NoteOutcome(ctx, "error")
+		}
+		entry.Outcome = outcome.String()
+		entry.LatencyMS = int64(time.Since(start) / time.Millisecond)
+		if err := Audit.Record(entry); err != nil {
+			log.Printf("[%d] Error writing audit log: %s", RequestID(ctx), err)
+		}
+		return err
 	}
 	return StatusError{http.StatusBadRequest,
 		fmt.Errorf("Command '%s' is invalid", command)}
 }
+
+// VerifySlackSignature checks the X-Slack-Signature header of a request
+// against our signing secret. The request body is consumed and replaced, so
+// it can still be read (or parsed as a form) afterwards. If no signing secret
+// is configured, every request is accepted.
+func VerifySlackSignature(req *http.Request) error {
+	if Config().SigningSecret == "" {
+		return nil
+	}
+	ts, err := strconv.ParseInt(req.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return errors.New("Missing or invalid request timestamp")
+	}
+	if math.Abs(time.Since(time.Unix(ts, 0)).Seconds()) > signatureMaxAge.Seconds() {
+		return errors.New("Request timestamp is too old")
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, []byte(Config().SigningSecret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(req.Header.Get("X-Slack-Signature"))) {
+		return errors.New("Request signature is invalid")
+	}
+	return nil
+}
+
+// SignedOnly serves requests that can only be trusted if Slack signed them,
+// such as events and interactions, which act on whichever workspace they
+// name. Without a signing secret, it's as if they weren't there.
+func SignedOnly(next ErrorHandler) ErrorHandler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if Config().SigningSecret == "" {
+			return StatusError{http.StatusNotFound,
+				errors.New("No SigningSecret is configured to verify requests with")}
+		}
+		return next(w, req)
+	}
+}
+
+// WriteSlackResponse marshals a message payload and writes it as the
+// immediate response to a Slack request.
+func WriteSlackResponse(w http.ResponseWriter, payload map[string]interface{}) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return StatusError{http.StatusInternalServerError,
+			fmt.Errorf("Could not marshal response: %+v", payload)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonPayload)
+	return nil
+}
@@ -5,6 +5,10 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -79,18 +83,18 @@ func TestSlackDispatcher(t *testing.T) {
 			"",
 		},
 	}
-	Config = Configuration{
+	SetConfig(Configuration{
 		Tokens:            []string{"valid-token"},
 		ListenAddress:     "127.0.0.1:8080",
 		AsyncResponse:     false,
 		HTTPClientTimeout: time.Duration(10) * time.Second,
-	}
+	})
 	handler := ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	})
-	Commands = SlashCommands{
+	SetCommands(SlashCommands{
 		"/valid-command": handler,
-	}
+	})
 	uri := "http://slacker.logic.github.io/cmd"
 
 	for _, test := range tests {
@@ -119,3 +123,38 @@ func TestSlackDispatcher(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifySlackSignature(t *testing.T) {
+	SetConfig(Configuration{SigningSecret: "8f742231b10e8888abcd99yyyzzz85a5"})
+	body := "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&command=%2Fhelpdesk"
+	ts := fmt.Sprintf("%d", time.Now().Unix())
+	mac := hmac.New(sha256.New, []byte(Config().SigningSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	sig := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	var tests = []struct {
+		ts    string
+		sig   string
+		valid bool
+	}{
+		{ts, sig, true},
+		{ts, "v0=deadbeef", false},
+		{"", sig, false},
+		{"1", sig, false},
+	}
+	for i, test := range tests {
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Slack-Request-Timestamp", test.ts)
+		req.Header.Set("X-Slack-Signature", test.sig)
+		err := VerifySlackSignature(req)
+		if test.valid && err != nil {
+			t.Errorf("%d. expected signature to be valid, got %s", i, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%d. expected signature to be invalid", i)
+		}
+		if test.valid && req.FormValue("team_id") != "T1DC2JH3J" {
+			t.Errorf("%d. request body was not preserved", i)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Slack is a Slack Web API, found at the URL its method names are appended
+// to.
+type Slack struct {
+	URL string
+	// Transport, if set, is what requests are made through, instead of
+	// the configured transport.
+	Transport http.RoundTripper
+}
+
+// SlackAPI is the real Slack Web API, which requests use unless their
+// context carries another.
+var SlackAPI = &Slack{URL: "https://slack.com/api/"}
+
+// NewSlack returns a Slack Web API served from base (a stand-in for
+// testing, say).
+func NewSlack(base string) *Slack {
+	return &Slack{URL: base + "/"}
+}
+
+// client returns an HTTP client for requests to this Slack Web API.
+func (s *Slack) client() *http.Client {
+	if s.Transport != nil {
+		return providerClientVia("Slack API", destinationSlack, s.Transport)
+	}
+	return providerClient("Slack API", destinationSlack)
+}
+
+const slackKey uint64 = 4
+
+// WithSlack attaches the Slack Web API to use to a context.
+func WithSlack(ctx context.Context, slack *Slack) context.Context {
+	return context.WithValue(ctx, slackKey, slack)
+}
+
+// SlackFromContext retrieves the Slack Web API attached to a context, or the
+// real one if there isn't one.
+func SlackFromContext(ctx context.Context) *Slack {
+	if slack, ok := ctx.Value(slackKey).(*Slack); ok {
+		return slack
+	}
+	return SlackAPI
+}
+
+// SlackResponse holds the fields common to every Slack Web API response.
+type SlackResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// Call posts a JSON-encoded request to a Slack Web API method using the
+// given (bot) token, and decodes the response into result, which may be nil
+// if the caller only cares about success.
+func (s *Slack) Call(method, token string, request interface{}, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return s.post(method, token, "application/json; charset=utf-8",
+		bytes.NewReader(body), result)
+}
+
+// CallForm is Call for the handful of methods (such as oauth.v2.access and
+// users.info) that expect form-encoded arguments.
+func (s *Slack) CallForm(method, token string, form url.Values, result interface{}) error {
+	return s.post(method, token, "application/x-www-form-urlencoded",
+		strings.NewReader(form.Encode()), result)
+}
+
+func (s *Slack) post(method, token, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest("POST", s.URL+method, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack API %s returned %d status", method,
+			resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var status SlackResponse
+	if err := json.Unmarshal(data, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return fmt.Errorf("Slack API %s returned `%s` error", method,
+			status.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// OpenView opens a modal in response to an interaction, identified by the
+// trigger ID Slack sent along with it.
+func (s *Slack) OpenView(token, triggerID string, view map[string]interface{}) error {
+	return s.Call("views.open", token, map[string]interface{}{
+		"trigger_id": triggerID,
+		"view":       view,
+	}, nil)
+}
+
+// PublishView sets a user's Home tab.
+func (s *Slack) PublishView(token, userID string, view map[string]interface{}) error {
+	return s.Call("views.publish", token, map[string]interface{}{
+		"user_id": userID,
+		"view":    view,
+	}, nil)
+}
+
+// PostMessage posts a message as the bot, returning its timestamp (which
+// is also how threads under it are identified).
+func (s *Slack) PostMessage(token string, message map[string]interface{}) (string, error) {
+	var result struct {
+		TS string `json:"ts"`
+	}
+	err := s.Call("chat.postMessage", token, message, &result)
+	return result.TS, err
+}
+
+// PostEphemeral posts a message to a channel that only one user can see.
+func (s *Slack) PostEphemeral(token, channel, user, text string) error {
+	return s.Call("chat.postEphemeral", token, map[string]interface{}{
+		"channel": channel,
+		"user":    user,
+		"text":    text,
+	}, nil)
+}
@@ -0,0 +1,430 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/logic/slacker/slash"
+)
+
+import "github.com/BurntSushi/toml"
+
+// SlackerCommand is the "/slacker" Slack slash command, for looking after
+// slacker itself. Only admins may use it.
+var SlackerCommand = &slash.Command{
+	Name: "/slacker",
+	Help: "Look after slacker (admins only).",
+	Subcommands: []*slash.Command{
+		{Name: "status", Help: "Show how slacker is doing.", Response: "ephemeral", Run: runStatus},
+		{Name: "config", Help: "Show the configuration, without secrets.", Response: "ephemeral", Run: runShowConfig},
+		{Name: "caches", Help: "Show how the caches are doing.", Response: "ephemeral", Run: runCaches},
+		{Name: "health", Help: "Show how the services slacker relies on are doing.", Response: "ephemeral", Run: runHealth},
+		{Name: "reload", Help: "Load the configuration file again.", Response: "ephemeral", Run: runReload},
+		{
+			Name:     "disable",
+			Args:     "command",
+			Help:     "Turn a command off until it's enabled again, or slacker restarts.",
+			Response: "ephemeral",
+			Run:      runSwitch(false),
+		},
+		{
+			Name:     "enable",
+			Args:     "command",
+			Help:     "Turn a command that was disabled back on.",
+			Response: "ephemeral",
+			Run:      runSwitch(true),
+		},
+		{
+			Name: "audit",
+			Args: "[symbol]",
+			Help: "Show who asked for what, most recent first.",
+			Flags: []slash.Flag{
+				{Name: "user", Default: "", Usage: "only show commands run by a `user` (like U0123ABCD or @someone)"},
+				{Name: "since", Default: "", Usage: "only show commands since a `time` (YYYY-MM-DD, RFC 3339, or a duration ago like 24h)"},
+				{Name: "until", Default: "", Usage: "only show commands before a `time`"},
+				{Name: "limit", Default: 20, Usage: "show at most this many `entries`"},
+			},
+			Response: "ephemeral",
+			Run:      runAudit,
+		},
+	},
+}
+
+func init() {
+	slash.Register(slash.Registration{
+		Name:    SlackerCommand.Name,
+		Help:    SlackerCommand.Help,
+		Handler: AdminOnly(CommandHandler(SlackerCommand)),
+	})
+}
+
+// IsAdmin reports whether a Slack user is one of Config.Admins.
+func IsAdmin(userID string) bool {
+	for _, admin := range Config().Admins {
+		if userID != "" && admin == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticated reports whether requests are checked against a verification
+// token or signature, so the user_id they carry can be believed.
+func Authenticated() bool {
+	return len(Config().Tokens) > 0 || Config().SigningSecret != ""
+}
+
+// AdminOnly restricts a command to Config.Admins; anyone else is told,
+// privately, that they can't use it. Without Tokens or a SigningSecret
+// anybody could claim to be an admin, so nobody is.
+func AdminOnly(next ErrorHandler) ErrorHandler {
+	return func(w http.ResponseWriter, req *http.Request) error {
+		if !Authenticated() || !IsAdmin(req.FormValue("user_id")) {
+			NoteOutcome(req.Context(), "denied")
+			l := LocaleFor(req.FormValue("team_id"), req.FormValue("user_id"))
+			return WriteSlackResponse(w, map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          l.Tf("Sorry, only admins can use `%s`", req.FormValue("command")),
+			})
+		}
+		return next(w, req)
+	}
+}
+
+// slackUserID extracts a user ID from a Slack mention like <@U0123|name>,
+// or returns what it's given.
+func slackUserID(s string) string {
+	if strings.HasPrefix(s, "<@") && strings.HasSuffix(s, ">") {
+		s = strings.TrimSuffix(strings.TrimPrefix(s, "<@"), ">")
+		if i := strings.IndexByte(s, '|'); i >= 0 {
+			s = s[:i]
+		}
+	}
+	return s
+}
+
+func runAudit(inv *slash.Invocation) (map[string]interface{}, error) {
+	l := localeOf(inv)
+	if Audit.dir == "" {
+		return map[string]interface{}{
+			"text": l.T("The audit log isn't kept without a DataDir"),
+		}, nil
+	}
+	q := AuditQuery{
+		UserID: slackUserID(inv.String("user")),
+		Limit:  inv.Int("limit"),
+	}
+	if len(inv.Args) > 1 {
+		return map[string]interface{}{"text": inv.Errorf("only one symbol at a time").Error()}, nil
+	} else if len(inv.Args) == 1 {
+		q.Symbol = inv.Args[0]
+	}
+	now := time.Now()
+	var err error
+	if s := inv.String("since"); s != "" {
+		if q.Since, err = ParseAuditTime(s, now); err != nil {
+			return map[string]interface{}{"text": inv.Errorf(auditTimeError, s).Error()}, nil
+		}
+	}
+	if s := inv.String("until"); s != "" {
+		if q.Until, err = ParseAuditTime(s, now); err != nil {
+			return map[string]interface{}{"text": inv.Errorf(auditTimeError, s).Error()}, nil
+		}
+	}
+
+	entries, err := Audit.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return map[string]interface{}{"text": l.T("No matching commands in the audit log")}, nil
+	}
+	var text bytes.Buffer
+	fmt.Fprintln(&text, l.Tf("*Audit log* (%d most recent)", len(entries)))
+	for _, e := range entries {
+		// Backquotes in what people typed would break out of the code
+		// span.
+		command := strings.Replace(strings.TrimSpace(e.Command+" "+e.Text), "`", "'", -1)
+		fmt.Fprintln(&text, l.Tf("`%s` <@%s> in <#%s> `%s` %s, %dms",
+			e.Time.UTC().Format("2006-01-02 15:04:05"), e.UserID, e.ChannelID,
+			command, e.Outcome, e.LatencyMS))
+	}
+	return map[string]interface{}{"text": strings.TrimSpace(text.String())}, nil
+}
+
+// switchedOffCommands are the commands admins have turned off with
+// /slacker disable.
+var switchedOffCommands = struct {
+	sync.RWMutex
+	names map[string]bool
+}{names: map[string]bool{}}
+
+// CommandSwitchedOff reports whether an admin has turned a command (under
+// any of its names) off.
+func CommandSwitchedOff(name string) bool {
+	switchedOffCommands.RLock()
+	defer switchedOffCommands.RUnlock()
+	return switchedOffCommands.names[CanonicalCommand(name)]
+}
+
+// SwitchCommand turns a command we serve on or off, along with its aliases.
+func SwitchCommand(name string, on bool) error {
+	name = strings.ToLower(name)
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+	if _, ok := Commands()[name]; !ok {
+		return SwitchError{Command: name}
+	}
+	name = CanonicalCommand(name)
+	if name == "/slacker" {
+		// Otherwise there'd be no way to turn anything back on.
+		return SwitchError{Command: name, Served: true}
+	}
+	switchedOffCommands.Lock()
+	defer switchedOffCommands.Unlock()
+	if on {
+		delete(switchedOffCommands.names, name)
+	} else {
+		switchedOffCommands.names[name] = true
+	}
+	return nil
+}
+
+// SwitchError is why SwitchCommand refused: the command isn't one we serve,
+// or it's one that can't be turned off.
+type SwitchError struct {
+	Command string
+	Served  bool
+}
+
+// Error describes the refusal in English.
+func (e SwitchError) Error() string { return e.Describe(English) }
+
+// Describe describes the refusal in the given locale.
+func (e SwitchError) Describe(l *Locale) string {
+	if !e.Served {
+		return l.Tf("`%s` isn't a command we serve", e.Command)
+	}
+	return l.Tf("`%s` can't be turned off", e.Command)
+}
+
+// switchedOff answers commands that have been turned off.
+func switchedOff(w http.ResponseWriter, req *http.Request) error {
+	NoteOutcome(req.Context(), "disabled")
+	l := LocaleFor(req.FormValue("team_id"), req.FormValue("user_id"))
+	return WriteSlackResponse(w, map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          l.Tf("`%s` has been turned off for now", strings.ToLower(req.FormValue("command"))),
+	})
+}
+
+func runSwitch(on bool) func(*slash.Invocation) (map[string]interface{}, error) {
+	return func(inv *slash.Invocation) (map[string]interface{}, error) {
+		if len(inv.Args) != 1 {
+			return map[string]interface{}{"text": inv.Errorf("which command?").Error()}, nil
+		}
+		if err := SwitchCommand(inv.Args[0], on); err != nil {
+			msg := err.Error()
+			if se, ok := err.(SwitchError); ok {
+				msg = se.Describe(localeOf(inv))
+			}
+			return map[string]interface{}{"text": inv.Errorf("%s", msg).Error()}, nil
+		}
+		state, text := "off", "Turned `%s` off"
+		if on {
+			state, text = "on", "Turned `%s` on"
+		}
+		log.Printf("[%d] %s turned %s %s", RequestID(inv.Request.Context()),
+			inv.Form("user_id"), state, inv.Args[0])
+		return map[string]interface{}{
+			"text": inv.Locale.Tf(text, strings.ToLower(inv.Args[0])),
+		}, nil
+	}
+}
+
+func runStatus(inv *slash.Invocation) (map[string]interface{}, error) {
+	var served, off []string
+	for name := range Commands() {
+		served = append(served, name)
+		if CommandSwitchedOff(name) {
+			off = append(off, name)
+		}
+	}
+	sort.Strings(served)
+	sort.Strings(off)
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	l := localeOf(inv)
+	var text bytes.Buffer
+	fmt.Fprintf(&text, "*%s*\n", versionString())
+	fmt.Fprintln(&text, l.Tf("• Up for %s", time.Since(startTime).Round(time.Second)))
+	fmt.Fprintln(&text, l.Tf("• Serving %s", strings.Join(served, ", ")))
+	if len(off) > 0 {
+		fmt.Fprintln(&text, l.Tf("• Turned off: %s", strings.Join(off, ", ")))
+	}
+	fmt.Fprintln(&text, l.Tf("• Installed in %d workspaces", Installations.Len()))
+	fmt.Fprintln(&text, l.Tf("• %d answers waiting to be delivered", QueueDepth()))
+	fmt.Fprint(&text, l.Tf("• %d goroutines, %s of heap", runtime.NumGoroutine(),
+		HumanizeNumber(float64(mem.HeapAlloc))+"B"))
+	return map[string]interface{}{"text": text.String()}, nil
+}
+
+// redacted is what secrets are replaced with in /slacker config.
+const redacted = "<redacted>"
+
+// RedactedConfig is the configuration, as TOML, with everything that isn't
+// tagged `config:"show"` hidden, so that secrets we add later, and commands'
+// own settings, stay hidden too.
+func RedactedConfig(c Configuration) (string, error) {
+	fields := redactedFields(reflect.ValueOf(c))
+	if c.HTTPProxy != "" {
+		// The proxy is worth seeing, just not its password.
+		fields["HTTPProxy"] = redactedProxy(c.HTTPProxy)
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(fields); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// redactedFields are a configuration struct's fields that are set, with the
+// ones that aren't tagged `config:"show"` redacted.
+func redactedFields(v reflect.Value) map[string]interface{} {
+	fields := map[string]interface{}{}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" ||
+			reflect.DeepEqual(v.Field(i).Interface(), reflect.Zero(field.Type).Interface()) {
+			continue
+		}
+		if field.Tag.Get("config") != "show" {
+			fields[field.Name] = redacted
+			continue
+		}
+		fields[field.Name] = redactedValue(v.Field(i))
+	}
+	return fields
+}
+
+// redactedValue is a shown field's value, with the fields of any structs in
+// it redacted in turn.
+func redactedValue(v reflect.Value) interface{} {
+	switch {
+	case v.Kind() == reflect.Struct:
+		return redactedFields(v)
+	case v.Kind() == reflect.Map && v.Type().Elem().Kind() == reflect.Struct:
+		values := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			values[fmt.Sprint(key.Interface())] = redactedFields(v.MapIndex(key))
+		}
+		return values
+	}
+	return v.Interface()
+}
+
+func runShowConfig(inv *slash.Invocation) (map[string]interface{}, error) {
+	config, err := RedactedConfig(*Config())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"text": "```" + config + "```"}, nil
+}
+
+func runCaches(inv *slash.Invocation) (map[string]interface{}, error) {
+	caches := map[string]*Cache{
+		"Home tab quotes": homeQuotes,
+		"User timezones":  userTimezones,
+	}
+	var names []string
+	for name := range caches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	l := localeOf(inv)
+	var text bytes.Buffer
+	for _, name := range names {
+		stats := caches[name].Stats()
+		fmt.Fprintln(&text, l.Tf("• *%s:* %d entries, %d hits, %d misses",
+			l.T(name), stats.Entries, stats.Hits, stats.Misses))
+	}
+	return map[string]interface{}{"text": strings.TrimSpace(text.String())}, nil
+}
+
+func runHealth(inv *slash.Invocation) (map[string]interface{}, error) {
+	l := localeOf(inv)
+	health := ProviderHealth()
+	if len(health) == 0 {
+		return map[string]interface{}{"text": l.T("No requests made to other services yet")}, nil
+	}
+	var text bytes.Buffer
+	for _, s := range health {
+		if s.Healthy() {
+			fmt.Fprint(&text, l.Tf("• :white_check_mark: *%s:* OK (%dms)", s.Name,
+				s.LastLatency/time.Millisecond))
+		} else {
+			fmt.Fprint(&text, l.Tf("• :x: *%s:* failing since %s: %s", s.Name,
+				s.LastFailure.UTC().Format("15:04:05 MST"), s.LastError))
+		}
+		fmt.Fprintln(&text, l.Tf(", %d of %d requests failed", s.Failures, s.Requests))
+	}
+	return map[string]interface{}{"text": strings.TrimSpace(text.String())}, nil
+}
+
+// reloading stops two reloads from publishing over each other.
+var reloading sync.Mutex
+
+// ReloadConfig loads the configuration file again, on top of the command
+// line flags, and starts serving the commands it describes. Nothing changes
+// if the file has a problem. Requests already being served carry on with
+// the configuration they started with.
+func ReloadConfig() error {
+	reloading.Lock()
+	defer reloading.Unlock()
+	c := flagConfig
+	f, err := os.Open(c.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := LoadConfig(&c, f); err != nil {
+		return err
+	}
+	commands, err := BuildCommands(&c)
+	if err != nil {
+		return err
+	}
+	old := Config().transport
+	Publish(c, commands)
+	// Connections made through the old transport won't be used again.
+	if t, ok := old.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	return Analytics.ForgetOptedOut()
+}
+
+func runReload(inv *slash.Invocation) (map[string]interface{}, error) {
+	if err := ReloadConfig(); err != nil {
+		log.Printf("[%d] Error reloading configuration: %s", RequestID(inv.Request.Context()), err)
+		return map[string]interface{}{
+			"text": inv.Locale.Tf("*Error:* %s", inv.Locale.Tf("couldn't reload %s: %s", flagConfig.File, err)),
+		}, nil
+	}
+	log.Printf("[%d] %s reloaded the configuration", RequestID(inv.Request.Context()), inv.Form("user_id"))
+	return map[string]interface{}{"text": inv.Locale.Tf("Reloaded %s", flagConfig.File)}, nil
+}
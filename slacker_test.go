@@ -0,0 +1,275 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slackerCall runs /slacker as a user, returning the answer's text.
+func slackerCall(t *testing.T, userID, text string) string {
+	form := url.Values{"command": {"/slacker"}, "text": {text}, "user_id": {userID}}
+	req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler := AdminOnly(CommandHandler(SlackerCommand))
+	if err := handler(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+		t.Fatal("handler failed:", err)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &payload)
+	if payload["response_type"] != "ephemeral" {
+		t.Errorf("%s: expected a private answer, got %v", text, payload)
+	}
+	return payload["text"].(string)
+}
+
+func TestSlackerAdminOnly(t *testing.T) {
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}})
+	Prefs = NewPrefsStore("")
+	if text := slackerCall(t, "U1", "audit"); text != "Sorry, only admins can use `/slacker`" {
+		t.Errorf("expected U1 to be refused, got %q", text)
+	}
+	if IsAdmin("") || !IsAdmin("UADMIN") {
+		t.Error("expected only UADMIN to be an admin")
+	}
+
+	// Without a token or signature to check, anyone could claim to be
+	// UADMIN.
+	SetConfig(Configuration{Admins: []string{"UADMIN"}})
+	if text := slackerCall(t, "UADMIN", "audit"); text != "Sorry, only admins can use `/slacker`" {
+		t.Errorf("expected unauthenticated requests to be refused, got %q", text)
+	}
+	changeTestConfig(func(c *Configuration) { c.SigningSecret = "shh" })
+	if text := slackerCall(t, "UADMIN", "audit"); strings.HasPrefix(text, "Sorry") {
+		t.Errorf("expected signed requests from UADMIN to be allowed, got %q", text)
+	}
+}
+
+func TestSlackerAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}})
+	Prefs = NewPrefsStore("")
+	Audit = NewAuditLog(dir, 0)
+	defer func() { Audit = NewAuditLog("", 0) }()
+
+	now := time.Now().UTC()
+	Audit.Record(AuditEntry{Time: now.Add(-time.Hour), UserID: "U1", ChannelID: "C1",
+		Command: "/ticker", Text: "AAPL", Outcome: "ok", LatencyMS: 120})
+	Audit.Record(AuditEntry{Time: now, UserID: "U2", ChannelID: "C1",
+		Command: "/ticker", Text: "`MSFT`", Outcome: "ok", LatencyMS: 80})
+
+	text := slackerCall(t, "UADMIN", "audit")
+	if !strings.HasPrefix(text, "*Audit log* (2 most recent)\n") ||
+		!strings.Contains(text, "<@U2> in <#C1> `/ticker 'MSFT'` ok, 80ms") {
+		t.Errorf("unexpected audit answer %q", text)
+	}
+	text = slackerCall(t, "UADMIN", "audit -user <@U1|alice> -since 2h")
+	if strings.Count(text, "\n") != 1 || !strings.Contains(text, "`/ticker AAPL` ok, 120ms") {
+		t.Errorf("unexpected audit answer for U1 %q", text)
+	}
+	if text := slackerCall(t, "UADMIN", "audit GOOG"); text != "No matching commands in the audit log" {
+		t.Errorf("unexpected audit answer for GOOG %q", text)
+	}
+	if text := slackerCall(t, "UADMIN", "audit -since whenever"); !strings.HasPrefix(text, "*Error:* 'whenever'") {
+		t.Errorf("expected a usage error, got %q", text)
+	}
+
+	changeTestConfig(func(c *Configuration) { c.Locale = "de" })
+	if text := slackerCall(t, "UADMIN", "audit"); !strings.HasPrefix(text, "*Audit-Log* (die 2 neuesten)\n") {
+		t.Errorf("unexpected German audit answer %q", text)
+	}
+	if text := slackerCall(t, "UADMIN", "audit -since whenever"); !strings.HasPrefix(text, "*Fehler:* 'whenever' ist kein Datum") {
+		t.Errorf("expected a German usage error, got %q", text)
+	}
+}
+
+func TestSlackerOperations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "slack.toml")
+	ioutil.WriteFile(file, []byte(`
+Admins = ["UADMIN"]
+ClientSecret = "shh"
+AnalyticsOptOut = ["T9"]
+[CommandAliases]
+"/money" = "/fx"
+[Webhooks."/deploy"]
+URL = "https://example.com/deploy"
+Secret = "s3cret"
+[CommandSettings.quotes]
+APIKey = "k3y"
+`), 0600)
+	flagConfig = Configuration{File: file, ListenAddress: "127.0.0.1:8888", Tokens: Tokens{"secret"}}
+	defer func() { flagConfig = Configuration{} }()
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}})
+	Prefs = NewPrefsStore("")
+	commands, err := BuildCommands(Config())
+	if err != nil {
+		t.Fatal("BuildCommands failed:", err)
+	}
+	SetCommands(commands)
+	Analytics = NewAnalyticsStore("")
+	defer func() { Analytics = NewAnalyticsStore("") }()
+	Analytics.Record("T9", "C1", "U1", "AAPL", time.Now())
+
+	if text := slackerCall(t, "UADMIN", "status"); !strings.Contains(text, versionString()) ||
+		!strings.Contains(text, "/ticker") || !strings.Contains(text, "0 answers waiting") {
+		t.Errorf("unexpected status %q", text)
+	}
+	if text := slackerCall(t, "UADMIN", "reload"); text != "Reloaded "+file {
+		t.Errorf("unexpected reload answer %q", text)
+	}
+	if Commands()["/deploy"] == nil || Config().ListenAddress != "127.0.0.1:8888" {
+		t.Error("expected the reloaded configuration, on top of the flags")
+	}
+	if s := Analytics.Summary("T9", time.Time{}, time.Now().Add(time.Hour)); s.Lookups != 0 {
+		t.Errorf("expected a workspace that opted out on reload to be forgotten, got %+v", s)
+	}
+	text := slackerCall(t, "UADMIN", "config")
+	if strings.Contains(text, "shh") || strings.Contains(text, "s3cret") || strings.Contains(text, "k3y") ||
+		!strings.Contains(text, `ClientSecret = "<redacted>"`) || !strings.Contains(text, `Tokens = "<redacted>"`) ||
+		!strings.Contains(text, `CommandSettings = "<redacted>"`) ||
+		!strings.Contains(text, `URL = "https://example.com/deploy"`) {
+		t.Errorf("unexpected config %q", text)
+	}
+
+	if text := slackerCall(t, "UADMIN", "disable /FX"); text != "Turned `/fx` off" {
+		t.Errorf("unexpected disable answer %q", text)
+	}
+	if !CommandSwitchedOff("/money") {
+		t.Error("expected the /money alias to be turned off along with /fx")
+	}
+	form := url.Values{"command": {"/fx"}, "text": {"100 USD EUR"}, "user_id": {"U1"}, "token": {"secret"}}
+	req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := SlackDispatcher(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+		t.Fatal("SlackDispatcher failed:", err)
+	}
+	if !strings.Contains(w.Body.String(), "has been turned off for now") {
+		t.Errorf("expected /fx to be turned off, got %s", w.Body.String())
+	}
+	for _, bad := range []string{"disable /slacker", "disable /nonexistent", "enable"} {
+		if text := slackerCall(t, "UADMIN", bad); !strings.HasPrefix(text, "*Error:*") {
+			t.Errorf("%s: expected an error, got %q", bad, text)
+		}
+	}
+	if text := slackerCall(t, "UADMIN", "enable money"); text != "Turned `money` on" || CommandSwitchedOff("/fx") {
+		t.Errorf("expected /fx to be back on, got %q", text)
+	}
+
+	ioutil.WriteFile(file, []byte("Admins = 3\n"), 0600)
+	if text := slackerCall(t, "UADMIN", "reload"); !strings.HasPrefix(text, "*Error:* couldn't reload") ||
+		Commands()["/deploy"] == nil {
+		t.Errorf("expected a broken file to be refused, got %q", text)
+	}
+}
+
+func TestSlackerCaches(t *testing.T) {
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}})
+	homeQuotes = NewCache(time.Minute)
+	homeQuotes.Set("U1", nil)
+	homeQuotes.Get("U1")
+	homeQuotes.Get("U2")
+	if text := slackerCall(t, "UADMIN", "caches"); !strings.Contains(text, "• *Home tab quotes:* 1 entries, 1 hits, 1 misses") {
+		t.Errorf("unexpected cache stats %q", text)
+	}
+}
+
+func TestSlackerGerman(t *testing.T) {
+	SetConfig(Configuration{Admins: []string{"UADMIN"}, Tokens: Tokens{"secret"}, Locale: "de"})
+	Prefs = NewPrefsStore("")
+	commands, err := BuildCommands(Config())
+	if err != nil {
+		t.Fatal("BuildCommands failed:", err)
+	}
+	SetCommands(commands)
+	homeQuotes = NewCache(time.Minute)
+	for _, test := range []struct {
+		text string
+		want string
+	}{
+		{"status", "• 0 Antworten warten auf Zustellung"},
+		{"caches", "• *Kurse im Home-Tab:* 0 Einträge, 0 Treffer, 0 Fehlschläge"},
+		{"disable /slacker", "*Fehler:* `/slacker` kann nicht abgeschaltet werden"},
+		{"disable /nonexistent", "*Fehler:* `/nonexistent` ist kein Befehl, den wir anbieten"},
+		{"disable /fx", "`/fx` abgeschaltet"},
+		{"enable /fx", "`/fx` eingeschaltet"},
+	} {
+		if text := slackerCall(t, "UADMIN", test.text); !strings.Contains(text, test.want) {
+			t.Errorf("%s: expected %q in %q", test.text, test.want, text)
+		}
+	}
+}
+
+// TestReloadWhileDispatching is most useful with -race.
+func TestReloadWhileDispatching(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "slack.toml")
+	ioutil.WriteFile(file, []byte(`
+Admins = ["UADMIN"]
+Locale = "de"
+[CommandAliases]
+"/money" = "/fx"
+`), 0600)
+	flagConfig = Configuration{File: file, Tokens: Tokens{"secret"}}
+	defer func() { flagConfig = Configuration{} }()
+	Prefs = NewPrefsStore("")
+	if err := ReloadConfig(); err != nil {
+		t.Fatal("ReloadConfig failed:", err)
+	}
+	defer Publish(Configuration{}, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := ReloadConfig(); err != nil {
+				t.Error("ReloadConfig failed:", err)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		for _, command := range []string{"/money", "/slacker"} {
+			wg.Add(1)
+			go func(command string) {
+				defer wg.Done()
+				form := url.Values{"command": {command}, "text": {"help"},
+					"user_id": {"UADMIN"}, "token": {"secret"}}
+				req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				w := httptest.NewRecorder()
+				if err := SlackDispatcher(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+					t.Errorf("%s failed: %s", command, err)
+				} else if !strings.Contains(w.Body.String(), "Befehle") && !strings.Contains(w.Body.String(), "Aufruf") {
+					t.Errorf("%s: expected German help, got %s", command, w.Body.String())
+				}
+			}(command)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,269 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+// Package slash is the framework slash commands are built on: parsing their
+// arguments, describing how to use them, and registering them to be served.
+// Commands of your own can live in a package of their own, which registers
+// them from an init function and is imported for its side effects.
+package slash
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Tokenize splits a command line into arguments the way a shell would:
+// arguments are separated by any amount of whitespace, and can be quoted
+// with single or double quotes (including the curly ones Slack clients like
+// to substitute) or have characters escaped with a backslash.
+func Tokenize(line string) ([]string, error) {
+	var args []string
+	var arg bytes.Buffer
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote || (quote == '“' && r == '”') || (quote == '‘' && r == '’') {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '"' || r == '\'' || r == '“' || r == '‘':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Locale translates messages into the language whoever ran a command is
+// answered in.
+type Locale interface {
+	T(msg string) string
+	Tf(format string, a ...interface{}) string
+}
+
+// Flag describes one of a Command's flags. The type of its default value
+// (string, int, float64, bool or time.Duration) is the type of the flag. As
+// with the flag package, a `quoted` word in the usage names its argument.
+type Flag struct {
+	Name    string
+	Default interface{}
+	Usage   string
+}
+
+// Command is a slash command, or one of its subcommands, along with
+// everything needed to parse its arguments and describe it to people.
+type Command struct {
+	Name        string
+	Args        string // synopsis of the positional arguments
+	Help        string
+	Flags       []Flag
+	Subcommands []*Command
+	// Response is how answers are shown by default: "in_channel" or
+	// "ephemeral".
+	Response string
+	Run      func(inv *Invocation) (map[string]interface{}, error)
+}
+
+// Invocation is a parsed command line: the (sub)command being run, the
+// values of its flags, and its remaining arguments.
+type Invocation struct {
+	Command *Command
+	Path    string // the full command, like "/ticker alert add"
+	Args    []string
+	Request *http.Request
+	// Locale is the locale whoever ran the command is answered in.
+	Locale Locale
+	values map[string]interface{}
+}
+
+// String returns the value of a string flag.
+func (inv *Invocation) String(name string) string {
+	return *inv.values[name].(*string)
+}
+
+// Int returns the value of an int flag.
+func (inv *Invocation) Int(name string) int {
+	return *inv.values[name].(*int)
+}
+
+// Float64 returns the value of a float64 flag.
+func (inv *Invocation) Float64(name string) float64 {
+	return *inv.values[name].(*float64)
+}
+
+// Bool returns the value of a bool flag.
+func (inv *Invocation) Bool(name string) bool {
+	return *inv.values[name].(*bool)
+}
+
+// Duration returns the value of a time.Duration flag.
+func (inv *Invocation) Duration(name string) time.Duration {
+	return *inv.values[name].(*time.Duration)
+}
+
+// Form returns a field of the slash command request, if there is one.
+func (inv *Invocation) Form(name string) string {
+	if inv.Request == nil {
+		return ""
+	}
+	return inv.Request.FormValue(name)
+}
+
+// Errorf reports a problem with an invocation, followed by the help for
+// the command. The format is translated into the invocation's locale.
+func (inv *Invocation) Errorf(format string, a ...interface{}) error {
+	return inv.Command.UsageError(inv.Path, inv.Locale.Tf(format, a...), inv.Locale)
+}
+
+// UsageError reports a problem with a command line, followed by the help
+// for the command (which is found at path).
+func (c *Command) UsageError(path, msg string, l Locale) error {
+	return fmt.Errorf("%s\n%s", l.Tf("*Error:* %s", msg), c.HelpText(path, l))
+}
+
+// flagSet builds a FlagSet for the command's flags, and records where each
+// of their values will end up.
+func (c *Command) flagSet(path string, values map[string]interface{}, l Locale) *flag.FlagSet {
+	flags := flag.NewFlagSet(path, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if c.Run != nil {
+		values["private"] = flags.Bool("private", false, l.T("only show the answer to you"))
+	}
+	for _, f := range c.Flags {
+		usage := l.T(f.Usage)
+		switch def := f.Default.(type) {
+		case string:
+			values[f.Name] = flags.String(f.Name, def, usage)
+		case int:
+			values[f.Name] = flags.Int(f.Name, def, usage)
+		case float64:
+			values[f.Name] = flags.Float64(f.Name, def, usage)
+		case bool:
+			values[f.Name] = flags.Bool(f.Name, def, usage)
+		case time.Duration:
+			values[f.Name] = flags.Duration(f.Name, def, usage)
+		default:
+			panic(fmt.Sprintf("%s: flag -%s has unsupported type %T", path, f.Name, def))
+		}
+	}
+	return flags
+}
+
+// Parse works out which (sub)command a command line is for, and parses its
+// flags. Asking for help, or making a mistake, gets an error explaining how
+// to use the command, formatted for Slack and translated into the given
+// locale.
+func (c *Command) Parse(args []string, l Locale) (*Invocation, error) {
+	return c.parse(c.Name, args, l)
+}
+
+func (c *Command) parse(path string, args []string, l Locale) (*Invocation, error) {
+	if len(args) > 0 {
+		if args[0] == "help" {
+			return nil, errors.New(c.HelpText(path, l))
+		}
+		for _, sub := range c.Subcommands {
+			if strings.EqualFold(args[0], sub.Name) {
+				return sub.parse(path+" "+sub.Name, args[1:], l)
+			}
+		}
+	}
+
+	values := map[string]interface{}{}
+	flags := c.flagSet(path, values, l)
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil, errors.New(c.HelpText(path, l))
+	} else if err != nil {
+		return nil, c.UsageError(path, err.Error(), l)
+	}
+	if c.Run == nil {
+		if flags.NArg() == 0 {
+			return nil, errors.New(c.HelpText(path, l))
+		}
+		return nil, c.UsageError(path, l.Tf("unknown command '%s'", flags.Arg(0)), l)
+	}
+	return &Invocation{
+		Command: c,
+		Path:    path,
+		Args:    flags.Args(),
+		Locale:  l,
+		values:  values,
+	}, nil
+}
+
+// HelpText describes how to use a command, and what its flags and
+// subcommands are, formatted for Slack and translated into the given
+// locale.
+func (c *Command) HelpText(path string, l Locale) string {
+	var help bytes.Buffer
+	if c.Run != nil {
+		synopsis := path + " " + l.T("[flags]")
+		if c.Args != "" {
+			synopsis += " " + l.T(c.Args)
+		}
+		fmt.Fprintln(&help, l.Tf("*Usage:* `%s`", synopsis))
+	}
+	if c.Help != "" {
+		fmt.Fprintln(&help, l.T(c.Help))
+	}
+
+	if c.Run != nil {
+		fmt.Fprintln(&help, l.T("*Flags:*"))
+		flags := c.flagSet(path, map[string]interface{}{}, l)
+		flags.VisitAll(func(f *flag.Flag) {
+			name, usage := flag.UnquoteUsage(f)
+			if name != "" {
+				name = " " + name
+			}
+			fmt.Fprintf(&help, "• `-%s%s` %s", f.Name, name, usage)
+			if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+				fmt.Fprint(&help, " "+l.Tf("(default `%s`)", f.DefValue))
+			}
+			fmt.Fprintln(&help)
+		})
+	}
+
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintln(&help, l.T("*Commands:*"))
+		for _, sub := range c.Subcommands {
+			fmt.Fprintf(&help, "• `%s %s` %s\n", path, sub.Name, l.T(sub.Help))
+		}
+	}
+	return strings.TrimSpace(help.String())
+}
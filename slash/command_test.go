@@ -0,0 +1,147 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package slash
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// english is a Locale that leaves messages as they are.
+type english struct{}
+
+func (english) T(msg string) string { return msg }
+
+func (english) Tf(format string, a ...interface{}) string { return fmt.Sprintf(format, a...) }
+
+var English english
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input string
+		args  []string
+		valid bool
+	}{
+		{"", nil, true},
+		{"  AAPL  ", []string{"AAPL"}, true},
+		{"-period  5d\tAAPL", []string{"-period", "5d", "AAPL"}, true},
+		{`-search "apple inc"`, []string{"-search", "apple inc"}, true},
+		{`-search 'it''s'`, []string{"-search", "its"}, true},
+		{"-search “apple inc”", []string{"-search", "apple inc"}, true},
+		{`a\ b c\"d`, []string{"a b", `c"d`}, true},
+		{`'a\b'`, []string{`a\b`}, true},
+		{`""`, []string{""}, true},
+		{`"apple`, nil, false},
+		{`apple\`, nil, false},
+	}
+	for _, test := range tests {
+		args, err := Tokenize(test.input)
+		if test.valid != (err == nil) {
+			t.Errorf("%q: expected valid=%v, got %v", test.input, test.valid, err)
+		} else if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%q: expected %q, got %q", test.input, test.args, args)
+		}
+	}
+}
+
+func testCommand() *Command {
+	run := func(inv *Invocation) (map[string]interface{}, error) {
+		return map[string]interface{}{"text": inv.Path + " " + strings.Join(inv.Args, ",")}, nil
+	}
+	return &Command{
+		Name:     "/test",
+		Help:     "Test things.",
+		Response: "in_channel",
+		Subcommands: []*Command{
+			{
+				Name: "alert",
+				Help: "Manage alerts.",
+				Subcommands: []*Command{
+					{
+						Name:     "add",
+						Args:     "symbol price",
+						Help:     "Add an alert.",
+						Response: "ephemeral",
+						Flags: []Flag{
+							{"above", false, "alert when the price goes above"},
+							{"count", 1, "how many `times` to alert"},
+							{"ratio", 0.5, "a `ratio`"},
+							{"every", time.Minute, "how often to check"},
+							{"note", "", "a `note` to include"},
+						},
+						Run: run,
+					},
+				},
+			},
+			{Name: "list", Help: "List things.", Run: run},
+		},
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	c := testCommand()
+	inv, err := c.Parse([]string{"alert", "ADD", "-above", "-count", "3", "-ratio", "1.5",
+		"-every", "5m", "-note", "hi there", "AAPL", "200"}, English)
+	if err != nil {
+		t.Fatal("Parse failed:", err)
+	}
+	if inv.Path != "/test alert add" || !reflect.DeepEqual(inv.Args, []string{"AAPL", "200"}) {
+		t.Errorf("unexpected invocation %s %v", inv.Path, inv.Args)
+	}
+	if !inv.Bool("above") || inv.Int("count") != 3 || inv.Float64("ratio") != 1.5 ||
+		inv.Duration("every") != 5*time.Minute || inv.String("note") != "hi there" {
+		t.Errorf("unexpected flag values %v", inv.values)
+	}
+
+	if _, err := c.Parse([]string{"alert", "add", "-count", "x"}, English); err == nil ||
+		!strings.HasPrefix(err.Error(), "*Error:*") || !strings.Contains(err.Error(), "*Usage:* `/test alert add [flags] symbol price`") {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+	if _, err := c.Parse([]string{"bogus"}, English); err == nil || !strings.Contains(err.Error(), "unknown command 'bogus'") {
+		t.Errorf("expected an unknown command error, got %v", err)
+	}
+	for _, args := range [][]string{nil, {"help"}, {"-help"}} {
+		_, err := c.Parse(args, English)
+		if err == nil || !strings.Contains(err.Error(), "• `/test alert` Manage alerts.") {
+			t.Errorf("%v: expected help, got %v", args, err)
+		}
+	}
+}
+
+func TestCommandHelpText(t *testing.T) {
+	add := testCommand().Subcommands[0].Subcommands[0]
+	help := add.HelpText("/test alert add", English)
+	for _, line := range []string{
+		"*Usage:* `/test alert add [flags] symbol price`",
+		"• `-above` alert when the price goes above",
+		"• `-count times` how many times to alert (default `1`)",
+		"• `-every duration` how often to check (default `1m0s`)",
+		"• `-note note` a note to include",
+	} {
+		if !strings.Contains(help, line+"\n") {
+			t.Errorf("expected %q in help:\n%s", line, help)
+		}
+	}
+}
+
+func TestInvocationSettings(t *testing.T) {
+	inv, err := testCommand().Parse([]string{"list"}, English)
+	if err != nil {
+		t.Fatal("Parse failed:", err)
+	}
+	if inv.Settings() != nil {
+		t.Error("expected no settings without a request")
+	}
+	settings := &struct{ Greeting string }{"hello"}
+	inv.Request = httptest.NewRequest("POST", "/cmd", nil)
+	inv.Request = inv.Request.WithContext(WithSettings(inv.Request.Context(), settings))
+	if inv.Settings() != settings {
+		t.Errorf("expected the request's settings, got %v", inv.Settings())
+	}
+}
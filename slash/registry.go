@@ -0,0 +1,94 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package slash
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registration describes a slash command that can be served, so that the
+// command can be enabled, disabled, aliased and configured from the
+// configuration file without main knowing anything about it. It's served
+// either by Handler, or (if Handler isn't set) by running Command.
+type Registration struct {
+	Name    string // like "/ticker"
+	Help    string
+	Handler func(http.ResponseWriter, *http.Request) error
+	Command *Command
+	// Settings, if set, is a pointer to the command's default settings.
+	// Each configuration decodes its [CommandSettings.<name>] section
+	// (with <name> lacking the slash) into a copy of them, which the
+	// handler gets with SettingsFromContext.
+	Settings interface{}
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Registration{}
+)
+
+// Register makes a slash command available. It's meant to be called from
+// the init function of the file that defines the command, and panics if the
+// command has already been registered.
+func Register(r Registration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	r.Name = strings.ToLower(r.Name)
+	if !strings.HasPrefix(r.Name, "/") || (r.Handler == nil && r.Command == nil) {
+		panic(fmt.Sprintf("Invalid command registration %q", r.Name))
+	}
+	if _, ok := registry[r.Name]; ok {
+		panic(fmt.Sprintf("Command %s registered twice", r.Name))
+	}
+	registry[r.Name] = r
+}
+
+// RegisterCommand makes a command built on Command available.
+func RegisterCommand(c *Command) {
+	Register(Registration{Name: c.Name, Help: c.Help, Command: c})
+}
+
+// Registrations returns every registered command, in order.
+func Registrations() []Registration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var regs []Registration
+	for _, r := range registry {
+		regs = append(regs, r)
+	}
+	sort.Slice(regs, func(i, j int) bool { return regs[i].Name < regs[j].Name })
+	return regs
+}
+
+type contextKey int
+
+const settingsKey contextKey = 0
+
+// WithSettings attaches the settings a command is being run with to a
+// context.
+func WithSettings(ctx context.Context, settings interface{}) context.Context {
+	return context.WithValue(ctx, settingsKey, settings)
+}
+
+// SettingsFromContext retrieves the settings a command is being run with:
+// a pointer of the same type as its Registration's Settings, or nil if it
+// doesn't have any.
+func SettingsFromContext(ctx context.Context) interface{} {
+	return ctx.Value(settingsKey)
+}
+
+// Settings returns the settings the command is being run with, as
+// SettingsFromContext does.
+func (inv *Invocation) Settings() interface{} {
+	if inv.Request == nil {
+		return nil
+	}
+	return SettingsFromContext(inv.Request.Context())
+}
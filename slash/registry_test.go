@@ -0,0 +1,45 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package slash
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) error { return nil }
+	Register(Registration{Name: "/Greet", Handler: handler})
+	RegisterCommand(&Command{Name: "/wave", Help: "Wave."})
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "/greet")
+		delete(registry, "/wave")
+		registryMu.Unlock()
+	}()
+
+	var names []string
+	for _, r := range Registrations() {
+		names = append(names, r.Name)
+	}
+	if len(names) != 2 || names[0] != "/greet" || names[1] != "/wave" {
+		t.Errorf("expected /greet and /wave, in order, got %v", names)
+	}
+
+	for _, bad := range []Registration{
+		{Name: "/greet", Handler: handler},
+		{Name: "greet", Handler: handler},
+		{Name: "/nothing"},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %+v to panic", bad)
+				}
+			}()
+			Register(bad)
+		}()
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DataPath returns the location of a state file inside the configured data
+// directory, or an empty string if no data directory is configured (in which
+// case state is only kept in memory).
+func DataPath(name string) string {
+	if Config().DataDir == "" {
+		return ""
+	}
+	return filepath.Join(Config().DataDir, name)
+}
+
+// loadJSONFile decodes the JSON document stored at path into v. A missing
+// file is not an error; v is simply left untouched.
+func loadJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// saveJSONFile replaces the file at path with the JSON encoding of v. The
+// document is written to a temporary file first and renamed into place, so
+// a crash never leaves a half-written state file behind.
+func saveJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
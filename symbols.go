@@ -0,0 +1,78 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// defaultAliases are friendly names for symbols people can never remember.
+// Aliases from the configuration file are consulted first.
+var defaultAliases = map[string]string{
+	"spx":    "^GSPC",
+	"sp500":  "^GSPC",
+	"dow":    "^DJI",
+	"dji":    "^DJI",
+	"nasdaq": "^IXIC",
+	"ndx":    "^NDX",
+	"vix":    "^VIX",
+	"ftse":   "^FTSE",
+	"dax":    "^GDAXI",
+	"nikkei": "^N225",
+	"oil":    "CL=F",
+	"gold":   "GC=F",
+	"silver": "SI=F",
+	"es":     "ES=F",
+	"nq":     "NQ=F",
+}
+
+// symbolPatterns describe the shape of the symbols Yahoo Finance uses for
+// each kind of quote, keyed by the QuoteType it reports for them.
+var symbolPatterns = []struct {
+	QuoteType string
+	Pattern   *regexp.Regexp
+}{
+	// ^GSPC, ^DJI, ^N225
+	{"INDEX", regexp.MustCompile(`^\^[A-Z0-9.]+$`)},
+	// ES=F, CL=F, GC=F
+	{"FUTURE", regexp.MustCompile(`^[A-Z0-9]+=F$`)},
+	// AAPL, BRK-B, RDSA.L, 7203.T, and mutual funds like VFIAX
+	{"EQUITY", regexp.MustCompile(`^[A-Z0-9][A-Z0-9.]*(-[A-Z]{1,2})?$`)},
+	// BTC-USD, ETH-EUR, DOGE-USDT
+	{"CRYPTOCURRENCY", regexp.MustCompile(`^[A-Z0-9]+-[A-Z]{3,4}$`)},
+	// EURUSD=X, JPY=X
+	{"CURRENCY", regexp.MustCompile(`^([A-Z]{3}){1,2}=X$`)},
+}
+
+// ResolveSymbol turns what the user typed into a symbol, expanding any
+// alias for it.
+func ResolveSymbol(name string) string {
+	key := strings.ToLower(name)
+	if symbol, ok := Config().Aliases[key]; ok {
+		return strings.ToUpper(symbol)
+	}
+	if symbol, ok := defaultAliases[key]; ok {
+		return symbol
+	}
+	return strings.ToUpper(name)
+}
+
+// SymbolQuoteType guesses what kind of quote a symbol refers to from its
+// shape alone, returning an empty string if it isn't a valid symbol at all.
+func SymbolQuoteType(symbol string) string {
+	for _, p := range symbolPatterns {
+		if p.Pattern.MatchString(symbol) {
+			return p.QuoteType
+		}
+	}
+	return ""
+}
+
+// ValidSymbol reports whether a symbol is shaped like any kind of symbol
+// Yahoo Finance knows about.
+func ValidSymbol(symbol string) bool {
+	return SymbolQuoteType(symbol) != ""
+}
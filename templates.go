@@ -0,0 +1,207 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+)
+
+// QuoteView is what the /ticker templates are given to work with.
+type QuoteView struct {
+	Quote APIResult
+	// Name is the symbol, and the company's name if we know it.
+	Name string
+	// Direction is "up", "down" or "unchanged".
+	Direction string
+	// ChangePercent is the size of the change, whichever direction it was.
+	ChangePercent float64
+	// Price is the formatted price, and Converted the same with the
+	// user's preferred currency alongside, if they have one.
+	Price     string
+	Converted string
+	// PreviousClose is the formatted previous close (or NAV).
+	PreviousClose string
+	// AsOf is when the quote is from as plain text, and AsOfText the same
+	// as Slack markup, with any extended-hours trading on a second line.
+	AsOf     string
+	AsOfText string
+	// Locale is who's asking's locale, which the T, Percent and Money
+	// methods use.
+	Locale *Locale
+}
+
+func (v QuoteView) locale() *Locale {
+	if v.Locale == nil {
+		return English
+	}
+	return v.Locale
+}
+
+// T translates a message into the view's locale, formatting it with any
+// arguments.
+func (v QuoteView) T(format string, a ...interface{}) string {
+	return v.locale().Tf(format, a...)
+}
+
+// Percent formats a percentage the view's locale's way.
+func (v QuoteView) Percent(f float64) string {
+	return v.locale().Percent(f)
+}
+
+// Money formats an amount of money the view's locale's way.
+func (v QuoteView) Money(amount float64, code string) string {
+	return v.locale().Money(amount, code)
+}
+
+// defaultTickerTemplates are how a /ticker quote is laid out. Each can be
+// overridden, for everyone or for one workspace, in the configuration file.
+var defaultTickerTemplates = map[string]string{
+	"emoji": `{{if eq .Direction "down"}}:chart_with_downwards_trend:` +
+		`{{else if eq .Direction "up"}}:chart_with_upwards_trend:` +
+		`{{else}}:bar_chart:{{end}}`,
+	"color": `{{if eq .Direction "down"}}danger{{else if eq .Direction "up"}}good{{else}}warning{{end}}`,
+	"movement": `{{if eq .Direction "down"}}{{.T "down %s" (.Percent .ChangePercent)}}` +
+		`{{else if eq .Direction "up"}}{{.T "up %s" (.Percent .ChangePercent)}}` +
+		`{{else}}{{.T "unchanged"}}{{end}}`,
+	"change": `{{if eq .Quote.QuoteType "CRYPTOCURRENCY"}}_({{template "movement" .}} {{.T "in 24 hours"}})_ ` +
+		`{{else if eq .Quote.QuoteType "MUTUALFUND"}}_({{template "movement" .}} {{.T "from previous NAV of %s" .PreviousClose}})_ ` +
+		`{{else}}_({{template "movement" .}} {{.T "from previous close of %s" .PreviousClose}})_ {{end}}`,
+	"pretext":  `{{template "emoji" .}} *<https://finance.yahoo.com/q?s={{urlquery .Quote.Symbol}}|{{.Name}}>*`,
+	"text":     "*{{.Converted}}* {{template \"change\" .}}\n{{.AsOfText}}",
+	"fallback": `{{.Name}}: {{.Converted}} {{template "change" .}}{{.T "as of %s" .AsOf}}`,
+}
+
+var tickerTemplateFuncs = template.FuncMap{
+	"percent": func(f float64) string { return fmt.Sprintf("%0.2f%%", f) },
+	"money":   FormatMoney,
+}
+
+// sampleQuoteView is what templates are tried out on when they're loaded,
+// so mistakes show up at startup rather than on someone's lookup.
+var sampleQuoteView = QuoteView{
+	Quote: APIResult{
+		Symbol:                     "AAPL",
+		LongName:                   "Apple Inc.",
+		QuoteType:                  "EQUITY",
+		Currency:                   "USD",
+		RegularMarketPrice:         150,
+		RegularMarketChange:        1.5,
+		RegularMarketChangePercent: 1.01,
+		RegularMarketPreviousClose: 148.5,
+	},
+	Name:          "AAPL - Apple Inc.",
+	Direction:     "up",
+	ChangePercent: 1.01,
+	Price:         "$150.00",
+	Converted:     "$150.00",
+	PreviousClose: "$148.50",
+	AsOf:          "Jan 2 4:00PM EST",
+	AsOfText:      "as of Jan 2 4:00PM EST",
+}
+
+// sampleQuoteTypes are the kinds of quote templates are tried out on, since
+// the defaults (and so, likely, overrides) lay each out differently.
+var sampleQuoteTypes = []string{
+	"EQUITY", "ETF", "INDEX", "FUTURE", "MUTUALFUND", "CRYPTOCURRENCY", "CURRENCY",
+}
+
+// tryTemplates renders a template set for sample quotes of every kind,
+// going in every direction, so no branch of a template goes untried.
+func tryTemplates(set *template.Template) error {
+	for _, quoteType := range sampleQuoteTypes {
+		for _, direction := range []string{"up", "down", "unchanged"} {
+			view := sampleQuoteView
+			view.Quote.QuoteType = quoteType
+			view.Direction = direction
+			if _, err := RenderQuote(set, view); err != nil {
+				return fmt.Errorf("%s (for a %s quote that's %s)", err, quoteType, direction)
+			}
+		}
+	}
+	return nil
+}
+
+// NewTickerTemplates builds the /ticker templates: the defaults, with each
+// set of overrides applied in turn. Every template is tried out (see
+// tryTemplates) before it's returned.
+func NewTickerTemplates(overrides ...map[string]string) (*template.Template, error) {
+	set := template.New("ticker").Funcs(tickerTemplateFuncs)
+	var names []string
+	for name := range defaultTickerTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		template.Must(set.New(name).Parse(defaultTickerTemplates[name]))
+	}
+	for _, templates := range overrides {
+		for name, text := range templates {
+			if _, ok := defaultTickerTemplates[name]; !ok {
+				return nil, fmt.Errorf("Unknown ticker template '%s'", name)
+			}
+			if _, err := set.New(name).Parse(text); err != nil {
+				return nil, fmt.Errorf("Ticker template %s: %s", name, err)
+			}
+		}
+	}
+	if err := tryTemplates(set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// RenderQuote executes every template in a set for a quote.
+func RenderQuote(set *template.Template, view QuoteView) (map[string]string, error) {
+	out := map[string]string{}
+	for name := range defaultTickerTemplates {
+		var buf bytes.Buffer
+		if err := set.ExecuteTemplate(&buf, name, view); err != nil {
+			return nil, fmt.Errorf("Ticker template %s: %s", name, err)
+		}
+		out[name] = buf.String()
+	}
+	return out, nil
+}
+
+var (
+	defaultTemplatesOnce sync.Once
+	defaultTemplates     *template.Template
+)
+
+// CompileTemplates builds the /ticker templates for everyone, and for each
+// workspace that has its own.
+func CompileTemplates(config *Configuration) error {
+	all, err := NewTickerTemplates(config.Templates)
+	if err != nil {
+		return err
+	}
+	config.tickerTemplates = map[string]*template.Template{"": all}
+	for team, templates := range config.WorkspaceTemplates {
+		set, err := NewTickerTemplates(config.Templates, templates)
+		if err != nil {
+			return fmt.Errorf("Workspace %s: %s", team, err)
+		}
+		config.tickerTemplates[team] = set
+	}
+	return nil
+}
+
+// TickerTemplates returns the /ticker templates for a workspace.
+func TickerTemplates(teamID string) *template.Template {
+	if set, ok := Config().tickerTemplates[teamID]; ok {
+		return set
+	}
+	if set, ok := Config().tickerTemplates[""]; ok {
+		return set
+	}
+	defaultTemplatesOnce.Do(func() {
+		defaultTemplates = template.Must(NewTickerTemplates())
+	})
+	return defaultTemplates
+}
@@ -0,0 +1,72 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultTickerTemplates(t *testing.T) {
+	SetConfig(Configuration{})
+	view := sampleQuoteView
+	text, err := RenderQuote(TickerTemplates("T1"), view)
+	if err != nil {
+		t.Fatal("RenderQuote failed:", err)
+	}
+	expected := map[string]string{
+		"pretext":  ":chart_with_upwards_trend: *<https://finance.yahoo.com/q?s=AAPL|AAPL - Apple Inc.>*",
+		"text":     "*$150.00* _(up 1.01% from previous close of $148.50)_ \nas of Jan 2 4:00PM EST",
+		"fallback": "AAPL - Apple Inc.: $150.00 _(up 1.01% from previous close of $148.50)_ as of Jan 2 4:00PM EST",
+		"color":    "good",
+	}
+	for name, want := range expected {
+		if text[name] != want {
+			t.Errorf("%s: expected %q, got %q", name, want, text[name])
+		}
+	}
+
+	view.Direction = "unchanged"
+	view.Quote.QuoteType = "CRYPTOCURRENCY"
+	text, _ = RenderQuote(TickerTemplates("T1"), view)
+	if text["change"] != "_(unchanged in 24 hours)_ " || text["emoji"] != ":bar_chart:" {
+		t.Errorf("unexpected unchanged crypto quote %v", text)
+	}
+}
+
+func TestWorkspaceTemplates(t *testing.T) {
+	loadTestConfig(t, `
+[Templates]
+color = '{{if eq .Direction "up"}}#00ff00{{else}}#ff0000{{end}}'
+[WorkspaceTemplates.T2]
+emoji = ':moneybag:'
+`)
+	t1, _ := RenderQuote(TickerTemplates("T1"), sampleQuoteView)
+	t2, _ := RenderQuote(TickerTemplates("T2"), sampleQuoteView)
+	if t1["color"] != "#00ff00" || t2["color"] != "#00ff00" {
+		t.Errorf("expected the global color template everywhere, got %s and %s", t1["color"], t2["color"])
+	}
+	if !strings.HasPrefix(t1["pretext"], ":chart_with_upwards_trend: ") ||
+		!strings.HasPrefix(t2["pretext"], ":moneybag: ") {
+		t.Errorf("expected T2's own emoji, got %q and %q", t1["pretext"], t2["pretext"])
+	}
+
+	for _, bad := range []string{
+		"[Templates]\ncolor = '{{if}}'\n",
+		"[Templates]\nsparkle = 'x'\n",
+		"[Templates]\ntext = '{{.Nonexistent}}'\n",
+		"[WorkspaceTemplates.T2]\ntext = '{{template \"missing\" .}}'\n",
+		// Mistakes in branches the sample EQUITY quote going up never takes.
+		"[Templates]\ncolor = '{{if eq .Direction \"down\"}}{{.Nonexistent}}{{end}}'\n",
+		"[Templates]\ncolor = '{{if eq .Direction \"unchanged\"}}{{template \"missing\" .}}{{end}}'\n",
+		"[Templates]\ntext = '{{if eq .Quote.QuoteType \"INDEX\"}}{{.Quote.Nonexistent}}{{end}}'\n",
+		"[Templates]\ntext = '{{if eq .Quote.QuoteType \"MUTUALFUND\"}}{{index .Name 99}}{{end}}'\n",
+	} {
+		var c Configuration
+		if err := LoadConfig(&c, strings.NewReader(bad)); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -5,19 +5,18 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"regexp"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/logic/slacker/slash"
 )
 
 // TickerOpts represnts a set of parsed /ticker command options.
@@ -27,210 +26,713 @@ type TickerOpts struct {
 	Interval int
 	Type     string
 	Log      bool
+	Search   string
+	Detail   bool
+	Fav      bool
+	Unfav    bool
+	On       string
+	Range    string
+	Locale   string
+	Top      bool
+	Private  bool // only for answers posted later, via TickerPoster
+	TeamID   string
+	UserID   string
+}
+
+// TickerCommand is the "/ticker" Slack slash command.
+var TickerCommand = &slash.Command{
+	Name:     "/ticker",
+	Args:     "symbol",
+	Help:     "Look up a stock, index, future, fund, currency or coin.",
+	Response: "in_channel",
+	Flags: []slash.Flag{
+		{Name: "period", Default: "1d", Usage: "chart `period` [xd|xY]"},
+		{Name: "interval", Default: 60, Usage: "chart interval in `seconds`"},
+		{Name: "type", Default: "line", Usage: "chart `type` [line|bar|candle]"},
+		{Name: "log", Default: false, Usage: "use a logarithmic chart scale"},
+		{Name: "search", Default: false, Usage: "search for symbols matching a name"},
+		{Name: "detail", Default: false, Usage: "show valuation and earnings data"},
+		{Name: "fav", Default: false, Usage: "add the symbol to your favourites"},
+		{Name: "unfav", Default: false, Usage: "remove the symbol from your favourites"},
+		{Name: "on", Default: "", Usage: "show prices on a past `date` [YYYY-MM-DD]"},
+		{Name: "range", Default: "", Usage: "show prices over a past `range` [YYYY-MM-DD:YYYY-MM-DD]"},
+		{Name: "locale", Default: "", Usage: "answer in another `language` [en|de|default]"},
+		{Name: "top", Default: false, Usage: "show the most looked-up symbols this week"},
+	},
+	Run: tickerRunner(tickerOpts),
+}
+
+func init() {
+	slash.Register(slash.Registration{Name: TickerCommand.Name, Help: TickerCommand.Help, Handler: Ticker})
 }
 
 // ParseTickerCommand takes the /ticker command line and parses it into
 // TickerOpts, returning an error if anything goes wrong.
 func ParseTickerCommand(cmd string) (TickerOpts, error) {
-	var opts TickerOpts
-	var output bytes.Buffer
-	flags := flag.NewFlagSet("/ticker", flag.ContinueOnError)
-	flags.Usage = func() {
-		fmt.Fprintln(&output, "usage: /ticker [flags] symbol")
-		flags.PrintDefaults()
+	args, err := slash.Tokenize(cmd)
+	if err != nil {
+		return TickerOpts{}, TickerCommand.UsageError(TickerCommand.Name, err.Error(), English)
+	}
+	inv, err := TickerCommand.Parse(args, English)
+	if err != nil {
+		return TickerOpts{}, err
+	}
+	return tickerOpts(inv)
+}
+
+func tickerOpts(inv *slash.Invocation) (TickerOpts, error) {
+	opts := TickerOpts{
+		Period:   inv.String("period"),
+		Interval: inv.Int("interval"),
+		Type:     inv.String("type"),
+		Log:      inv.Bool("log"),
+		Detail:   inv.Bool("detail"),
+		Fav:      inv.Bool("fav"),
+		Unfav:    inv.Bool("unfav"),
+		On:       inv.String("on"),
+		Range:    inv.String("range"),
+		Locale:   inv.String("locale"),
+		Top:      inv.Bool("top"),
+	}
+
+	if inv.Bool("search") {
+		opts.Search = strings.Join(inv.Args, " ")
+		if opts.Search == "" {
+			return opts, inv.Errorf("nothing to search for")
+		}
+		return opts, nil
+	}
+
+	if opts.Top {
+		if len(inv.Args) > 0 {
+			return opts, inv.Errorf("-top doesn't take a symbol")
+		}
+		return opts, nil
+	}
+
+	if opts.Locale != "" {
+		if len(inv.Args) > 0 {
+			return opts, inv.Errorf("-locale doesn't take a symbol")
+		}
+		if _, ok := LookupLocale(opts.Locale); !ok && opts.Locale != "default" {
+			return opts, inv.Errorf("unknown locale '%s' (try %s)",
+				opts.Locale, strings.Join(LocaleTags(), ", "))
+		}
+		return opts, nil
 	}
-	flags.SetOutput(&output)
-	flags.StringVar(&opts.Period, "period", "1d", "period [xd|xY]")
-	flags.IntVar(&opts.Interval, "interval", 60, "interval [seconds]")
 
-	if err := flags.Parse(strings.Split(cmd, " ")); err != nil {
-		fmt.Fprintln(&output, err)
-		return opts, errors.New(output.String())
+	errs := ValidateTickerOpts(&opts, inv.Args)
+	for _, field := range tickerFields {
+		if msg, ok := errs[field]; ok {
+			msg = inv.Locale.T(msg)
+			if field == "symbol" && len(errs) == 1 && len(inv.Args) == 1 {
+				// A bad symbol doesn't need the whole usage message.
+				return opts, errors.New(inv.Locale.Tf("*Error:* %s", msg))
+			}
+			return opts, inv.Errorf("%s", msg)
+		}
 	}
+	return opts, nil
+}
+
+// tickerFields are the TickerOpts that ValidateTickerOpts checks, in the
+// order their errors are reported.
+var tickerFields = []string{"period", "interval", "type", "on", "range", "symbol"}
+
+// ValidateTickerOpts checks (and normalizes) the options for a /ticker
+// lookup, given the symbols the user asked for. It returns a description of
+// what's wrong with each invalid option, keyed by field name, so it can be
+// shared between the command line and the /ticker modal.
+func ValidateTickerOpts(opts *TickerOpts, symbols []string) map[string]string {
+	errs := map[string]string{}
 
-	if value, err := strconv.Atoi(opts.Period[0 : len(opts.Period)-1]); value == 0 || err != nil {
-		fmt.Fprintln(&output, "*Error:* period must be a positive number (followed by [d|Y])")
-		flags.Usage()
-		return opts, errors.New(output.String())
+	if len(opts.Period) < 2 {
+		errs["period"] = "period must be a positive number (followed by [d|Y])"
+	} else if value, err := strconv.Atoi(opts.Period[0 : len(opts.Period)-1]); value <= 0 || err != nil {
+		errs["period"] = "period must be a positive number (followed by [d|Y])"
+	} else {
+		switch opts.Period[len(opts.Period)-1] {
+		case 'd', 'Y':
+			break
+		default:
+			errs["period"] = "period must be one of 'd' (days) or 'Y' (years)"
+		}
 	}
-	switch opts.Period[len(opts.Period)-1] {
-	case 'd', 'Y':
+
+	if opts.Interval < 0 {
+		errs["interval"] = "interval must be zero or more seconds"
+	}
+
+	opts.Type = strings.ToLower(opts.Type)
+	switch opts.Type {
+	case "":
+		opts.Type = "line"
+	case "line", "bar", "candle":
 		break
 	default:
-		fmt.Fprintln(&output, "*Error:* period must be one of 'd' (days) or 'Y' (years)")
-		flags.Usage()
-		return opts, errors.New(output.String())
+		errs["type"] = "chart type must be one of 'line', 'bar' or 'candle'"
 	}
 
-	if flags.NArg() != 1 || flags.Arg(0) == "" {
-		if flags.NArg() <= 1 {
-			fmt.Fprintln(&output, "*Error:* no ticker symbol specified")
-		} else {
-			fmt.Fprintln(&output, "*Error:* only one ticker symbol at a time")
+	if opts.On != "" || opts.Range != "" {
+		if _, _, err := ParseHistoryRange(opts.On, opts.Range, time.Now()); err != nil {
+			if opts.Range != "" && opts.On == "" {
+				errs["range"] = err.Error()
+			} else {
+				errs["on"] = err.Error()
+			}
 		}
-		flags.Usage()
-		return opts, errors.New(output.String())
 	}
 
-	opts.Symbol = strings.ToUpper(flags.Arg(0))
-	if regexp.MustCompile(`[^A-Z0-9.]+`).MatchString(opts.Symbol) {
-		return opts, errors.New("*Error:* Invalid ticker symbol (letters, numbers, and '.' only)")
+	if len(symbols) != 1 || symbols[0] == "" {
+		if len(symbols) <= 1 {
+			errs["symbol"] = "no ticker symbol specified"
+		} else {
+			errs["symbol"] = "only one ticker symbol at a time"
+		}
+	} else {
+		opts.Symbol = ResolveSymbol(symbols[0])
+		if !ValidSymbol(opts.Symbol) {
+			errs["symbol"] = "Invalid ticker symbol (like AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD or EURUSD=X)"
+		}
 	}
+	return errs
+}
 
-	return opts, nil
+// ChartURL returns the URL of a chart image for a symbol. Google's chart
+// service only does plain line charts, so for anything fancier we use
+// Yahoo's (see doc/YahooChartAPI.md).
+func ChartURL(symbol string, opts TickerOpts) string {
+	if (opts.Type == "" || opts.Type == "line") && !opts.Log {
+		// The "fresh" parameter is non-standard, but is used
+		// to defeat any caching here.
+		return fmt.Sprintf(
+			"https://finance.google.com/finance/getchart?q=%s&p=%s&i=%d&fresh=%d",
+			url.QueryEscape(symbol),
+			opts.Period, opts.Interval, time.Now().Unix())
+	}
+	scale := "off"
+	if opts.Log {
+		scale = "on"
+	}
+	chartType := "l"
+	if opts.Type != "" {
+		chartType = opts.Type[0:1]
+	}
+	return fmt.Sprintf("https://chart.finance.yahoo.com/z?s=%s&t=%s&q=%s&l=%s&z=m&fresh=%d",
+		url.QueryEscape(symbol), strings.ToLower(opts.Period), chartType, scale,
+		time.Now().Unix())
 }
 
 // Ticker is the handler for the "/ticker" Slack slash command.
 func Ticker(w http.ResponseWriter, req *http.Request) error {
-	var payload map[string]interface{}
+	// With nothing to go on, offer a form rather than a usage message, if
+	// we can.
+	inst, ok := InstallationFromContext(req.Context())
+	triggerID := req.FormValue("trigger_id")
+	text := strings.TrimSpace(req.FormValue("text"))
+	if (text == "" || text == "-private") && ok && triggerID != "" {
+		l := LocaleFor(req.FormValue("team_id"), req.FormValue("user_id"))
+		return SlackFromContext(req.Context()).OpenView(inst.BotToken, triggerID,
+			TickerOptionsView(req.FormValue("response_url"), text == "-private", l))
+	}
 
-	opts, err := ParseTickerCommand(req.FormValue("text"))
-	if err != nil {
-		payload = map[string]interface{}{
-			"response_type": "ephemeral",
-			"text":          err.Error(),
+	return CommandHandler(TickerCommand)(w, req)
+}
+
+// tickerRunner builds a command that works out which quote it's being
+// asked for with the given function, and replies with it.
+func tickerRunner(parse func(*slash.Invocation) (TickerOpts, error)) func(*slash.Invocation) (map[string]interface{}, error) {
+	return func(inv *slash.Invocation) (map[string]interface{}, error) {
+		ctx := inv.Request.Context()
+		opts, err := parse(inv)
+		opts.TeamID = inv.Form("team_id")
+		opts.UserID = inv.Form("user_id")
+		if err != nil {
+			return map[string]interface{}{
+				"response_type": "ephemeral",
+				"text":          err.Error(),
+			}, nil
+		}
+		if opts.Search != "" {
+			return BuildSearchPayload(opts.Search, "", localeOf(inv), ctx), nil
+		}
+		if opts.Locale != "" {
+			return SetLocale(opts)
+		}
+		if opts.Top {
+			return TopSymbolsPayload(opts.TeamID, localeOf(inv), time.Now()), nil
+		}
+		if opts.Fav || opts.Unfav {
+			return UpdateFavourites(opts)
 		}
-	} else {
 
-		// We can either do responses in-line, if we think we can get it done
-		// in time before the Slack timeout. However, if we think the response
-		// will take too long, we can send the response asynchronously; the
-		// downside, though, is that we have to display the original "/ticker
-		// foo" command regardless of whether the lookup was successful,
-		// because we have to decide whether to show it here.
-		if Config.AsyncResponse {
-			responseURL := req.FormValue("response_url")
-			if len(responseURL) == 0 {
-				return StatusError{http.StatusBadRequest,
-					errors.New("No response URL supplied (Slack bug?)")}
-			}
-			go TickerPoster(opts, responseURL, req.Context())
-			payload = map[string]interface{}{
-				"response_type": "in_channel",
-			}
-		} else {
-			payload = BuildTickerPayload(opts, req.Context())
-			if _, ok := payload["attachments"]; !ok {
-				// In the async case, we'd want to deliver this as
-				// payload to the caller, but for immediate-response,
-				// we might as well log this like a normal error and
-				// return a more appropriate HTTP status code.
-				return StatusError{http.StatusInternalServerError,
-					errors.New(payload["text"].(string))}
+		payload := BuildTickerPayload(opts, ctx)
+		if _, ok := payload["response_type"]; !ok {
+			// Only the person who asked needs to see that it failed.
+			payload["response_type"] = "ephemeral"
+		} else if payload["response_type"] == "in_channel" && opts.TeamID != "" {
+			// Only symbols we found a quote for are remembered, so
+			// typos don't end up in recent lookups or statistics.
+			if err := RecordLookup(opts.TeamID, opts.UserID, opts.Symbol); err != nil {
+				log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
 			}
+			Analytics.Record(opts.TeamID, inv.Form("channel_id"), opts.UserID, opts.Symbol, time.Now())
 		}
+		return payload, nil
 	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return StatusError{http.StatusInternalServerError,
-			fmt.Errorf("Could not marshal response: %+v", payload)}
-	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonPayload)
-	return nil
 }
 
 // BuildTickerPayload formats the requested ticker symbol information into
 // a JSON payload for rendering to the user in Slack.
 func BuildTickerPayload(opts TickerOpts, ctx context.Context) map[string]interface{} {
+	if opts.On != "" || opts.Range != "" {
+		return BuildHistoryPayload(opts, ctx)
+	}
+	l := LocaleFor(opts.TeamID, opts.UserID)
 	payload := map[string]interface{}{}
-	quotes, err := GetTickers([]string{opts.Symbol})
+	quotes, err := YahooFromContext(ctx).GetTickers([]string{opts.Symbol})
 	if err != nil {
 		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
-		payload["text"] = fmt.Sprintf("An error occurred looking up _%s_", opts.Symbol)
+		payload["text"] = l.Tf("An error occurred looking up _%s_", opts.Symbol)
 	} else if (quotes == nil) || len(quotes) == 0 {
-		payload["text"] = fmt.Sprintf("Unknown ticker symbol _%s_", opts.Symbol)
+		// Maybe they typed a company name; see if there's anything
+		// close that we can offer them instead.
+		unknown := l.Tf("Unknown ticker symbol _%s_", opts.Symbol)
+		if suggestions := BuildSearchPayload(opts.Symbol, unknown, l, ctx); suggestions["blocks"] != nil {
+			return suggestions
+		}
+		payload["text"] = unknown
 	} else {
 		quote := quotes[0]
 		if err != nil {
 			payload["text"] = err.Error()
 		} else {
-			var emoji string
-			var color string
-			if quote.RegularMarketChange < 0 {
-				emoji = ":chart_with_downwards_trend:"
-				color = "danger"
-			} else if quote.RegularMarketChange > 0 {
-				emoji = ":chart_with_upwards_trend:"
-				color = "good"
-			} else {
-				emoji = ":bar_chart:"
-				color = "warning"
+			view := QuoteView{
+				Quote:     quote,
+				Name:      quote.Symbol,
+				Direction: "unchanged",
+				Locale:    l,
 			}
-
-			var name string
 			if len(quote.LongName) != 0 {
-				name = fmt.Sprintf("%s - %s", quote.Symbol, quote.LongName)
-			} else {
-				name = quote.Symbol
+				view.Name = fmt.Sprintf("%s - %s", quote.Symbol, quote.LongName)
 			}
-
-			var upDown string
 			if quote.RegularMarketChange < 0 {
-				upDown = fmt.Sprintf("down %0.2f%%",
-					quote.RegularMarketChangePercent*(-1))
+				view.Direction = "down"
+				view.ChangePercent = quote.RegularMarketChangePercent * (-1)
 			} else if quote.RegularMarketChange > 0 {
-				upDown = fmt.Sprintf("up %0.2f%%",
-					quote.RegularMarketChangePercent)
-			} else {
-				upDown = "unchanged"
+				view.Direction = "up"
+				view.ChangePercent = quote.RegularMarketChangePercent
 			}
 
+			// Indices are measured in points, not money.
 			price := quote.RegularMarketPrice
+			if quote.QuoteType == "INDEX" {
+				view.Price = l.Number(price, 2)
+				view.Converted = view.Price
+				view.PreviousClose = l.Number(quote.RegularMarketPreviousClose, 2)
+			} else {
+				view.Price = l.Money(price, quote.Currency)
+				view.Converted = view.Price
+				if conv := ConvertForUser(price, quote.Currency, opts, ctx); conv != "" {
+					view.Converted = fmt.Sprintf("%s (≈ %s)", view.Price, conv)
+				}
+				view.PreviousClose = l.Money(quote.RegularMarketPreviousClose, quote.Currency)
+			}
 
-			change := fmt.Sprintf("_(%s from previous close of $%0.2f)_ ",
-				upDown, quote.RegularMarketPreviousClose)
-
-			asOf := time.Unix(quote.RegularMarketTime, 0).Format(time.RFC822)
+			view.AsOf, view.AsOfText = FormatAsOf(quote,
+				UserLocation(ctx, opts.TeamID, opts.UserID), l)
+			if ext, ok := ExtendedHoursQuote(quote, l); ok {
+				view.AsOfText = fmt.Sprintf("%s\n%s", view.AsOfText, ext)
+			}
 
+			text, err := RenderQuote(TickerTemplates(opts.TeamID), view)
+			if err != nil {
+				log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+				payload["text"] = l.Tf("An error occurred looking up _%s_", opts.Symbol)
+				return payload
+			}
 			payload["attachments"] = []map[string]interface{}{{
-				"fallback": fmt.Sprintf("%s: $%0.2f %sas of %s",
-					name, price, change, asOf),
-				"pretext": fmt.Sprintf("%s *<https://finance.yahoo.com/q?s=%s|%s>*",
-					emoji, quote.Symbol, name),
-				"text":  fmt.Sprintf("*$%0.2f* %s\n%s", price, change, asOf),
-				"color": color,
-				// The "fresh" parameter is non-standard, but is used
-				// to defeat any caching here.
-				"image_url": fmt.Sprintf(
-					"https://finance.google.com/finance/getchart?q=%s&p=%s&i=%d&fresh=%d",
-					quote.Symbol,
-					opts.Period, opts.Interval, time.Now().Unix()),
+				"fallback":  text["fallback"],
+				"pretext":   text["pretext"],
+				"text":      text["text"],
+				"color":     text["color"],
+				"image_url": ChartURL(quote.Symbol, opts),
 				"mrkdwn_in": []string{"text", "pretext"},
+				"fields":    QuoteFields(quote, l),
 			}}
+			if opts.Detail {
+				payload["attachments"] = append(
+					payload["attachments"].([]map[string]interface{}),
+					FundamentalsAttachment(quote, l, time.Now()))
+			}
 			payload["response_type"] = "in_channel"
-			log.Printf("[%d] %s $%0.2f (%s)\n", RequestID(ctx),
-				quote.Symbol, price, change)
+			log.Printf("[%d] %s %s (%s)\n", RequestID(ctx),
+				quote.Symbol, view.Price, text["movement"])
 		}
 	}
 	return payload
 }
 
-// TickerPoster (as a goroutine) collects and formats the requested ticker
-// symbol information, and posts it back to Slack asynchronously.
-func TickerPoster(opts TickerOpts, responseURL string, ctx context.Context) {
-	payload := BuildTickerPayload(opts, ctx)
-	jsonPayload, err := json.Marshal(payload)
+// searchResultCount is how many candidate symbols we offer at once.
+const searchResultCount = 5
+
+// BuildSearchPayload looks up symbols matching a name, and formats them as
+// an ephemeral message with a button for each candidate. If the search finds
+// nothing, the payload has only text, explaining why.
+func BuildSearchPayload(query, preamble string, l *Locale, ctx context.Context) map[string]interface{} {
+	results, err := YahooFromContext(ctx).SearchSymbols(query, searchResultCount)
 	if err != nil {
-		log.Printf("Couldn't marshal payload: %v", payload)
-		return
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.Tf("An error occurred searching for _%s_", query),
+		}
 	}
-	resp, err := http.Post(responseURL, "application/json", bytes.NewReader(jsonPayload))
-	if err != nil {
-		log.Printf("[%d] POST failed for '%s': %s\n", RequestID(ctx),
-			responseURL, err.Error())
-		return
+	if len(results) == 0 {
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"text":          l.Tf("Nothing found matching _%s_", query),
+		}
 	}
-	if resp.StatusCode != http.StatusOK {
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("[%d] Couldn't read from '%s': %s\n",
-				RequestID(ctx), responseURL, err.Error())
-			return
+
+	text := l.Tf("Symbols matching _%s_:", query)
+	if preamble != "" {
+		text = l.Tf("%s. Did you mean one of these?", preamble)
+	}
+	var buttons []map[string]interface{}
+	for i, r := range results {
+		label := r.Symbol
+		if name := r.Name(); name != "" {
+			label = fmt.Sprintf("%s - %s", r.Symbol, name)
+		}
+		if r.ExchangeDisplay != "" {
+			label = fmt.Sprintf("%s (%s)", label, r.ExchangeDisplay)
+		}
+		// Slack refuses button labels longer than 75 characters.
+		if runes := []rune(label); len(runes) > 75 {
+			label = string(runes[:74]) + "…"
+		}
+		buttons = append(buttons, map[string]interface{}{
+			"type":      "button",
+			"action_id": fmt.Sprintf("ticker_select_%d", i),
+			"value":     r.Symbol,
+			"text": map[string]interface{}{
+				"type": "plain_text",
+				"text": label,
+			},
+		})
+	}
+	log.Printf("[%d] %d symbols matching '%s'\n", RequestID(ctx), len(results), query)
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+		"blocks": []map[string]interface{}{
+			{
+				"type": "section",
+				"text": map[string]interface{}{
+					"type": "mrkdwn",
+					"text": text,
+				},
+			},
+			{
+				"type":     "actions",
+				"block_id": "ticker_search",
+				"elements": buttons,
+			},
+		},
+	}
+}
+
+// TickerSearchAction answers a click on one of the candidate symbols offered
+// by BuildSearchPayload by looking up that symbol.
+func TickerSearchAction(ctx context.Context, p InteractionPayload, action BlockAction) error {
+	if !ValidSymbol(action.Value) {
+		return fmt.Errorf("Invalid ticker symbol '%s'", action.Value)
+	}
+	opts := TickerOpts{
+		Symbol:   action.Value,
+		Period:   "1d",
+		Interval: 60,
+		TeamID:   p.Team.ID,
+		UserID:   p.User.ID,
+	}
+	go TickerPoster(opts, p.ResponseURL, ctx)
+	return nil
+}
+
+// tickerOptionsMetadata is what we stash in the /ticker options modal, so we
+// know where to send the quote once it's submitted, and whether only whoever
+// opened it (with /ticker -private) should see it.
+type tickerOptionsMetadata struct {
+	ResponseURL string `json:"response_url"`
+	Private     bool   `json:"private,omitempty"`
+}
+
+// TickerOptionsView builds the modal that /ticker opens when it's given no
+// arguments, with an input for each of the options ParseTickerCommand
+// understands, labelled in the given locale.
+func TickerOptionsView(responseURL string, private bool, l *Locale) map[string]interface{} {
+	metadata, _ := json.Marshal(tickerOptionsMetadata{responseURL, private})
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"type": "plain_text", "text": l.T(s)}
+	}
+	input := func(blockID, label, hint string, element map[string]interface{}) map[string]interface{} {
+		element["action_id"] = "value"
+		block := map[string]interface{}{
+			"type":     "input",
+			"block_id": blockID,
+			"label":    text(label),
+			"element":  element,
 		}
-		log.Printf("[%d] Got %d from %s: %s\n", RequestID(ctx),
-			resp.StatusCode, responseURL, string(body))
+		if hint != "" {
+			block["hint"] = text(hint)
+		}
+		return block
+	}
+	option := func(value, label string) map[string]interface{} {
+		return map[string]interface{}{"text": text(label), "value": value}
+	}
+
+	logScale := input("log", "Scale", "", map[string]interface{}{
+		"type":    "checkboxes",
+		"options": []map[string]interface{}{option("on", "Logarithmic")},
+	})
+	logScale["optional"] = true
+	return map[string]interface{}{
+		"type":             "modal",
+		"callback_id":      "ticker_options",
+		"private_metadata": string(metadata),
+		"title":            text("Look up a quote"),
+		"submit":           text("Look up"),
+		"close":            text("Cancel"),
+		"blocks": []map[string]interface{}{
+			input("symbol", "Symbol", "Like AAPL, BRK-B, VOD.L, ^GSPC, CL=F, BTC-USD or EURUSD=X",
+				map[string]interface{}{"type": "plain_text_input"}),
+			input("period", "Chart period", "A number of days or years, like 5d or 1Y",
+				map[string]interface{}{"type": "plain_text_input", "initial_value": "1d"}),
+			input("interval", "Chart interval", "In seconds",
+				map[string]interface{}{"type": "plain_text_input", "initial_value": "60"}),
+			input("type", "Chart type", "", map[string]interface{}{
+				"type":           "static_select",
+				"initial_option": option("line", "Line"),
+				"options": []map[string]interface{}{
+					option("line", "Line"), option("bar", "Bar"), option("candle", "Candle"),
+				},
+			}),
+			logScale,
+		},
+	}
+}
+
+// TickerOptionsSubmission looks up the quote described by the /ticker
+// options modal, or points out what's wrong with the options.
+func TickerOptionsSubmission(ctx context.Context, p InteractionPayload) (map[string]interface{}, error) {
+	state := p.View.State
+	opts := TickerOpts{
+		Period: strings.TrimSpace(state.Value("period", "value")),
+		Type:   state.Value("type", "value"),
+		Log:    state.Value("log", "value") == "on",
+		TeamID: p.Team.ID,
+		UserID: p.User.ID,
+	}
+	errs := ValidateTickerOpts(&opts, strings.Fields(state.Value("symbol", "value")))
+	if interval, err := strconv.Atoi(strings.TrimSpace(state.Value("interval", "value"))); err != nil {
+		errs["interval"] = "interval must be a number of seconds"
+	} else {
+		opts.Interval = interval
+		if interval < 0 {
+			errs["interval"] = "interval must be zero or more seconds"
+		}
+	}
+	if len(errs) > 0 {
+		l := LocaleFor(p.Team.ID, p.User.ID)
+		for field, msg := range errs {
+			errs[field] = l.T(msg)
+		}
+		return ViewErrors(errs), nil
+	}
+
+	var metadata tickerOptionsMetadata
+	json.Unmarshal([]byte(p.View.PrivateMetadata), &metadata)
+	if metadata.ResponseURL == "" {
+		return nil, errors.New("No response URL in ticker options")
+	}
+	opts.Private = metadata.Private
+	go TickerPoster(opts, metadata.ResponseURL, ctx)
+	return nil, nil
+}
+
+// ExchangeTime converts a Unix timestamp into the timezone of the exchange
+// a quote came from, falling back to the fixed offset Yahoo reports if the
+// zone database doesn't know the exchange's timezone.
+func ExchangeTime(quote APIResult, ts int64) time.Time {
+	t := time.Unix(ts, 0)
+	if quote.ExchangeTimezoneName != "" {
+		if loc, err := time.LoadLocation(quote.ExchangeTimezoneName); err == nil {
+			return t.In(loc)
+		}
+	}
+	if quote.ExchangeTimezoneShortName != "" || quote.GmtOffSetMilliseconds != 0 {
+		return t.In(time.FixedZone(quote.ExchangeTimezoneShortName,
+			int(quote.GmtOffSetMilliseconds/1000)))
+	}
+	return t
+}
+
+// FormatAsOf describes when a quote was last updated, in two forms: plain
+// text in the requesting user's timezone (or the exchange's, if we don't know
+// theirs), and a Slack date token that every viewer sees in their own local
+// time, alongside the exchange's local time. Both are written the locale's
+// way.
+func FormatAsOf(quote APIResult, user *time.Location, l *Locale) (string, string) {
+	exchange := ExchangeTime(quote, quote.RegularMarketTime)
+	local := exchange
+	if user != nil {
+		local = exchange.In(user)
+	}
+	plain := local.Format(l.DateTimeFormat)
+	token := fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s> %s",
+		quote.RegularMarketTime, plain, l.Tf("(%s exchange time)", exchange.Format(l.TimeFormat)))
+	return plain, token
+}
+
+// ExtendedHoursQuote describes pre-market or after-hours trading for a
+// quote, if the market isn't in its regular session and there has been any.
+func ExtendedHoursQuote(quote APIResult, l *Locale) (string, bool) {
+	var label string
+	var price, change, percent float64
+	var ts int64
+
+	pre := quote.PreMarketPrice != 0 && quote.PreMarketTime != 0
+	post := quote.PostMarketPrice != 0 && quote.PostMarketTime != 0
+	switch quote.MarketState {
+	case "PRE":
+		post = false
+	case "POST", "POSTPOST":
+		pre = false
+	case "PREPRE", "CLOSED":
+		// Between sessions, show whichever happened most recently.
+		if pre && post {
+			if quote.PreMarketTime > quote.PostMarketTime {
+				post = false
+			} else {
+				pre = false
+			}
+		}
+	default:
+		return "", false
+	}
+	if pre && quote.PreMarketTime > quote.RegularMarketTime {
+		label = l.T("Pre-market")
+		price = quote.PreMarketPrice
+		change = quote.PreMarketChange
+		percent = quote.PreMarketChangePercent
+		ts = quote.PreMarketTime
+	} else if post && quote.PostMarketTime >= quote.RegularMarketTime {
+		label = l.T("After hours")
+		price = quote.PostMarketPrice
+		change = quote.PostMarketChange
+		percent = quote.PostMarketChangePercent
+		ts = quote.PostMarketTime
+	} else {
+		return "", false
+	}
+
+	var upDown string
+	if change < 0 {
+		upDown = l.Tf("down %s", l.Percent(percent*(-1)))
+	} else if change > 0 {
+		upDown = l.Tf("up %s", l.Percent(percent))
+	} else {
+		upDown = l.T("unchanged")
+	}
+	// Extended-hours trading is always shown in the exchange's timezone.
+	return l.Tf("%s: *%s* _(%s)_ as of %s", label,
+		l.Money(price, quote.Currency), upDown,
+		ExchangeTime(quote, ts).Format(l.ShortTimeFormat)), true
+}
+
+// QuoteFields returns the extra attachment fields worth showing for a quote,
+// which depend on what kind of quote it is.
+func QuoteFields(quote APIResult, l *Locale) []map[string]interface{} {
+	var fields []map[string]interface{}
+	field := func(title, value string) {
+		fields = append(fields, map[string]interface{}{
+			"title": l.T(title),
+			"value": value,
+			"short": true,
+		})
+	}
+	switch quote.QuoteType {
+	case "EQUITY", "ETF":
+		if quote.MarketCap != 0 {
+			field("Market Cap", l.HumanizeMoney(float64(quote.MarketCap), quote.Currency))
+		}
+	case "INDEX":
+		// Indices have no market capitalization, just a day range.
+		if quote.RegularMarketDayLow != 0 || quote.RegularMarketDayHigh != 0 {
+			field("Day Range", fmt.Sprintf("%s - %s",
+				l.Number(quote.RegularMarketDayLow, 2), l.Number(quote.RegularMarketDayHigh, 2)))
+		}
+	case "FUTURE":
+		if quote.ExpireDate != 0 {
+			field("Contract", time.Unix(quote.ExpireDate, 0).UTC().Format(l.MonthFormat))
+		}
+		if quote.UnderlyingSymbol != "" {
+			field("Underlying", quote.UnderlyingSymbol)
+		}
+		if quote.OpenInterest != 0 {
+			field("Open Interest", l.Humanize(float64(quote.OpenInterest)))
+		}
+	case "MUTUALFUND":
+		if quote.NetAssets != 0 {
+			field("Net Assets", l.HumanizeMoney(quote.NetAssets, quote.Currency))
+		}
+		if quote.YtdReturn != 0 {
+			field("YTD Return", l.Percent(quote.YtdReturn))
+		}
+	case "CRYPTOCURRENCY":
+		field("24h Change", l.Money(quote.RegularMarketChange, quote.Currency))
+		if quote.Volume24Hr != 0 {
+			field("24h Volume", l.HumanizeMoney(float64(quote.Volume24Hr), quote.Currency))
+		}
+		if quote.MarketCap != 0 {
+			field("Market Cap", l.HumanizeMoney(float64(quote.MarketCap), quote.Currency))
+		}
+		if quote.CirculatingSupply != 0 {
+			field("Circulating Supply", fmt.Sprintf("%s %s",
+				l.Humanize(float64(quote.CirculatingSupply)), quote.FromCurrency))
+		}
+	}
+	return fields
+}
+
+// ConvertForUser renders a price in the requesting user's preferred display
+// currency, or returns an empty string if they have none, it's the currency
+// the price is already in, or the conversion fails.
+func ConvertForUser(price float64, currency string, opts TickerOpts, ctx context.Context) string {
+	prefer := Prefs.Get(opts.TeamID, opts.UserID).Currency
+	if currency == "" {
+		currency = "USD"
+	}
+	price, currency = NormalizeCurrency(price, currency)
+	if prefer == "" || prefer == currency {
+		return ""
+	}
+	rate, err := YahooFromContext(ctx).GetFXRate(currency, prefer)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		return ""
+	}
+	return LocaleFor(opts.TeamID, opts.UserID).Money(price*rate, prefer)
+}
+
+// TickerPoster (as a goroutine) collects and formats the requested ticker
+// information, and posts it to a Slack response URL.
+func TickerPoster(opts TickerOpts, responseURL string, ctx context.Context) {
+	payload := BuildTickerPayload(opts, ctx)
+	if opts.Private {
+		payload["response_type"] = visibilityEphemeral
 	}
+	PostResponse(responseURL, payload, ctx)
 }
@@ -5,7 +5,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseTickerCommand(t *testing.T) {
@@ -69,6 +77,66 @@ func TestParseTickerCommand(t *testing.T) {
 			input: "-interval X X",
 			valid: false,
 		},
+		{
+			input: "-search apple inc",
+			valid: true,
+		},
+		{
+			input: "-search",
+			valid: false,
+		},
+		{
+			input: "-detail X",
+			valid: true,
+		},
+		{
+			input: "-on 2017-01-03 X",
+			valid: true,
+		},
+		{
+			input: "-range 2017-01-03:2017-02-03 X",
+			valid: true,
+		},
+		{
+			input: "-on yesterday X",
+			valid: false,
+		},
+		{
+			input: "  -period  5d   X ",
+			valid: true,
+		},
+		{
+			input: "-search \"apple inc\"",
+			valid: true,
+		},
+		{
+			input: "-search \"apple",
+			valid: false,
+		},
+		{
+			input: "-type candle -log X",
+			valid: true,
+		},
+		{
+			input: "-type pie X",
+			valid: false,
+		},
+		{
+			input: "-period= X",
+			valid: false,
+		},
+		{
+			input: "brk-b",
+			valid: true,
+		},
+		{
+			input: "BTC-USD",
+			valid: true,
+		},
+		{
+			input: "EURUSD=X",
+			valid: true,
+		},
 	}
 
 	for i, test := range tests {
@@ -80,3 +148,277 @@ func TestParseTickerCommand(t *testing.T) {
 		}
 	}
 }
+
+func TestTickerOptionsSubmission(t *testing.T) {
+	SetConfig(Configuration{})
+	Installations = NewInstallationStore("")
+
+	submit := func(values map[string]string) map[string]interface{} {
+		state := map[string]interface{}{}
+		for block, value := range values {
+			state[block] = map[string]interface{}{
+				"value": map[string]interface{}{"type": "plain_text_input", "value": value},
+			}
+		}
+		view := TickerOptionsView("", false, English)
+		view["state"] = map[string]interface{}{"values": state}
+		p, _ := json.Marshal(map[string]interface{}{
+			"type": "view_submission",
+			"team": map[string]interface{}{"id": "T1"},
+			"user": map[string]interface{}{"id": "U1"},
+			"view": view,
+		})
+		form := url.Values{"payload": {string(p)}}
+		req := httptest.NewRequest("POST", "/interactive", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		InteractionDispatcher(w, req.WithContext(NewContext(req.Context(), req)))
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	r := submit(map[string]string{"symbol": "X Y", "period": "0d", "interval": "soon", "type": "pie"})
+	errs, _ := r["errors"].(map[string]interface{})
+	for _, field := range []string{"symbol", "period", "interval", "type"} {
+		if errs[field] == nil {
+			t.Errorf("expected a %s error, got %v", field, r)
+		}
+	}
+	r = submit(map[string]string{"symbol": "AAPL", "period": "5d", "interval": "60", "type": "bar"})
+	if errs, ok := r["errors"].(map[string]interface{}); ok && len(errs) > 0 {
+		t.Errorf("expected no field errors, got %v", errs)
+	}
+}
+
+func TestTickerOpensOptionsModal(t *testing.T) {
+	var opened map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/views.open" {
+			json.NewDecoder(r.Body).Decode(&opened)
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+	SetConfig(Configuration{})
+
+	for _, text := range []string{"", " -private "} {
+		form := url.Values{"text": {text}, "trigger_id": {"trig"}, "response_url": {"https://example.com/r"}}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx := WithInstallation(req.Context(), Installation{TeamID: "T1", BotToken: "xoxb-1"})
+		ctx = WithSlack(ctx, NewSlack(ts.URL))
+		if err := Ticker(httptest.NewRecorder(), req.WithContext(ctx)); err != nil {
+			t.Fatal("Ticker failed:", err)
+		}
+		view, _ := opened["view"].(map[string]interface{})
+		if opened["trigger_id"] != "trig" || view["callback_id"] != "ticker_options" {
+			t.Errorf("%q: expected the ticker options modal, got %v", text, opened)
+		}
+		var metadata tickerOptionsMetadata
+		json.Unmarshal([]byte(view["private_metadata"].(string)), &metadata)
+		if metadata.Private != (text != "") {
+			t.Errorf("%q: unexpected modal metadata %+v", text, metadata)
+		}
+	}
+}
+
+func TestValidSymbol(t *testing.T) {
+	tests := []struct {
+		symbol    string
+		quoteType string
+	}{
+		{"AAPL", "EQUITY"},
+		{"BRK-B", "EQUITY"},
+		{"VOD.L", "EQUITY"},
+		{"7203.T", "EQUITY"},
+		{"BTC-USD", "CRYPTOCURRENCY"},
+		{"DOGE-USDT", "CRYPTOCURRENCY"},
+		{"EURUSD=X", "CURRENCY"},
+		{"JPY=X", "CURRENCY"},
+		{"^GSPC", "INDEX"},
+		{"ES=F", "FUTURE"},
+		{"VFIAX", "EQUITY"},
+		{"^", ""},
+		{"INVALID-TICKER", ""},
+		{"A B", ""},
+		{"-X", ""},
+	}
+	for i, test := range tests {
+		if qt := SymbolQuoteType(test.symbol); qt != test.quoteType {
+			t.Errorf("%d. expected %s to be %q, got %q", i, test.symbol,
+				test.quoteType, qt)
+		}
+	}
+}
+
+func TestResolveSymbol(t *testing.T) {
+	SetConfig(Configuration{Aliases: map[string]string{"crude": "cl=f", "spx": "^SPX"}})
+	tests := []struct {
+		input  string
+		symbol string
+	}{
+		{"aapl", "AAPL"},
+		{"dow", "^DJI"},
+		{"Crude", "CL=F"},
+		{"spx", "^SPX"},
+	}
+	for i, test := range tests {
+		if symbol := ResolveSymbol(test.input); symbol != test.symbol {
+			t.Errorf("%d. expected %s, got %s", i, test.symbol, symbol)
+		}
+	}
+	if opts, err := ParseTickerCommand("-period=5d dow"); err != nil || opts.Symbol != "^DJI" {
+		t.Errorf("expected ^DJI, got %s (%v)", opts.Symbol, err)
+	}
+}
+
+func TestQuoteFieldsByType(t *testing.T) {
+	tests := []struct {
+		quote  APIResult
+		titles []string
+	}{
+		{APIResult{QuoteType: "EQUITY", MarketCap: 1e9}, []string{"Market Cap"}},
+		{APIResult{QuoteType: "INDEX", MarketCap: 1e9, RegularMarketDayLow: 1,
+			RegularMarketDayHigh: 2}, []string{"Day Range"}},
+		{APIResult{QuoteType: "FUTURE", ExpireDate: 1734652800,
+			UnderlyingSymbol: "ES=F"}, []string{"Contract", "Underlying"}},
+		{APIResult{QuoteType: "MUTUALFUND", NetAssets: 1e12, YtdReturn: 5},
+			[]string{"Net Assets", "YTD Return"}},
+	}
+	for i, test := range tests {
+		fields := QuoteFields(test.quote, English)
+		if len(fields) != len(test.titles) {
+			t.Errorf("%d. expected %d fields, got %v", i, len(test.titles), fields)
+			continue
+		}
+		for j, title := range test.titles {
+			if fields[j]["title"] != title {
+				t.Errorf("%d. expected %s, got %s", i, title, fields[j]["title"])
+			}
+		}
+	}
+	if fields := QuoteFields(APIResult{QuoteType: "FUTURE", ExpireDate: 1734652800}, English); fields[0]["value"] != "Dec 2024" {
+		t.Errorf("expected Dec 2024 contract, got %s", fields[0]["value"])
+	}
+
+	fields := QuoteFields(APIResult{QuoteType: "INDEX", RegularMarketDayLow: 15000.5,
+		RegularMarketDayHigh: 15234.25}, German)
+	if fields[0]["title"] != "Tagesspanne" || fields[0]["value"] != "15.000,50 - 15.234,25" {
+		t.Errorf("unexpected German day range %v", fields[0])
+	}
+	fields = QuoteFields(APIResult{QuoteType: "MUTUALFUND", NetAssets: 2.5e9, YtdReturn: 5}, German)
+	if fields[0]["value"] != "2,5 Mrd. $" || fields[1]["title"] != "Rendite seit Jahresbeginn" ||
+		fields[1]["value"] != "5,00 %" {
+		t.Errorf("unexpected German fund fields %v", fields)
+	}
+	if fields := QuoteFields(APIResult{QuoteType: "FUTURE", ExpireDate: 1734652800}, German); fields[0]["value"] != "12.2024" {
+		t.Errorf("expected a 12.2024 contract, got %s", fields[0]["value"])
+	}
+}
+
+func TestBuildTickerPayloadSuggestions(t *testing.T) {
+	quoteHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{\"quoteResponse\":{\"result\":[]}}")
+	}
+	searchHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("q") != "APPLE" {
+			fmt.Fprint(w, "{\"quotes\":[]}")
+			return
+		}
+		fmt.Fprint(w, "{\"quotes\":[{\"symbol\":\"AAPL\",\"shortname\":\"Apple Inc.\"}]}")
+	}
+	qs := httptest.NewServer(http.HandlerFunc(quoteHandler))
+	defer qs.Close()
+	ss := httptest.NewServer(http.HandlerFunc(searchHandler))
+	defer ss.Close()
+	Prefs = NewPrefsStore("")
+	ctx := WithYahoo(context.WithValue(context.Background(), requestIDKey, uint64(0)),
+		&Yahoo{QuoteURL: qs.URL, SearchURL: ss.URL})
+
+	payload := BuildTickerPayload(TickerOpts{Symbol: "APPLE"}, ctx)
+	if payload["response_type"] != "ephemeral" || payload["blocks"] == nil {
+		t.Fatalf("expected ephemeral suggestions, got %v", payload)
+	}
+	blocks := payload["blocks"].([]map[string]interface{})
+	buttons := blocks[1]["elements"].([]map[string]interface{})
+	if len(buttons) != 1 || buttons[0]["value"] != "AAPL" {
+		t.Errorf("expected a button for AAPL, got %v", buttons)
+	}
+
+	payload = BuildTickerPayload(TickerOpts{Symbol: "XYZZY"}, ctx)
+	if _, ok := payload["response_type"]; ok || payload["text"] != "Unknown ticker symbol _XYZZY_" {
+		t.Errorf("expected unknown symbol error, got %v", payload)
+	}
+}
+
+func TestExtendedHoursQuote(t *testing.T) {
+	base := APIResult{
+		Currency:                  "USD",
+		ExchangeTimezoneName:      "America/New_York",
+		ExchangeTimezoneShortName: "EST",
+		GmtOffSetMilliseconds:     -18000000,
+		RegularMarketTime:         1511384466, // Nov 22 4:01PM EST
+		PreMarketPrice:            22.45,
+		PreMarketChange:           0.18,
+		PreMarketChangePercent:    0.81,
+		PreMarketTime:             1511440200, // Nov 23 7:30AM EST
+		PostMarketPrice:           22.26,
+		PostMarketChange:          -0.01,
+		PostMarketChangePercent:   -0.04,
+		PostMarketTime:            1511398614, // Nov 22 7:56PM EST
+	}
+	tests := []struct {
+		state  string
+		output string
+	}{
+		{"REGULAR", ""},
+		{"PRE", "Pre-market: *$22.45* _(up 0.81%)_ as of Nov 23 7:30AM EST"},
+		{"POST", "After hours: *$22.26* _(down 0.04%)_ as of Nov 22 7:56PM EST"},
+		{"CLOSED", "Pre-market: *$22.45* _(up 0.81%)_ as of Nov 23 7:30AM EST"},
+	}
+	for i, test := range tests {
+		quote := base
+		quote.MarketState = test.state
+		ext, ok := ExtendedHoursQuote(quote, English)
+		if ok != (test.output != "") || ext != test.output {
+			t.Errorf("%d. expected %q, got %q", i, test.output, ext)
+		}
+	}
+
+	quote := base
+	quote.MarketState = "CLOSED"
+	quote.PreMarketPrice = 0
+	if ext, _ := ExtendedHoursQuote(quote, English); ext != tests[2].output {
+		t.Errorf("expected %q, got %q", tests[2].output, ext)
+	}
+
+	// Without a zone database, we still get the exchange's own offset.
+	quote.ExchangeTimezoneName = "Nowhere/Special"
+	if ext, _ := ExtendedHoursQuote(quote, English); ext != tests[2].output {
+		t.Errorf("expected %q, got %q", tests[2].output, ext)
+	}
+}
+
+func TestFormatAsOf(t *testing.T) {
+	quote := APIResult{
+		ExchangeTimezoneName:      "America/New_York",
+		ExchangeTimezoneShortName: "EST",
+		GmtOffSetMilliseconds:     -18000000,
+		RegularMarketTime:         1511384466,
+	}
+	plain, token := FormatAsOf(quote, nil, English)
+	if plain != "22 Nov 17 16:01 EST" {
+		t.Errorf("expected exchange time, got %s", plain)
+	}
+	expected := "<!date^1511384466^{date_short_pretty} {time}|22 Nov 17 16:01 EST> (4:01PM EST exchange time)"
+	if token != expected {
+		t.Errorf("expected %s, got %s", expected, token)
+	}
+	plain, _ = FormatAsOf(quote, time.FixedZone("JST", 9*60*60), English)
+	if plain != "23 Nov 17 06:01 JST" {
+		t.Errorf("expected user's time, got %s", plain)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultUnfurlPatterns are the finance sites whose links we unfurl, and
+// how to find the symbol in the path (and query) of each; the first
+// submatch is the symbol. Patterns from the configuration file are
+// consulted first.
+var defaultUnfurlPatterns = map[string]string{
+	"finance.yahoo.com":    `^/quote/([^/?]+)`,
+	"www.google.com":       `^/finance/quote/([^/?:]+)`,
+	"www.marketwatch.com":  `^/investing/(?:stock|fund|index|future)/([^/?]+)`,
+	"www.bloomberg.com":    `^/quote/([^/?:]+)`,
+	"www.nasdaq.com":       `^/market-activity/(?:stocks|etf)/([^/?]+)`,
+	"stocktwits.com":       `^/symbol/([^/?]+)`,
+	"www.cnbc.com":         `^/quotes/([^/?]+)`,
+	"seekingalpha.com":     `^/symbol/([^/?]+)`,
+	"www.investopedia.com": `^/markets/quote\?tvwidgetsymbol=([^&]+)`,
+}
+
+// CompileUnfurlPatterns checks that every pattern has a submatch for the
+// symbol, and compiles them.
+func CompileUnfurlPatterns(patterns map[string]string) (map[string]*regexp.Regexp, error) {
+	compiled := map[string]*regexp.Regexp{}
+	for domain, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Unfurl pattern for %s: %s", domain, err)
+		}
+		if re.NumSubexp() < 1 {
+			return nil, fmt.Errorf("Unfurl pattern for %s has no submatch for the symbol", domain)
+		}
+		compiled[strings.ToLower(domain)] = re
+	}
+	return compiled, nil
+}
+
+// unfurlPattern returns the pattern for links to a domain, if we unfurl
+// them at all.
+func unfurlPattern(domain string) (*regexp.Regexp, bool) {
+	domain = strings.ToLower(domain)
+	if re, ok := Config().unfurlPatterns[domain]; ok {
+		return re, true
+	}
+	pattern, ok := defaultUnfurlPatterns[domain]
+	if !ok {
+		return nil, false
+	}
+	return regexp.MustCompile(pattern), true
+}
+
+// UnfurlSymbol finds the ticker symbol a link refers to, if it's to a
+// finance site we know about.
+func UnfurlSymbol(link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	re, ok := unfurlPattern(u.Hostname())
+	if !ok {
+		return "", false
+	}
+	match := re.FindStringSubmatch(u.RequestURI())
+	if match == nil {
+		return "", false
+	}
+	symbol, err := url.QueryUnescape(match[1])
+	if err != nil {
+		return "", false
+	}
+	symbol = strings.ToUpper(symbol)
+	if !ValidSymbol(symbol) {
+		return "", false
+	}
+	return symbol, true
+}
+
+// UnfurlCard turns the quote for a symbol into a compact attachment, without
+// the chart and the extra fields.
+func UnfurlCard(symbol string, ctx context.Context) (map[string]interface{}, bool) {
+	payload := BuildTickerPayload(TickerOpts{Symbol: symbol, Period: "1d", Interval: 60}, ctx)
+	attachments, ok := payload["attachments"].([]map[string]interface{})
+	if !ok || len(attachments) == 0 {
+		return nil, false
+	}
+	card := map[string]interface{}{}
+	for key, value := range attachments[0] {
+		switch key {
+		case "image_url", "fields":
+			continue
+		}
+		card[key] = value
+	}
+	return card, true
+}
+
+// LinkShared unfurls links to finance sites into quote cards.
+func LinkShared(ctx context.Context, env EventEnvelope) error {
+	var event struct {
+		Channel   string `json:"channel"`
+		MessageTS string `json:"message_ts"`
+		Links     []struct {
+			Domain string `json:"domain"`
+			URL    string `json:"url"`
+		} `json:"links"`
+	}
+	if err := json.Unmarshal(env.Event, &event); err != nil {
+		return err
+	}
+	inst, ok := InstallationFromContext(ctx)
+	if !ok {
+		return fmt.Errorf("No installation for %s", env.TeamID)
+	}
+
+	unfurls := map[string]interface{}{}
+	for _, link := range event.Links {
+		symbol, ok := UnfurlSymbol(link.URL)
+		if !ok {
+			continue
+		}
+		if card, ok := UnfurlCard(symbol, ctx); ok {
+			unfurls[link.URL] = card
+		}
+	}
+	if len(unfurls) == 0 {
+		return nil
+	}
+	log.Printf("[%d] Unfurling %d links in %s", RequestID(ctx), len(unfurls), event.Channel)
+	return SlackFromContext(ctx).Call("chat.unfurl", inst.BotToken, map[string]interface{}{
+		"channel": event.Channel,
+		"ts":      event.MessageTS,
+		"unfurls": unfurls,
+	}, nil)
+}
@@ -0,0 +1,95 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnfurlSymbol(t *testing.T) {
+	loadTestConfig(t, "[UnfurlPatterns]\n\"Stocks.Example.com\" = '^/s/([a-z]+)'\n")
+	tests := []struct {
+		link   string
+		symbol string
+	}{
+		{"https://finance.yahoo.com/quote/AAPL?p=AAPL", "AAPL"},
+		{"https://finance.yahoo.com/quote/%5EGSPC/", "^GSPC"},
+		{"https://finance.yahoo.com/quote/BRK-B/history", "BRK-B"},
+		{"https://www.google.com/finance/quote/MSFT:NASDAQ", "MSFT"},
+		{"https://www.marketwatch.com/investing/stock/tsla", "TSLA"},
+		{"https://stocks.example.com/s/ibm", "IBM"},
+		{"https://finance.yahoo.com/news/", ""},
+		{"https://www.example.org/quote/AAPL", ""},
+		{"https://finance.yahoo.com/quote/not a symbol", ""},
+	}
+	for _, test := range tests {
+		symbol, ok := UnfurlSymbol(test.link)
+		if symbol != test.symbol || ok != (test.symbol != "") {
+			t.Errorf("%s: expected %q, got %q", test.link, test.symbol, symbol)
+		}
+	}
+}
+
+func TestCompileUnfurlPatterns(t *testing.T) {
+	if _, err := CompileUnfurlPatterns(defaultUnfurlPatterns); err != nil {
+		t.Error("default unfurl patterns are invalid:", err)
+	}
+	for _, pattern := range []string{"^/quote/", "^/quote/(["} {
+		if _, err := CompileUnfurlPatterns(map[string]string{"x.com": pattern}); err == nil {
+			t.Errorf("expected %s to be rejected", pattern)
+		}
+	}
+}
+
+func TestLinkShared(t *testing.T) {
+	qs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("symbols") != "AAPL" {
+			fmt.Fprint(w, `{"quoteResponse":{"result":[]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"quoteResponse":{"result":[{"symbol":"AAPL","currency":"USD",`+
+			`"shortName":"Apple Inc.","regularMarketPrice":150,"marketCap":2500000000000}]}}`)
+	}))
+	defer qs.Close()
+	var unfurl struct {
+		Channel string                            `json:"channel"`
+		TS      string                            `json:"ts"`
+		Unfurls map[string]map[string]interface{} `json:"unfurls"`
+	}
+	ss := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chat.unfurl" {
+			json.NewDecoder(r.Body).Decode(&unfurl)
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ss.Close()
+	SetConfig(Configuration{})
+	Prefs = NewPrefsStore("")
+	inst := Installation{TeamID: "T1", BotToken: "xoxb-1"}
+	ctx := WithInstallation(context.WithValue(context.Background(), requestIDKey, uint64(0)), inst)
+	ctx = WithYahoo(ctx, NewYahoo(qs.URL))
+	ctx = WithSlack(ctx, NewSlack(ss.URL))
+
+	env := EventEnvelope{TeamID: "T1", Event: json.RawMessage(`{"type":"link_shared",
+		"channel":"C1","message_ts":"123.456","links":[
+		{"domain":"finance.yahoo.com","url":"https://finance.yahoo.com/quote/AAPL"},
+		{"domain":"example.com","url":"https://example.com/quote/AAPL"}]}`)}
+	if err := LinkShared(ctx, env); err != nil {
+		t.Fatal("LinkShared failed:", err)
+	}
+	if unfurl.Channel != "C1" || unfurl.TS != "123.456" || len(unfurl.Unfurls) != 1 {
+		t.Fatalf("unexpected unfurl: %+v", unfurl)
+	}
+	card := unfurl.Unfurls["https://finance.yahoo.com/quote/AAPL"]
+	if card == nil || card["image_url"] != nil || card["fields"] != nil {
+		t.Errorf("expected a compact card, got %v", card)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"time"
+)
+
+// userTimezones remembers what timezone people are in, so we don't have to
+// ask Slack on every lookup.
+var userTimezones = NewCache(24 * time.Hour)
+
+// userTimezoneRetry is how long we wait before asking Slack again about
+// someone whose timezone we couldn't find out.
+const userTimezoneRetry = 10 * time.Minute
+
+// UserInfoResponse is the subset of the users.info response that we use.
+type UserInfoResponse struct {
+	SlackResponse
+	User struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		TZ       string `json:"tz"`
+		TZLabel  string `json:"tz_label"`
+		TZOffset int    `json:"tz_offset"`
+	} `json:"user"`
+}
+
+// UserLocation returns the timezone a Slack user has configured, or nil if
+// we can't find out (because the workspace didn't install us via OAuth, or
+// didn't grant us the users:read scope, for example).
+func UserLocation(ctx context.Context, teamID, userID string) *time.Location {
+	if userID == "" {
+		return nil
+	}
+	key := prefsKey(teamID, userID)
+	if loc, ok := userTimezones.Get(key); ok {
+		return loc.(*time.Location)
+	}
+	inst, ok := Installations.Get(teamID)
+	if !ok {
+		return nil
+	}
+
+	var info UserInfoResponse
+	err := SlackFromContext(ctx).CallForm("users.info", inst.BotToken,
+		url.Values{"user": {userID}}, &info)
+	if err != nil {
+		log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+		userTimezones.SetFor(key, (*time.Location)(nil), userTimezoneRetry)
+		return nil
+	}
+	var loc *time.Location
+	if info.User.TZ != "" {
+		loc, err = time.LoadLocation(info.User.TZ)
+	}
+	if loc == nil || err != nil {
+		loc = time.FixedZone(info.User.TZLabel, info.User.TZOffset)
+	}
+	userTimezones.Set(key, loc)
+	return loc
+}
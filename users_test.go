@@ -0,0 +1,66 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUserLocation(t *testing.T) {
+	calls := 0
+	slackHandler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer xoxb-1" {
+			fmt.Fprint(w, `{"ok":false,"error":"invalid_auth"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.FormValue("user") {
+		case "U1":
+			fmt.Fprint(w, `{"ok":true,"user":{"id":"U1","tz":"Europe/Berlin"}}`)
+		default:
+			fmt.Fprint(w, `{"ok":true,"user":{"id":"U2","tz":"Nowhere/Special","tz_label":"NST","tz_offset":-12600}}`)
+		}
+	}
+	ts := httptest.NewServer(http.HandlerFunc(slackHandler))
+	defer ts.Close()
+	SetConfig(Configuration{})
+	Installations = NewInstallationStore("")
+	Installations.Save(Installation{TeamID: "T1", BotToken: "xoxb-1"})
+	Installations.Save(Installation{TeamID: "T2", BotToken: "xoxb-revoked"})
+	userTimezones = NewCache(time.Hour)
+	ctx := context.WithValue(context.Background(), requestIDKey, uint64(0))
+	ctx = WithSlack(ctx, NewSlack(ts.URL))
+
+	if loc := UserLocation(ctx, "T3", "U1"); loc != nil {
+		t.Errorf("expected no timezone for an uninstalled team, got %v", loc)
+	}
+	if loc := UserLocation(ctx, "T1", "U1"); loc == nil || loc.String() != "Europe/Berlin" {
+		t.Errorf("expected Europe/Berlin, got %v", loc)
+	}
+	UserLocation(ctx, "T1", "U1")
+	if calls != 1 {
+		t.Errorf("expected timezone to be cached, got %d calls", calls)
+	}
+	loc := UserLocation(ctx, "T1", "U2")
+	if _, offset := time.Unix(0, 0).In(loc).Zone(); offset != -12600 {
+		t.Errorf("expected fixed -12600 offset, got %d", offset)
+	}
+
+	calls = 0
+	for i := 0; i < 2; i++ {
+		if loc := UserLocation(ctx, "T2", "U1"); loc != nil {
+			t.Errorf("expected no timezone when users.info fails, got %v", loc)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected the failure to be cached, got %d calls", calls)
+	}
+}
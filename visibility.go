@@ -0,0 +1,141 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// The ways a public answer to a command can be shown.
+const (
+	visibilityInChannel = "in_channel"
+	visibilityEphemeral = "ephemeral"
+	visibilityThread    = "thread"
+)
+
+// VisibilityConfig decides how answers that would otherwise be posted to
+// everyone in a channel are actually shown. The most specific policy wins:
+// a channel's over a command's, and a command's over a workspace's.
+type VisibilityConfig struct {
+	Workspaces map[string]string `config:"show"`
+	Commands   map[string]string `config:"show"`
+	Channels   map[string]string `config:"show"`
+	// PublicChannels, if set, are the only channels we may post answers
+	// to publicly; everywhere else they're only shown to whoever asked.
+	PublicChannels []string `config:"show"`
+}
+
+// Validate checks that every policy is one we know how to apply.
+func (v VisibilityConfig) Validate() error {
+	for kind, policies := range map[string]map[string]string{
+		"workspace": v.Workspaces,
+		"command":   v.Commands,
+		"channel":   v.Channels,
+	} {
+		for id, policy := range policies {
+			switch policy {
+			case visibilityInChannel, visibilityEphemeral, visibilityThread:
+				continue
+			}
+			return fmt.Errorf("Visibility of %s %s must be one of in_channel, ephemeral or thread, not '%s'",
+				kind, id, policy)
+		}
+	}
+	return nil
+}
+
+// ResponseVisibility decides how a public answer to a command, in a channel
+// of a workspace, should be shown. Aliases follow the policy of the command
+// they stand for.
+func ResponseVisibility(teamID, channelID, command string) string {
+	v := Config().Visibility
+	visibility := visibilityInChannel
+	if policy, ok := v.Workspaces[teamID]; ok {
+		visibility = policy
+	}
+	if policy, ok := v.Commands[CanonicalCommand(command)]; ok {
+		visibility = policy
+	}
+	if policy, ok := v.Channels[channelID]; ok {
+		visibility = policy
+	}
+	if visibility != visibilityEphemeral && len(v.PublicChannels) > 0 &&
+		!containsSymbol(v.PublicChannels, channelID) {
+		visibility = visibilityEphemeral
+	}
+	return visibility
+}
+
+// responseTarget is what we need to know about a command to decide where
+// its answer goes.
+type responseTarget struct {
+	TeamID    string
+	ChannelID string
+	UserID    string
+	Command   string
+	Text      string
+}
+
+func newResponseTarget(req *http.Request) responseTarget {
+	return responseTarget{
+		TeamID:    req.FormValue("team_id"),
+		ChannelID: req.FormValue("channel_id"),
+		UserID:    req.FormValue("user_id"),
+		Command:   req.FormValue("command"),
+		Text:      req.FormValue("text"),
+	}
+}
+
+// Publish applies the visibility policy to an answer. It returns the
+// payload to send back to Slack, or nil if the answer is being posted in a
+// thread instead.
+func (t responseTarget) Publish(ctx context.Context, payload map[string]interface{}) map[string]interface{} {
+	if payload["response_type"] != visibilityInChannel {
+		return payload
+	}
+	switch ResponseVisibility(t.TeamID, t.ChannelID, t.Command) {
+	case visibilityEphemeral:
+		payload["response_type"] = visibilityEphemeral
+	case visibilityThread:
+		inst, ok := InstallationFromContext(ctx)
+		if !ok {
+			// We can only start threads as the bot.
+			payload["response_type"] = visibilityEphemeral
+			return payload
+		}
+		go func() {
+			if err := t.postInThread(SlackFromContext(ctx), inst.BotToken, payload); err != nil {
+				log.Printf("[%d] Error: %s\n", RequestID(ctx), err)
+			}
+		}()
+		return nil
+	}
+	return payload
+}
+
+// postInThread posts a one-line note of what was asked to the channel, and
+// the answer in a thread underneath it.
+func (t responseTarget) postInThread(slack *Slack, token string, payload map[string]interface{}) error {
+	ts, err := slack.PostMessage(token, map[string]interface{}{
+		"channel": t.ChannelID,
+		"text":    fmt.Sprintf("<@%s> used `%s %s`", t.UserID, t.Command, t.Text),
+	})
+	if err != nil {
+		return err
+	}
+	message := map[string]interface{}{}
+	for key, value := range payload {
+		if key != "response_type" {
+			message[key] = value
+		}
+	}
+	message["channel"] = t.ChannelID
+	message["thread_ts"] = ts
+	_, err = slack.PostMessage(token, message)
+	return err
+}
@@ -0,0 +1,117 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseVisibility(t *testing.T) {
+	loadTestConfig(t, `
+[CommandAliases]
+"/Money" = "/fx"
+[Visibility.Workspaces]
+T2 = "ephemeral"
+[Visibility.Commands]
+"/fx" = "thread"
+[Visibility.Channels]
+C2 = "in_channel"
+`)
+	tests := []struct {
+		team, channel, command string
+		visibility             string
+	}{
+		{"T1", "C1", "/ticker", "in_channel"},
+		{"T2", "C1", "/ticker", "ephemeral"},
+		{"T2", "C1", "/fx", "thread"},
+		{"T2", "C2", "/fx", "in_channel"},
+		{"T2", "C1", "/money", "thread"},
+	}
+	for _, test := range tests {
+		if v := ResponseVisibility(test.team, test.channel, test.command); v != test.visibility {
+			t.Errorf("%v: expected %s, got %s", test, test.visibility, v)
+		}
+	}
+
+	changeTestConfig(func(c *Configuration) { c.Visibility.PublicChannels = []string{"C2"} })
+	if v := ResponseVisibility("T1", "C1", "/ticker"); v != "ephemeral" {
+		t.Errorf("expected C1 to be private, got %s", v)
+	}
+	if v := ResponseVisibility("T1", "C2", "/ticker"); v != "in_channel" {
+		t.Errorf("expected C2 to be public, got %s", v)
+	}
+
+	var c Configuration
+	if err := LoadConfig(&c, strings.NewReader("[Visibility.Channels]\nC1 = \"loud\"\n")); err == nil {
+		t.Error("expected an invalid visibility to be rejected")
+	}
+}
+
+func TestPublishInThread(t *testing.T) {
+	posted := make(chan map[string]interface{}, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		posted <- message
+		fmt.Fprint(w, `{"ok":true,"ts":"111.222"}`)
+	}))
+	defer ts.Close()
+	SetConfig(Configuration{Visibility: VisibilityConfig{Channels: map[string]string{"C1": "thread"}}})
+	ctx := context.WithValue(context.Background(), requestIDKey, uint64(0))
+	ctx = WithSlack(ctx, NewSlack(ts.URL))
+	target := responseTarget{"T1", "C1", "U1", "/ticker", "AAPL"}
+
+	payload := target.Publish(ctx, map[string]interface{}{"response_type": "in_channel", "text": "hi"})
+	if payload["response_type"] != "ephemeral" {
+		t.Errorf("expected a private answer without an installation, got %v", payload)
+	}
+
+	ctx = WithInstallation(ctx, Installation{TeamID: "T1", BotToken: "xoxb-1"})
+	if p := target.Publish(ctx, map[string]interface{}{"response_type": "in_channel", "text": "hi"}); p != nil {
+		t.Errorf("expected the answer to go to a thread, got %v", p)
+	}
+	var messages []map[string]interface{}
+	for len(messages) < 2 {
+		select {
+		case m := <-posted:
+			messages = append(messages, m)
+		case <-time.After(5 * time.Second):
+			t.Fatal("thread was never posted")
+		}
+	}
+	if messages[0]["text"] != "<@U1> used `/ticker AAPL`" ||
+		messages[1]["thread_ts"] != "111.222" || messages[1]["text"] != "hi" ||
+		messages[1]["response_type"] != nil {
+		t.Errorf("unexpected thread %v", messages)
+	}
+
+	if p := target.Publish(ctx, map[string]interface{}{"response_type": "ephemeral"}); p == nil {
+		t.Error("expected private answers to be left alone")
+	}
+}
+
+func TestCommandPrivateFlag(t *testing.T) {
+	SetConfig(Configuration{})
+	form := url.Values{"text": {"list -private x"}}
+	req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if err := CommandHandler(testCommand())(w, req); err != nil {
+		t.Fatal("Handler failed:", err)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &payload)
+	if payload["response_type"] != "ephemeral" || payload["text"] != "/test list x" {
+		t.Errorf("expected a private answer, got %v", payload)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/logic/slacker/slash"
+)
+
+// maxWebhookResponse is the most we'll read from a webhook command's
+// endpoint.
+const maxWebhookResponse = 1 << 20
+
+// WebhookConfig is a command, defined in the configuration file, that is
+// answered by forwarding it to an HTTP endpoint.
+type WebhookConfig struct {
+	URL      string `config:"show"`
+	Help     string `config:"show"`
+	Timeout  int    `config:"show"` // seconds; defaults to HTTPClientTimeout
+	Secret   string // if set, requests are signed with it
+	Response string `config:"show"` // in_channel or ephemeral (the default)
+}
+
+// Validate checks that a webhook command can be served.
+func (c WebhookConfig) Validate(name string) error {
+	if !strings.HasPrefix(name, "/") {
+		return fmt.Errorf("Webhook command '%s' must start with /", name)
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Webhook command %s needs an http or https URL", name)
+	}
+	switch c.Response {
+	case "", visibilityInChannel, visibilityEphemeral:
+		break
+	default:
+		return fmt.Errorf("Webhook command %s response must be in_channel or ephemeral, not '%s'",
+			name, c.Response)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("Webhook command %s timeout must be zero or more seconds", name)
+	}
+	return nil
+}
+
+// WebhookRequest is what we send a webhook command's endpoint: the fields
+// of the slash command, and its text split into arguments.
+type WebhookRequest struct {
+	Command     string   `json:"command"`
+	Text        string   `json:"text"`
+	Args        []string `json:"args"`
+	TeamID      string   `json:"team_id"`
+	TeamDomain  string   `json:"team_domain"`
+	ChannelID   string   `json:"channel_id"`
+	ChannelName string   `json:"channel_name"`
+	UserID      string   `json:"user_id"`
+	UserName    string   `json:"user_name"`
+}
+
+// SignWebhook returns the signature of a webhook request body, in the same
+// form Slack signs its requests to us: "v0=" and the hex HMAC-SHA256 of
+// "v0:<timestamp>:<body>".
+func SignWebhook(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckWebhookResponse makes sure a webhook command's endpoint answered
+// with a message we can pass on to Slack.
+func CheckWebhookResponse(data []byte) (map[string]interface{}, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("response is not a JSON object: %s", err)
+	}
+	for key, value := range payload {
+		switch key {
+		case "text":
+			if _, ok := value.(string); !ok {
+				return nil, errors.New("response text must be a string")
+			}
+		case "blocks", "attachments":
+			if _, ok := value.([]interface{}); !ok {
+				return nil, fmt.Errorf("response %s must be a list", key)
+			}
+		case "mrkdwn":
+			if _, ok := value.(bool); !ok {
+				return nil, errors.New("response mrkdwn must be true or false")
+			}
+		case "response_type":
+			if value != visibilityInChannel && value != visibilityEphemeral {
+				return nil, errors.New("response_type must be in_channel or ephemeral")
+			}
+		default:
+			return nil, fmt.Errorf("response has unexpected field '%s'", key)
+		}
+	}
+	if payload["text"] == nil && payload["blocks"] == nil && payload["attachments"] == nil {
+		return nil, errors.New("response needs text, blocks or attachments")
+	}
+	return payload, nil
+}
+
+// WebhookCommand builds the handler for a webhook command. Its answer goes
+// back through Respond, so slow endpoints are answered via response_url.
+func WebhookCommand(name string, c WebhookConfig) ErrorHandler {
+	response := c.Response
+	if response == "" {
+		response = visibilityEphemeral
+	}
+	timeout := time.Duration(c.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = Config().Timeout(destinationWebhooks)
+	}
+	return func(w http.ResponseWriter, req *http.Request) error {
+		return Respond(w, req, response, func() (map[string]interface{}, error) {
+			return forwardWebhook(name, c, timeout, req)
+		})
+	}
+}
+
+func forwardWebhook(name string, c WebhookConfig, timeout time.Duration, req *http.Request) (map[string]interface{}, error) {
+	text := req.FormValue("text")
+	args, err := slash.Tokenize(text)
+	if err != nil {
+		return map[string]interface{}{
+			"response_type": visibilityEphemeral,
+			"text":          fmt.Sprintf("*Error:* %s", err),
+		}, nil
+	}
+	// -private is ours, like it is for every other command; the endpoint
+	// never sees it.
+	private := len(args) > 0 && args[0] == "-private"
+	if private {
+		args = args[1:]
+		text = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "-private"))
+	}
+	body, err := json.Marshal(WebhookRequest{
+		Command:     name,
+		Text:        text,
+		Args:        args,
+		TeamID:      req.FormValue("team_id"),
+		TeamDomain:  req.FormValue("team_domain"),
+		ChannelID:   req.FormValue("channel_id"),
+		ChannelName: req.FormValue("channel_name"),
+		UserID:      req.FormValue("user_id"),
+		UserName:    req.FormValue("user_name"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hookReq, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hookReq.Header.Set("Content-Type", "application/json")
+	if c.Secret != "" {
+		ts := time.Now().Unix()
+		hookReq.Header.Set("X-Slacker-Request-Timestamp", strconv.FormatInt(ts, 10))
+		hookReq.Header.Set("X-Slacker-Signature", SignWebhook(c.Secret, ts, body))
+	}
+	client := providerClient("Webhook "+name, destinationWebhooks)
+	client.Timeout = timeout
+	resp, err := client.Do(hookReq)
+	if err != nil {
+		return nil, fmt.Errorf("Webhook %s: %s", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Webhook %s returned %d status", name, resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := CheckWebhookResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("Webhook %s: %s", name, err)
+	}
+	if private {
+		payload["response_type"] = visibilityEphemeral
+	}
+	return payload, nil
+}
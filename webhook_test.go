@@ -0,0 +1,136 @@
+// Copyright 2015, 2016, 2017 Ed Marshall. All rights reserved.
+// Use of this source code is governed by a GPL-style
+// license that can be found in the COPYING file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckWebhookResponse(t *testing.T) {
+	tests := []struct {
+		body  string
+		valid bool
+	}{
+		{`{"text":"hi"}`, true},
+		{`{"response_type":"in_channel","blocks":[],"mrkdwn":true}`, true},
+		{`{"attachments":[{"text":"hi"}]}`, true},
+		{`[]`, false},
+		{`{}`, false},
+		{`{"text":3}`, false},
+		{`{"text":"hi","response_type":"loud"}`, false},
+		{`{"text":"hi","replace_original":true}`, false},
+		{`{"blocks":"nope"}`, false},
+	}
+	for _, test := range tests {
+		_, err := CheckWebhookResponse([]byte(test.body))
+		if test.valid != (err == nil) {
+			t.Errorf("%s: expected valid=%v, got %v", test.body, test.valid, err)
+		}
+	}
+}
+
+func TestWebhookConfigValidate(t *testing.T) {
+	var c Configuration
+	for _, hook := range []string{
+		`[Webhooks.deploy]` + "\nURL = \"https://example.com/\"\n",
+		`[Webhooks."/deploy"]` + "\nURL = \"ftp://example.com/\"\n",
+		`[Webhooks."/deploy"]` + "\nURL = \"https://example.com/\"\nResponse = \"thread\"\n",
+	} {
+		if err := LoadConfig(&c, strings.NewReader(hook)); err == nil {
+			t.Errorf("expected %q to be rejected", hook)
+		}
+	}
+}
+
+func TestWebhookCommand(t *testing.T) {
+	var got WebhookRequest
+	var signed bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		stamp, _ := strconv.ParseInt(r.Header.Get("X-Slacker-Request-Timestamp"), 10, 64)
+		signed = r.Header.Get("X-Slacker-Signature") == SignWebhook("s3cret", stamp, body)
+		switch got.Args[0] {
+		case "bad":
+			fmt.Fprint(w, `{"text":"hi","unexpected":1}`)
+		case "fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "public":
+			fmt.Fprint(w, `{"text":"deployed","response_type":"in_channel"}`)
+		default:
+			fmt.Fprint(w, `{"text":"deployed"}`)
+		}
+	}))
+	defer ts.Close()
+
+	var c Configuration
+	err := LoadConfig(&c, strings.NewReader(fmt.Sprintf(`
+DisabledCommands = ["/ticker"]
+[Webhooks."/Deploy"]
+URL = "%s"
+Secret = "s3cret"
+Timeout = 2
+`, ts.URL)))
+	if err != nil {
+		t.Fatal("Error parsing TOML configuration:", err)
+	}
+	SetConfig(c)
+	commands, err := BuildCommands(&c)
+	if err != nil {
+		t.Fatal("BuildCommands failed:", err)
+	}
+	handler := commands["/deploy"]
+	if handler == nil {
+		t.Fatal("expected /deploy to be served")
+	}
+
+	call := func(text string) map[string]interface{} {
+		form := url.Values{"command": {"/deploy"}, "text": {text}, "user_id": {"U1"}}
+		req := httptest.NewRequest("POST", "/cmd", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		if err := handler(w, req.WithContext(NewContext(req.Context(), req))); err != nil {
+			t.Fatal("handler failed:", err)
+		}
+		var payload map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &payload)
+		return payload
+	}
+
+	if p := call(`web "to prod"`); p["text"] != "deployed" || p["response_type"] != "ephemeral" {
+		t.Errorf("unexpected answer %v", p)
+	}
+	if !signed || got.Command != "/deploy" || got.UserID != "U1" ||
+		!reflect.DeepEqual(got.Args, []string{"web", "to prod"}) {
+		t.Errorf("unexpected request %+v (signed %v)", got, signed)
+	}
+	if p := call("public"); p["response_type"] != "in_channel" {
+		t.Errorf("expected a public answer, got %v", p)
+	}
+	if p := call("-private public"); p["response_type"] != "ephemeral" ||
+		got.Text != "public" || !reflect.DeepEqual(got.Args, []string{"public"}) {
+		t.Errorf("expected a private answer without -private forwarded, got %v for %+v", p, got)
+	}
+	for _, text := range []string{"bad", "fail"} {
+		if p := call(text); p["response_type"] != "ephemeral" ||
+			!strings.Contains(p["text"].(string), "An error occurred") {
+			t.Errorf("%s: expected a private error, got %v", text, p)
+		}
+	}
+
+	c.Webhooks["/fx"] = WebhookConfig{URL: ts.URL}
+	if _, err := BuildCommands(&c); err == nil {
+		t.Error("expected a webhook hiding /fx to be rejected")
+	}
+}
@@ -5,15 +5,69 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-var apiYahooFinance = "https://query1.finance.yahoo.com/v7/finance/quote"
+// Yahoo is a Yahoo Finance API, found at the URLs of its quote, search and
+// chart endpoints.
+type Yahoo struct {
+	QuoteURL  string
+	SearchURL string
+	ChartURL  string // the symbol is appended
+	// Transport, if set, is what requests are made through, instead of
+	// the configured transport.
+	Transport http.RoundTripper
+}
+
+// YahooFinance is the real Yahoo Finance API, which requests use unless
+// their context carries another.
+var YahooFinance = &Yahoo{
+	QuoteURL:  "https://query1.finance.yahoo.com/v7/finance/quote",
+	SearchURL: "https://query2.finance.yahoo.com/v1/finance/search",
+	ChartURL:  "https://query1.finance.yahoo.com/v8/finance/chart/",
+}
+
+// NewYahoo returns a Yahoo Finance API served from base (a stand-in for
+// testing, say), with the same paths as the real one.
+func NewYahoo(base string) *Yahoo {
+	return &Yahoo{
+		QuoteURL:  base + "/v7/finance/quote",
+		SearchURL: base + "/v1/finance/search",
+		ChartURL:  base + "/v8/finance/chart/",
+	}
+}
+
+// client returns an HTTP client for requests to this Yahoo Finance API.
+func (y *Yahoo) client() *http.Client {
+	if y.Transport != nil {
+		return providerClientVia("Yahoo Finance", destinationYahoo, y.Transport)
+	}
+	return providerClient("Yahoo Finance", destinationYahoo)
+}
+
+const yahooKey uint64 = 3
+
+// WithYahoo attaches the Yahoo Finance API to use to a context.
+func WithYahoo(ctx context.Context, yahoo *Yahoo) context.Context {
+	return context.WithValue(ctx, yahooKey, yahoo)
+}
+
+// YahooFromContext retrieves the Yahoo Finance API attached to a context, or
+// the real one if there isn't one.
+func YahooFromContext(ctx context.Context) *Yahoo {
+	if yahoo, ok := ctx.Value(yahooKey).(*Yahoo); ok {
+		return yahoo
+	}
+	return YahooFinance
+}
 
 // APIError represents an error response
 type APIError struct {
@@ -30,6 +84,7 @@ type APIResult struct {
 	Bid                               float64 `json:"bid,omitempty"`                               // 0.0,
 	BidSize                           int     `json:"bidSize,omitempty"`                           // 0,
 	BookValue                         float64 `json:"bookValue,omitempty"`                         // 6.452,
+	CirculatingSupply                 int64   `json:"circulatingSupply,omitempty"`                 // 18569618,
 	Currency                          string  `json:"currency,omitempty"`                          // "USD",
 	EarningsTimestamp                 int64   `json:"earningsTimestamp,omitempty"`                 // 1509021000,
 	EarningsTimestampEnd              int64   `json:"earningsTimestampEnd,omitempty"`              // 1518442200,
@@ -40,6 +95,7 @@ type APIResult struct {
 	ExchangeDataDelayedBy             int     `json:"exchangeDataDelayedBy,omitempty"`             // 0,
 	ExchangeTimezoneName              string  `json:"exchangeTimezoneName,omitempty"`              // "America/New_York",
 	ExchangeTimezoneShortName         string  `json:"exchangeTimezoneShortName,omitempty"`         // "EST",
+	ExpireDate                        int64   `json:"expireDate,omitempty"`                        // 1734652800,
 	FiftyDayAverage                   float64 `json:"fiftyDayAverage,omitempty"`                   // 19.315556,
 	FiftyDayAverageChange             float64 `json:"fiftyDayAverageChange,omitempty"`             // 2.954445,
 	FiftyDayAverageChangePercent      float64 `json:"fiftyDayAverageChangePercent,omitempty"`      // 0.15295677,
@@ -51,6 +107,7 @@ type APIResult struct {
 	FiftyTwoWeekLowChangePercent      float64 `json:"fiftyTwoWeekLowChangePercent,omitempty"`      // 0.5771955,
 	FinancialCurrency                 string  `json:"financialCurrency,omitempty"`                 // "USD",
 	ForwardPE                         float64 `json:"forwardPE,omitempty"`                         // 49.48889,
+	FromCurrency                      string  `json:"fromCurrency,omitempty"`                      // "BTC",
 	FullExchangeName                  string  `json:"fullExchangeName,omitempty"`                  // "NYSE",
 	GmtOffSetMilliseconds             int64   `json:"gmtOffSetMilliseconds,omitempty"`             // -18000000,
 	Language                          string  `json:"language,omitempty"`                          // "en-US",
@@ -59,10 +116,16 @@ type APIResult struct {
 	MarketCap                         int64   `json:"marketCap,omitempty"`                         // 16471872512,
 	MarketState                       string  `json:"marketState,omitempty"`                       // "CLOSED",
 	MessageBoardId                    string  `json:"messageBoardId,omitempty"`                    // "finmb_35962803",
+	NetAssets                         float64 `json:"netAssets,omitempty"`                         // 1.13653E12,
+	OpenInterest                      int64   `json:"openInterest,omitempty"`                      // 2086312,
 	PostMarketChange                  float64 `json:"postMarketChange,omitempty"`                  // -0.010000229,
 	PostMarketChangePercent           float64 `json:"postMarketChangePercent,omitempty"`           // -0.044904485,
 	PostMarketPrice                   float64 `json:"postMarketPrice,omitempty"`                   // 22.26,
 	PostMarketTime                    int64   `json:"postMarketTime,omitempty"`                    // 1511398614,
+	PreMarketChange                   float64 `json:"preMarketChange,omitempty"`                   // 0.1800003,
+	PreMarketChangePercent            float64 `json:"preMarketChangePercent,omitempty"`            // 0.80826,
+	PreMarketPrice                    float64 `json:"preMarketPrice,omitempty"`                    // 22.45,
+	PreMarketTime                     int64   `json:"preMarketTime,omitempty"`                     // 1511440200,
 	PriceHint                         int     `json:"priceHint,omitempty"`                         // 2,
 	PriceToBook                       float64 `json:"priceToBook,omitempty"`                       // 3.451643,
 	QuoteSourceName                   string  `json:"quoteSourceName,omitempty"`                   // "Delayed Quote",
@@ -80,10 +143,16 @@ type APIResult struct {
 	ShortName                         string  `json:"shortName,omitempty"`                         // "Twitter, Inc.",
 	SourceInterval                    int     `json:"sourceInterval,omitempty"`                    // 15,
 	Symbol                            string  `json:"symbol,omitempty"`                            // "TWTR",
+	ToCurrency                        string  `json:"toCurrency,omitempty"`                        // "USD=X",
 	Tradeable                         bool    `json:"tradeable,omitempty"`                         // true,
+	TrailingPE                        float64 `json:"trailingPE,omitempty"`                        // 17.955,
 	TwoHundredDayAverage              float64 `json:"twoHundredDayAverage,omitempty"`              // 18.075928,
 	TwoHundredDayAverageChange        float64 `json:"twoHundredDayAverageChange,omitempty"`        // 4.1940727,
-	TwoHundredDayAverageChangePercent float64 `json:"twoHundredDayAverageChangePercent,omitempty"` // 0.23202531
+	TwoHundredDayAverageChangePercent float64 `json:"twoHundredDayAverageChangePercent,omitempty"` // 0.23202531,
+	UnderlyingSymbol                  string  `json:"underlyingSymbol,omitempty"`                  // "ES=F",
+	Volume24Hr                        int64   `json:"volume24Hr,omitempty"`                        // 38419382272,
+	VolumeAllCurrencies               int64   `json:"volumeAllCurrencies,omitempty"`               // 38419382272,
+	YtdReturn                         float64 `json:"ytdReturn,omitempty"`                         // 12.85
 }
 
 // APIMessage represents a standard API response
@@ -95,11 +164,192 @@ type APIMessage struct {
 // APIEnvelope is the wrapping envelope around a Yahoo Finance API response
 type APIEnvelope map[string]APIMessage
 
+// SearchResult is a single candidate symbol from a Yahoo Finance search
+type SearchResult struct {
+	Symbol          string `json:"symbol"`    // "AAPL"
+	ShortName       string `json:"shortname"` // "Apple Inc."
+	LongName        string `json:"longname"`  // "Apple Inc."
+	Exchange        string `json:"exchange"`  // "NMS"
+	ExchangeDisplay string `json:"exchDisp"`  // "NASDAQ"
+	QuoteType       string `json:"quoteType"` // "EQUITY"
+	TypeDisplay     string `json:"typeDisp"`  // "Equity"
+}
+
+// Name returns the most descriptive name we have for a search result.
+func (r SearchResult) Name() string {
+	if r.LongName != "" {
+		return r.LongName
+	}
+	return r.ShortName
+}
+
+// SearchSymbols asks Yahoo Finance for up to count symbols whose names look
+// like the given query, most relevant first.
+func (y *Yahoo) SearchSymbols(query string, count int) ([]SearchResult, error) {
+	search, err := url.Parse(y.SearchURL)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"q":           {query},
+		"quotesCount": {strconv.Itoa(count)},
+		"newsCount":   {"0"},
+	}
+	search.RawQuery = params.Encode()
+	resp, err := y.client().Get(search.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Yahoo Finance search returned %d status",
+			resp.StatusCode)
+	}
+
+	var response struct {
+		Quotes []SearchResult `json:"quotes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for _, r := range response.Quotes {
+		// Search also turns up things we can't quote, like private
+		// companies; skip anything without a usable symbol.
+		if r.Symbol == "" || !ValidSymbol(r.Symbol) {
+			continue
+		}
+		results = append(results, r)
+		if len(results) == count {
+			break
+		}
+	}
+	return results, nil
+}
+
+// Bar is a single trading session of historical OHLCV data
+type Bar struct {
+	Time   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+}
+
+// History is a run of daily bars for a symbol, oldest first
+type History struct {
+	Symbol   string
+	Currency string
+	Location *time.Location
+	Bars     []Bar
+}
+
+// chartResponse is the raw shape of a Yahoo Finance chart API response
+type chartResponse struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Currency             string `json:"currency"`             // "USD"
+				Symbol               string `json:"symbol"`               // "AAPL"
+				ExchangeTimezoneName string `json:"exchangeTimezoneName"` // "America/New_York"
+				GmtOffset            int    `json:"gmtoffset"`            // -14400
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Open   []float64 `json:"open"`
+					High   []float64 `json:"high"`
+					Low    []float64 `json:"low"`
+					Close  []float64 `json:"close"`
+					Volume []int64   `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error *APIError `json:"error"`
+	} `json:"chart"`
+}
+
+// GetHistory asks Yahoo Finance for the daily bars of a symbol between two
+// times (end exclusive). Days without trading simply have no bar.
+func (y *Yahoo) GetHistory(symbol string, start, end time.Time) (History, error) {
+	history := History{Symbol: symbol}
+	query, err := url.Parse(y.ChartURL + url.PathEscape(symbol))
+	if err != nil {
+		return history, err
+	}
+
+	params := url.Values{
+		"period1":  {strconv.FormatInt(start.Unix(), 10)},
+		"period2":  {strconv.FormatInt(end.Unix(), 10)},
+		"interval": {"1d"},
+	}
+	query.RawQuery = params.Encode()
+	resp, err := y.client().Get(query.String())
+	if err != nil {
+		return history, err
+	}
+	defer resp.Body.Close()
+
+	// The chart API reports unknown symbols as a 404 with an error body,
+	// so try to decode the body before looking at the status code.
+	var chart chartResponse
+	decodeErr := json.NewDecoder(resp.Body).Decode(&chart)
+	if decodeErr == nil && chart.Chart.Error != nil {
+		return history, fmt.Errorf("Yahoo Finance chart API returned `%s` error: %s",
+			chart.Chart.Error.Code, chart.Chart.Error.Description)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return history, fmt.Errorf("Yahoo Finance chart API returned %d status",
+			resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return history, decodeErr
+	}
+	if len(chart.Chart.Result) == 0 {
+		return history, nil
+	}
+
+	result := chart.Chart.Result[0]
+	history.Currency = result.Meta.Currency
+	history.Location = time.FixedZone("", result.Meta.GmtOffset)
+	if loc, err := time.LoadLocation(result.Meta.ExchangeTimezoneName); err == nil {
+		history.Location = loc
+	}
+	if len(result.Indicators.Quote) == 0 {
+		return history, nil
+	}
+	q := result.Indicators.Quote[0]
+	for i, ts := range result.Timestamp {
+		// Yahoo pads the series with nulls for sessions it has no data
+		// for; those decode as zeroes, and are skipped.
+		if i >= len(q.Close) || q.Close[i] == 0 {
+			continue
+		}
+		bar := Bar{Time: time.Unix(ts, 0).In(history.Location), Close: q.Close[i]}
+		if i < len(q.Open) {
+			bar.Open = q.Open[i]
+		}
+		if i < len(q.High) {
+			bar.High = q.High[i]
+		}
+		if i < len(q.Low) {
+			bar.Low = q.Low[i]
+		}
+		if i < len(q.Volume) {
+			bar.Volume = q.Volume[i]
+		}
+		history.Bars = append(history.Bars, bar)
+	}
+	return history, nil
+}
+
 // GetTickers asks Yahoo Finance for a complete rundown of information about
 // a given stock symbol, and returns it as a YahooQuote, or returns an error
 // if something goes wrong.
-func GetTickers(symbols []string) ([]APIResult, error) {
-	query, err := url.Parse(apiYahooFinance)
+func (y *Yahoo) GetTickers(symbols []string) ([]APIResult, error) {
+	query, err := url.Parse(y.QuoteURL)
 	if err != nil {
 		return nil, err
 	}
@@ -108,18 +358,18 @@ func GetTickers(symbols []string) ([]APIResult, error) {
 		"symbols": {strings.Join(symbols, ",")},
 	}
 	query.RawQuery = params.Encode()
-	client := http.Client{Timeout: Config.HTTPClientTimeout}
-	resp, err := client.Get(query.String())
+	resp, err := y.client().Get(query.String())
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Yahoo Finance API returned %d status",
 			resp.StatusCode)
 	}
-	if !strings.HasPrefix(resp.Header["Content-Type"][0], "application/json") {
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
 		return nil, fmt.Errorf("Yahoo Finance API returned `%s` content type",
-			resp.Header["Content-Type"][0])
+			contentType)
 	}
 
 	var envelope APIEnvelope
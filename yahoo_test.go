@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -16,8 +17,8 @@ func TestGetTickers(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
 	defer ts.Close()
 
-	apiYahooFinance = ts.URL
-	tickers, err := GetTickers([]string{"TEST", "TEST1"})
+	yahoo := NewYahoo(ts.URL)
+	tickers, err := yahoo.GetTickers([]string{"TEST", "TEST1"})
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
@@ -27,9 +28,29 @@ func TestGetTickers(t *testing.T) {
 	}
 }
 
+func TestGetTickersEncoding(t *testing.T) {
+	var symbols string
+	tickerHandler := func(w http.ResponseWriter, r *http.Request) {
+		symbols = r.URL.Query().Get("symbols")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{\"quoteResponse\":{\"result\":[]}}")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
+	defer ts.Close()
+
+	yahoo := NewYahoo(ts.URL)
+	if _, err := yahoo.GetTickers([]string{"^GSPC", "CL=F", "BRK-B"}); err != nil {
+		t.Errorf("Error: %v", err)
+	}
+	if symbols != "^GSPC,CL=F,BRK-B" {
+		t.Errorf("symbols mangled in transit: %s", symbols)
+	}
+}
+
 func TestYahooDown(t *testing.T) {
-	apiYahooFinance = "http://127.0.0.1:8888/"
-	_, err := GetTickers([]string{"TEST"})
+	yahoo := NewYahoo("http://127.0.0.1:8888")
+	_, err := yahoo.GetTickers([]string{"TEST"})
 	if err == nil {
 		t.Errorf("GetTickers didn't catch unreachable API endpoint")
 	}
@@ -43,8 +64,8 @@ func TestYahooErrorStatus(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
 	defer ts.Close()
 
-	apiYahooFinance = ts.URL
-	_, err := GetTickers([]string{"TEST"})
+	yahoo := NewYahoo(ts.URL)
+	_, err := yahoo.GetTickers([]string{"TEST"})
 	if err == nil {
 		t.Errorf("GetTickers didn't catch error from API endpoint")
 	}
@@ -59,13 +80,29 @@ func TestYahooErrorContentType(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
 	defer ts.Close()
 
-	apiYahooFinance = ts.URL
-	_, err := GetTickers([]string{"TEST"})
+	yahoo := NewYahoo(ts.URL)
+	_, err := yahoo.GetTickers([]string{"TEST"})
 	if err == nil {
 		t.Errorf("GetTickers didn't catch bad content type")
 	}
 }
 
+func TestYahooMissingContentType(t *testing.T) {
+	tickerHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Content-Type"] = nil
+		fmt.Fprint(w, "Bad gateway")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
+	defer ts.Close()
+
+	yahoo := NewYahoo(ts.URL)
+	_, err := yahoo.GetTickers([]string{"TEST"})
+	if err == nil {
+		t.Errorf("GetTickers didn't catch missing content type")
+	}
+}
+
 func TestYahooBadRecordCount(t *testing.T) {
 	tickerHandler := func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/octet-stream")
@@ -75,8 +112,8 @@ func TestYahooBadRecordCount(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
 	defer ts.Close()
 
-	apiYahooFinance = ts.URL
-	_, err := GetTickers([]string{"TEST"})
+	yahoo := NewYahoo(ts.URL)
+	_, err := yahoo.GetTickers([]string{"TEST"})
 	if err == nil {
 		t.Errorf("GetTickers didn't catch wrong number of records")
 	}
@@ -91,17 +128,70 @@ func TestYahooBadFieldCount(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(tickerHandler))
 	defer ts.Close()
 
-	apiYahooFinance = ts.URL
-	_, err := GetTickers([]string{"TEST", "TEST1"})
+	yahoo := NewYahoo(ts.URL)
+	_, err := yahoo.GetTickers([]string{"TEST", "TEST1"})
 	if err == nil {
 		t.Errorf("GetTickers didn't catch wrong number of fields")
 	}
 }
 
 func TestYahooBadURL(t *testing.T) {
-	apiYahooFinance = ":"
-	_, err := GetTickers(nil)
+	yahoo := &Yahoo{QuoteURL: ":"}
+	_, err := yahoo.GetTickers(nil)
 	if err == nil {
 		t.Errorf("GetTickers didn't catch invalid URL")
 	}
 }
+
+func TestSearchSymbols(t *testing.T) {
+	var query string
+	searchHandler := func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{\"quotes\":[{\"symbol\":\"AAPL\",\"shortname\":\"Apple Inc.\",\"exchDisp\":\"NASDAQ\"},"+
+			"{\"shortname\":\"Apple Private\"},{\"symbol\":\"APLE\",\"longname\":\"Apple Hospitality REIT, Inc.\"}]}")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(searchHandler))
+	defer ts.Close()
+
+	yahoo := NewYahoo(ts.URL)
+	results, err := yahoo.SearchSymbols("apple inc", 5)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if query != "apple inc" {
+		t.Errorf("query mangled in transit: %s", query)
+	}
+	if len(results) != 2 || results[0].Symbol != "AAPL" || results[1].Name() != "Apple Hospitality REIT, Inc." {
+		t.Errorf("result mismatch: %+v", results)
+	}
+
+	if results, _ := yahoo.SearchSymbols("apple", 1); len(results) != 1 {
+		t.Errorf("expected 1 result, got %d", len(results))
+	}
+}
+
+func TestYahooSearchErrorStatus(t *testing.T) {
+	searchHandler := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "error", http.StatusBadRequest)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(searchHandler))
+	defer ts.Close()
+
+	yahoo := NewYahoo(ts.URL)
+	if _, err := yahoo.SearchSymbols("apple", 5); err == nil {
+		t.Errorf("SearchSymbols didn't catch error from API endpoint")
+	}
+}
+
+func TestYahooFromContext(t *testing.T) {
+	if YahooFromContext(context.Background()) != YahooFinance {
+		t.Error("expected the real Yahoo Finance API by default")
+	}
+	yahoo := NewYahoo("http://127.0.0.1:8888")
+	if YahooFromContext(WithYahoo(context.Background(), yahoo)) != yahoo {
+		t.Error("expected the Yahoo Finance API attached to the context")
+	}
+}